@@ -0,0 +1,209 @@
+package acl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+)
+
+// Mask is a bit mask of permissions
+type Mask uint32
+
+const (
+	MaskView Mask = 1 << iota
+	MaskCreate
+	MaskEdit
+	MaskDelete
+	MaskUndelete
+	MaskOperator
+	MaskMaster
+	MaskOwner
+)
+
+var maskNames = map[string]Mask{
+	"VIEW":     MaskView,
+	"CREATE":   MaskCreate,
+	"EDIT":     MaskEdit,
+	"DELETE":   MaskDelete,
+	"UNDELETE": MaskUndelete,
+	"OPERATOR": MaskOperator,
+	"MASTER":   MaskMaster,
+	"OWNER":    MaskOwner,
+}
+
+// ParseMask returns the mask of a permission name like "VIEW" or "EDIT"
+func ParseMask(name string) (Mask, bool) {
+	m, ok := maskNames[strings.ToUpper(name)]
+	return m, ok
+}
+
+var implied = map[Mask]Mask{
+	MaskView:     MaskView | MaskEdit | MaskOperator | MaskMaster | MaskOwner,
+	MaskCreate:   MaskCreate | MaskOperator | MaskMaster | MaskOwner,
+	MaskEdit:     MaskEdit | MaskOperator | MaskMaster | MaskOwner,
+	MaskDelete:   MaskDelete | MaskOperator | MaskMaster | MaskOwner,
+	MaskUndelete: MaskUndelete | MaskOperator | MaskMaster | MaskOwner,
+	MaskOperator: MaskOperator | MaskMaster | MaskOwner,
+	MaskMaster:   MaskMaster | MaskOwner,
+	MaskOwner:    MaskOwner,
+}
+
+// Implied returns all masks that grant one of the permissions in m,
+// e.g. OWNER grants EDIT
+func (m Mask) Implied() Mask {
+	var out Mask
+	for bit, imp := range implied {
+		if m&bit != 0 {
+			out |= imp
+		}
+	}
+
+	return out
+}
+
+// ObjectIdentity identifies a domain object by type and id
+type ObjectIdentity struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+func (o ObjectIdentity) String() string {
+	return o.Type + ":" + o.ID
+}
+
+// DomainObject is implemented by objects that are protected by an ACL
+type DomainObject interface {
+	ObjectIdentity() ObjectIdentity
+}
+
+func ObjectIdentityOf(subject interface{}) (ObjectIdentity, bool) {
+	switch s := subject.(type) {
+	case ObjectIdentity:
+		return s, true
+	case *ObjectIdentity:
+		return *s, s != nil
+	case DomainObject:
+		return s.ObjectIdentity(), true
+	}
+
+	return ObjectIdentity{}, false
+}
+
+type SIDKind int
+
+const (
+	SIDIdentity SIDKind = iota
+	SIDRole
+)
+
+// SecurityIdentity is who an entry applies to: an identity ID or a role
+type SecurityIdentity struct {
+	Kind  SIDKind `json:"kind"`
+	Value string  `json:"value"`
+}
+
+func IdentitySID(id interface{}) SecurityIdentity {
+	return SecurityIdentity{Kind: SIDIdentity, Value: fmt.Sprintf("%v", id)}
+}
+
+func RoleSID(r role.Role) SecurityIdentity {
+	return SecurityIdentity{Kind: SIDRole, Value: string(r)}
+}
+
+// SecurityIdentities returns the identity of the token followed by the roles it
+// reaches in h
+func SecurityIdentities(h role.Hierarchy, tok token.Token) []SecurityIdentity {
+	var sids []SecurityIdentity
+	if tok == nil {
+		return sids
+	}
+
+	if it, ok := tok.(token.IdentityToken); ok && it.Identity() != nil {
+		sids = append(sids, IdentitySID(it.Identity().ID()))
+	}
+
+	for _, r := range role.Reachable(h, tok.Roles()) {
+		sids = append(sids, RoleSID(r))
+	}
+
+	return sids
+}
+
+type Entry struct {
+	SID      SecurityIdentity `json:"sid"`
+	Mask     Mask             `json:"mask"`
+	Granting bool             `json:"granting"`
+}
+
+// ACL holds the entries of an object. Entries are checked in order, the first
+// entry matching one of the security identities and the mask decides, whatever
+// the order of the identities. If no entry matches and InheritEntries is set, the
+// parent's ACL is consulted.
+type ACL struct {
+	Object         ObjectIdentity  `json:"object"`
+	Parent         *ObjectIdentity `json:"parent,omitempty"`
+	InheritEntries bool            `json:"inheritEntries"`
+	Entries        []Entry         `json:"entries"`
+}
+
+func NewACL(oid ObjectIdentity) *ACL {
+	return &ACL{Object: oid, InheritEntries: true}
+}
+
+func (a *ACL) Grant(sid SecurityIdentity, mask Mask) {
+	a.Entries = append(a.Entries, Entry{SID: sid, Mask: mask, Granting: true})
+}
+
+// Deny denies exactly the permissions in mask. Unlike grants, implied masks are
+// not denied, denying OWNER does not deny VIEW.
+func (a *ACL) Deny(sid SecurityIdentity, mask Mask) {
+	a.Entries = append(a.Entries, Entry{SID: sid, Mask: mask, Granting: false})
+}
+
+// decide returns whether an entry matched and if it grants. Granting entries
+// match masks that imply mask, denying entries only match mask itself.
+func (a *ACL) decide(sids []SecurityIdentity, mask Mask) (bool, bool) {
+	required := mask.Implied()
+	for _, e := range a.Entries {
+		if !e.Granting && e.Mask&mask == 0 || e.Granting && e.Mask&required == 0 {
+			continue
+		}
+
+		for _, sid := range sids {
+			if e.SID == sid {
+				return true, e.Granting
+			}
+		}
+	}
+
+	return false, false
+}
+
+// IsGranted checks the ACL of oid and its parents
+func IsGranted(p Provider, oid ObjectIdentity, sids []SecurityIdentity, mask Mask) (bool, error) {
+	visited := make(map[ObjectIdentity]bool)
+
+	for {
+		if visited[oid] {
+			return false, fmt.Errorf("acl inheritance cycle at %s", oid)
+		}
+		visited[oid] = true
+
+		acl, err := p.Find(oid)
+		if err != nil {
+			return false, err
+		}
+
+		if matched, granted := acl.decide(sids, mask); matched {
+			return granted, nil
+		}
+
+		if !acl.InheritEntries || acl.Parent == nil {
+			return false, nil
+		}
+
+		oid = *acl.Parent
+	}
+}
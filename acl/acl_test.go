@@ -0,0 +1,95 @@
+package acl
+
+import (
+	"testing"
+
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+)
+
+func TestInheritedEntries(t *testing.T) {
+	p := NewInMemoryProvider()
+
+	folder := ObjectIdentity{Type: "folder", ID: "1"}
+	doc := ObjectIdentity{Type: "document", ID: "2"}
+
+	folderACL := NewACL(folder)
+	folderACL.Grant(IdentitySID("alice"), MaskOwner)
+	folderACL.Grant(RoleSID(role.RLUser), MaskView)
+	p.Save(folderACL)
+
+	docACL := NewACL(doc)
+	docACL.Parent = &folder
+	docACL.Deny(IdentitySID("bob"), MaskView)
+	p.Save(docACL)
+
+	alice := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserId: "alice", UserRoles: []role.Role{role.RLUser}})
+	bob := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserId: "bob", UserRoles: []role.Role{role.RLUser}})
+	carol := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserId: "carol", UserRoles: []role.Role{role.RLUser}})
+
+	tests := []struct {
+		tok      token.Token
+		mask     Mask
+		expected bool
+	}{
+		{alice, MaskEdit, true},
+		{carol, MaskView, true},
+		{carol, MaskEdit, false},
+		{bob, MaskView, false},
+	}
+
+	for i, tt := range tests {
+		granted, err := IsGranted(p, doc, SecurityIdentities(nil, tt.tok), tt.mask)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if granted != tt.expected {
+			t.Errorf("%d: expected %v, got %v", i, tt.expected, granted)
+		}
+	}
+}
+
+func TestFirstMatchingEntryDecides(t *testing.T) {
+	doc := ObjectIdentity{Type: "document", ID: "1"}
+	alice := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserId: "alice", UserRoles: []role.Role{role.RLUser}})
+
+	grantFirst := NewACL(doc)
+	grantFirst.Grant(RoleSID(role.RLUser), MaskView)
+	grantFirst.Deny(IdentitySID("alice"), MaskView)
+
+	denyFirst := NewACL(doc)
+	denyFirst.Deny(RoleSID(role.RLUser), MaskView)
+	denyFirst.Grant(IdentitySID("alice"), MaskView)
+
+	denyOwner := NewACL(doc)
+	denyOwner.Deny(IdentitySID("alice"), MaskOwner)
+	denyOwner.Grant(RoleSID(role.RLUser), MaskEdit)
+
+	tests := []struct {
+		name     string
+		acl      *ACL
+		mask     Mask
+		expected bool
+	}{
+		{"role grant before identity deny", grantFirst, MaskView, true},
+		{"role deny before identity grant", denyFirst, MaskView, false},
+		{"denied owner keeps implied view", denyOwner, MaskView, true},
+		{"denied owner", denyOwner, MaskOwner, false},
+	}
+
+	for _, tt := range tests {
+		p := NewInMemoryProvider()
+		p.Save(tt.acl)
+
+		granted, err := IsGranted(p, doc, SecurityIdentities(nil, alice), tt.mask)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if granted != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, granted)
+		}
+	}
+}
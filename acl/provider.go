@@ -0,0 +1,71 @@
+package acl
+
+import (
+	"fmt"
+	"sync"
+)
+
+type Provider interface {
+	Find(oid ObjectIdentity) (*ACL, error)
+}
+
+type MutableProvider interface {
+	Provider
+	Save(acl *ACL) error
+	Delete(oid ObjectIdentity) error
+}
+
+type NotFound struct {
+	Object ObjectIdentity
+}
+
+func (e *NotFound) Error() string {
+	return fmt.Sprintf("no acl found for %s", e.Object)
+}
+
+type InMemoryProvider struct {
+	mu   sync.RWMutex
+	acls map[ObjectIdentity]*ACL
+}
+
+func NewInMemoryProvider() *InMemoryProvider {
+	return &InMemoryProvider{acls: make(map[ObjectIdentity]*ACL)}
+}
+
+func copyACL(a *ACL) *ACL {
+	c := *a
+	c.Entries = append([]Entry(nil), a.Entries...)
+	if a.Parent != nil {
+		p := *a.Parent
+		c.Parent = &p
+	}
+
+	return &c
+}
+
+func (p *InMemoryProvider) Find(oid ObjectIdentity) (*ACL, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if a, ok := p.acls[oid]; ok {
+		return copyACL(a), nil
+	}
+
+	return nil, &NotFound{Object: oid}
+}
+
+func (p *InMemoryProvider) Save(a *ACL) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.acls[a.Object] = copyACL(a)
+	return nil
+}
+
+func (p *InMemoryProvider) Delete(oid ObjectIdentity) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.acls, oid)
+	return nil
+}
@@ -0,0 +1,45 @@
+package acl
+
+import (
+	"context"
+
+	"github.com/iwyg/goauth/authorization"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+)
+
+// Voter votes on Mask attributes and permission names like "VIEW" for subjects
+// that have an object identity. Objects without an ACL are denied.
+type Voter struct {
+	Provider  Provider
+	Hierarchy role.Hierarchy
+}
+
+func (v *Voter) Vote(ctx context.Context, tok token.Token, attribute interface{}, subject interface{}) authorization.Vote {
+	var mask Mask
+
+	switch a := attribute.(type) {
+	case Mask:
+		mask = a
+	case string:
+		m, ok := ParseMask(a)
+		if !ok {
+			return authorization.AccessAbstain
+		}
+		mask = m
+	default:
+		return authorization.AccessAbstain
+	}
+
+	oid, ok := ObjectIdentityOf(subject)
+	if !ok {
+		return authorization.AccessAbstain
+	}
+
+	granted, err := IsGranted(v.Provider, oid, SecurityIdentities(v.Hierarchy, tok), mask)
+	if err != nil || !granted {
+		return authorization.AccessDenied
+	}
+
+	return authorization.AccessGranted
+}
@@ -0,0 +1,40 @@
+package audit
+
+import (
+	"time"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+)
+
+// Entry is a record of the audit trail. Entries never contain credentials or
+// tokens, Username is the credential identifying a user, e.g. an email address.
+type Entry struct {
+	Time          time.Time `json:"time"`
+	Event         string    `json:"event"`
+	Outcome       string    `json:"outcome"`
+	IdentityID    string    `json:"identity_id,omitempty"`
+	Username      string    `json:"username,omitempty"`
+	Impersonator  string    `json:"impersonator,omitempty"`
+	ClientIP      string    `json:"client_ip,omitempty"`
+	UserAgent     string    `json:"user_agent,omitempty"`
+	Firewall      string    `json:"firewall,omitempty"`
+	Authenticator string    `json:"authenticator,omitempty"`
+	Reason        string    `json:"reason,omitempty"`
+	PrevHash      string    `json:"prev_hash,omitempty"`
+	Hash          string    `json:"hash,omitempty"`
+}
+
+// Writer persists audit entries
+type Writer interface {
+	Write(e *Entry) error
+}
+
+type WriterFunc func(e *Entry) error
+
+func (f WriterFunc) Write(e *Entry) error {
+	return f(e)
+}
@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iwyg/goauth/event"
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/logging"
+	"github.com/iwyg/goauth/token"
+)
+
+func TestLoggerHashChain(t *testing.T) {
+	var buf bytes.Buffer
+	chain := NewHashChain(NewJSONWriter(&buf), "")
+
+	l := NewLogger(chain)
+	l.Now = func() time.Time { return time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+	d := event.NewEventDispatcher()
+	l.Subscribe(d)
+
+	r := httptest.NewRequest("POST", "/login", nil)
+	r.Header.Set("User-Agent", "test")
+
+	tok := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserId: "42", UserPass: "secret"})
+	d.Dispatch(event.NewLoginFailure(r, nil, "invalid credentials", "alice"))
+	d.Dispatch(event.NewLoginSuccess(r, tok, nil))
+	d.Dispatch(event.NewLogout(r, tok))
+
+	log := buf.String()
+	if strings.Contains(log, "secret") {
+		t.Error("audit log must not contain secrets")
+	}
+
+	if n := strings.Count(log, "\n"); n != 3 {
+		t.Fatalf("expected 3 entries, got %d", n)
+	}
+
+	last, err := Verify(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if last != chain.Last() {
+		t.Errorf("expected last hash %s, got %s", chain.Last(), last)
+	}
+
+	tampered := strings.Replace(log, `"identity_id":"42"`, `"identity_id":"43"`, 1)
+	if _, err := Verify(strings.NewReader(tampered)); err == nil {
+		t.Error("expected tampered log to fail verification")
+	}
+}
+
+func TestLoggerWriteErrors(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(WriterFunc(func(e *Entry) error { return errors.New("disk full") }), logging.WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+
+	d := event.NewEventDispatcher()
+	l.Subscribe(d)
+	d.Dispatch(event.NewLogout(httptest.NewRequest("POST", "/logout", nil), nil))
+
+	if out := buf.String(); !strings.Contains(out, "could not write audit entry") || !strings.Contains(out, "disk full") {
+		t.Errorf("expected the write error to be logged, got \"%s\"", out)
+	}
+
+	var handled error
+	l.OnError = func(err error) { handled = err }
+	buf.Reset()
+	d.Dispatch(event.NewLogout(httptest.NewRequest("POST", "/logout", nil), nil))
+
+	if handled == nil || buf.Len() != 0 {
+		t.Error("expected OnError to handle the write error")
+	}
+}
+
+func TestLoggerAccessDenied(t *testing.T) {
+	var entries []*Entry
+	l := NewLogger(WriterFunc(func(e *Entry) error {
+		entries = append(entries, e)
+		return nil
+	}))
+
+	d := event.NewEventDispatcher()
+	l.Subscribe(d)
+
+	r := event.WithFirewall(httptest.NewRequest("GET", "/admin", nil), "main")
+	tok := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserId: "42"})
+	d.Dispatch(event.NewAccessDenied(r, tok, []interface{}{"ROLE_ADMIN", "IS_AUTHENTICATED_FULLY"}, nil))
+
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+
+	e := entries[0]
+	if e.Outcome != OutcomeDenied || e.Firewall != "main" || e.IdentityID != "42" {
+		t.Errorf("unexpected entry %+v", e)
+	}
+
+	if e.Reason != "ROLE_ADMIN, IS_AUTHENTICATED_FULLY" {
+		t.Errorf("expected the denied attributes as reason, got \"%s\"", e.Reason)
+	}
+}
@@ -0,0 +1,145 @@
+package audit
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/iwyg/goauth/authentication"
+	"github.com/iwyg/goauth/event"
+	httpUtil "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/logging"
+	"github.com/iwyg/goauth/token"
+)
+
+// Priority of the audit handlers, they run after handlers that may still reject
+// an event
+const Priority = -1000
+
+// Logger records security events of a dispatcher
+type Logger struct {
+	Writer Writer
+	// OnError is called if an entry could not be written, errors are logged if nil
+	OnError func(err error)
+	// Now returns the time of an entry, defaults to time.Now
+	Now func() time.Time
+
+	logger *slog.Logger
+}
+
+// NewLogger creates an audit logger writing to w, errors are logged to the
+// logger configured by opts
+func NewLogger(w Writer, opts ...logging.Option) *Logger {
+	return &Logger{Writer: w, logger: logging.New(opts...)}
+}
+
+// Subscribe registers the logger for logins, failures, logouts, impersonation,
+// access denials and token revocations
+func (l *Logger) Subscribe(d *event.DefaultDispatcher) {
+	event.Listen(d, event.LoginSuccessEvent, func(e *event.LoginSuccess) {
+		entry := l.entry(e, OutcomeSuccess)
+		entry.Authenticator = authentication.AuthenticatorName(e.Authenticator)
+		setIdentity(entry, e.Token)
+		l.write(entry)
+	}, Priority)
+
+	event.Listen(d, event.LoginFailureEvent, func(e *event.LoginFailure) {
+		entry := l.entry(e, OutcomeFailure)
+		entry.Authenticator = authentication.AuthenticatorName(e.Authenticator)
+		entry.Username = e.Username
+		entry.Reason = e.Reason
+		l.write(entry)
+	}, Priority)
+
+	event.Listen(d, event.LogoutEvent, func(e *event.Logout) {
+		entry := l.entry(e, OutcomeSuccess)
+		setIdentity(entry, e.Token)
+		l.write(entry)
+	}, Priority)
+
+	event.Listen(d, event.SwitchUserEvent, func(e *event.SwitchUser) {
+		entry := l.entry(e, OutcomeSuccess)
+		setIdentity(entry, e.Token)
+		if e.Exit {
+			entry.Reason = "exit"
+		}
+		l.write(entry)
+	}, Priority)
+
+	event.Listen(d, event.AccessDeniedEvent, func(e *event.AccessDenied) {
+		entry := l.entry(e, OutcomeDenied)
+		entry.Reason = deniedAttributes(e.Attributes)
+		setIdentity(entry, e.Token)
+		l.write(entry)
+	}, Priority)
+
+	event.Listen(d, event.TokenRevokedEvent, func(e *event.TokenRevoked) {
+		entry := l.entry(e, OutcomeSuccess)
+		setIdentity(entry, e.Token)
+		l.write(entry)
+	}, Priority)
+}
+
+func (l *Logger) now() time.Time {
+	if l.Now == nil {
+		return time.Now().UTC()
+	}
+
+	return l.Now()
+}
+
+func (l *Logger) log() *slog.Logger {
+	if l.logger == nil {
+		return logging.New()
+	}
+
+	return l.logger
+}
+
+func (l *Logger) entry(e event.Event, outcome string) *Entry {
+	entry := &Entry{Time: l.now(), Event: e.Name(), Outcome: outcome}
+
+	if r := e.Request(); r != nil {
+		entry.ClientIP = httpUtil.ClientIPString(r)
+		entry.UserAgent = r.UserAgent()
+		entry.Firewall = event.FirewallName(r)
+	}
+
+	return entry
+}
+
+func (l *Logger) write(e *Entry) {
+	if err := l.Writer.Write(e); err != nil {
+		if l.OnError != nil {
+			l.OnError(err)
+			return
+		}
+		l.log().Error("could not write audit entry", "event", e.Event, "error", err)
+	}
+}
+
+func setIdentity(e *Entry, tok token.Token) {
+	it, ok := tok.(token.IdentityToken)
+	if !ok || it.Identity() == nil {
+		return
+	}
+
+	e.IdentityID = fmt.Sprintf("%v", it.Identity().ID())
+
+	if st, ok := tok.(*token.SwitchUserToken); ok {
+		if imp := st.Impersonator(); imp != nil {
+			e.Impersonator = fmt.Sprintf("%v", imp.ID())
+		}
+	}
+}
+
+// deniedAttributes lists the attributes an access was denied for
+func deniedAttributes(attributes []interface{}) string {
+	names := make([]string, len(attributes))
+	for i, a := range attributes {
+		names[i] = fmt.Sprintf("%v", a)
+	}
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// JSONWriter writes entries as JSON lines
+type JSONWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func NewJSONWriter(out io.Writer) *JSONWriter {
+	return &JSONWriter{out: out}
+}
+
+func (w *JSONWriter) Write(e *Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, err = w.out.Write(append(b, '\n'))
+
+	return err
+}
+
+// FileWriter appends JSON lines to a file
+type FileWriter struct {
+	*JSONWriter
+	file *os.File
+}
+
+func NewFileWriter(path string) (*FileWriter, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileWriter{JSONWriter: NewJSONWriter(f), file: f}, nil
+}
+
+func (w *FileWriter) Close() error {
+	return w.file.Close()
+}
+
+// HashChain links entries by their hashes, so removing or changing an entry
+// breaks the chain. The hash of an entry covers the entry and the previous hash.
+type HashChain struct {
+	mu   sync.Mutex
+	next Writer
+	last string
+}
+
+// NewHashChain chains the entries written to next, starting at last. last is
+// the hash of the last entry of an existing log or empty for a new log.
+func NewHashChain(next Writer, last string) *HashChain {
+	return &HashChain{next: next, last: last}
+}
+
+func hashEntry(e *Entry) (string, error) {
+	c := *e
+	c.Hash = ""
+
+	b, err := json.Marshal(&c)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (h *HashChain) Write(e *Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e.PrevHash = h.last
+
+	hash, err := hashEntry(e)
+	if err != nil {
+		return err
+	}
+	e.Hash = hash
+
+	if err := h.next.Write(e); err != nil {
+		return err
+	}
+
+	h.last = hash
+
+	return nil
+}
+
+// Last returns the hash of the last entry written
+func (h *HashChain) Last() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.last
+}
+
+// ChainError reports the line at which a hash chain is broken
+type ChainError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit log line %d: %s", e.Line, e.Msg)
+}
+
+// Verify checks the hash chain of a JSON lines log and returns the hash of its
+// last entry
+func Verify(r io.Reader) (string, error) {
+	var last string
+	var line int
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for s.Scan() {
+		line++
+
+		var e Entry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return last, &ChainError{Line: line, Msg: err.Error()}
+		}
+
+		if e.PrevHash != last {
+			return last, &ChainError{Line: line, Msg: "previous hash does not match"}
+		}
+
+		hash, err := hashEntry(&e)
+		if err != nil {
+			return last, &ChainError{Line: line, Msg: err.Error()}
+		}
+
+		if hash != e.Hash {
+			return last, &ChainError{Line: line, Msg: "entry hash does not match"}
+		}
+
+		last = hash
+	}
+
+	return last, s.Err()
+}
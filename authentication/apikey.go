@@ -0,0 +1,153 @@
+package authentication
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+)
+
+// APIClient is a machine client that authenticates with a bearer token or api key
+// on behalf of its owning identity
+type APIClient struct {
+	Owner  interface{}
+	Scopes []token.Scope
+	Roles  []role.Role
+}
+
+// APIClientProvider finds the client of an api key. Implementations must not
+// leak key contents through timing, e.g. by comparing hashes or using
+// crypto/subtle.
+type APIClientProvider interface {
+	Client(key string) (*APIClient, error)
+}
+
+type InMemoryAPIClientProvider struct {
+	Clients map[string]*APIClient
+}
+
+type ClientNotFound struct{}
+
+func (e *ClientNotFound) Error() string {
+	return "api client not found"
+}
+
+// Client compares key against every configured key in constant time, so the
+// lookup does not leak how much of a key matched
+func (p *InMemoryAPIClientProvider) Client(key string) (*APIClient, error) {
+	var found *APIClient
+	for k, c := range p.Clients {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			found = c
+		}
+	}
+
+	if found == nil {
+		return nil, &ClientNotFound{}
+	}
+
+	return found, nil
+}
+
+type apiKeyCredentials struct {
+	key       string
+	requested []token.Scope
+	client    *APIClient
+}
+
+// APIKeyAuthenticator authenticates "Authorization: Bearer <key>" headers or the
+// configured api key header. The issued token is limited to the client's scopes
+// and roles, optionally narrowed further by a requested scope parameter. The
+// client's roles are limited to the roles the owner reaches in Hierarchy.
+type APIKeyAuthenticator struct {
+	Clients        APIClientProvider
+	Header         string
+	ScopeParameter string
+	Hierarchy      role.Hierarchy
+}
+
+func (a *APIKeyAuthenticator) key(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+
+	if a.Header != "" {
+		return r.Header.Get(a.Header)
+	}
+
+	return ""
+}
+
+func (a *APIKeyAuthenticator) Supports(r *http.Request) bool {
+	return a.key(r) != ""
+}
+
+func (a *APIKeyAuthenticator) Credentials(r *http.Request) (interface{}, error) {
+	key := a.key(r)
+	if key == "" {
+		return nil, errors.New("request is not supported")
+	}
+
+	c := &apiKeyCredentials{key: key}
+	if a.ScopeParameter != "" {
+		if s := r.FormValue(a.ScopeParameter); s != "" {
+			c.requested = token.ParseScopes(s)
+		}
+	}
+
+	return c, nil
+}
+
+func (a *APIKeyAuthenticator) Identity(ctx context.Context, identities identity.Provider, credentials interface{}) (identity.Identity, error) {
+	c, ok := credentials.(*apiKeyCredentials)
+	if !ok {
+		return nil, errors.New("credentials not supported")
+	}
+
+	client, err := a.Clients.Client(c.key)
+	if err != nil {
+		return nil, err
+	}
+
+	c.client = client
+
+	return identity.ProvideContext(ctx, identities, client.Owner)
+}
+
+func (a *APIKeyAuthenticator) CheckCredentials(credentials interface{}, identity identity.Identity) error {
+	c, ok := credentials.(*apiKeyCredentials)
+	if !ok || c.client == nil {
+		return errors.New("unsupported credentials")
+	}
+
+	if len(token.IntersectScopes(c.client.Scopes, c.requested)) != len(c.requested) {
+		return errors.New("requested scope not granted")
+	}
+
+	return nil
+}
+
+// NewAuthenticatedToken issues a token without any scope. Use NewCredentialsToken
+// to issue the client's scoped token.
+func (a *APIKeyAuthenticator) NewAuthenticatedToken(identity identity.Identity) (token.PostAuthToken, error) {
+	return token.NewScopedToken(a.Hierarchy, identity, nil, nil), nil
+}
+
+func (a *APIKeyAuthenticator) NewCredentialsToken(credentials interface{}, identity identity.Identity) (token.PostAuthToken, error) {
+	c, ok := credentials.(*apiKeyCredentials)
+	if !ok || c.client == nil {
+		return nil, errors.New("unsupported credentials")
+	}
+
+	scopes := c.client.Scopes
+	if len(c.requested) > 0 {
+		scopes = token.IntersectScopes(c.client.Scopes, c.requested)
+	}
+
+	return token.NewScopedToken(a.Hierarchy, identity, scopes, c.client.Roles), nil
+}
@@ -0,0 +1,100 @@
+package authentication
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+)
+
+func newAPIKeyGuard() *GuardRequestAuthenticator {
+	owner := &identity.InMemoryIdentity{UserId: 1, UserCredential: "owner", UserRoles: []role.Role{role.RLUser}}
+
+	return NewGuardRequestAuthenticator(
+		&token.RequestContextStoreProvider{},
+		[]Authenticator{&APIKeyAuthenticator{
+			Clients: &InMemoryAPIClientProvider{Clients: map[string]*APIClient{
+				"secret-key": {Owner: "owner", Scopes: []token.Scope{"orders:read", "orders:write"}, Roles: []role.Role{role.RLUser, role.RLAdmin}},
+			}},
+			ScopeParameter: "scope",
+		}},
+		identity.NewInMemoryIdentityProvider(map[interface{}]identity.Identity{"owner": owner}),
+		identity.NewBaseIdentityChecker(),
+	)
+}
+
+func newAPIKeyRequest(target string, key string) *http.Request {
+	_, r := token.WithStore(httptest.NewRequest("GET", target, nil))
+	if key != "" {
+		r.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	return r
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	tok, err := newAPIKeyGuard().Authenticate(newAPIKeyRequest("/?scope=orders:read", "secret-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, ok := tok.(token.ScopedToken)
+	if !ok {
+		t.Fatalf("expected scoped token, got %T", tok)
+	}
+
+	if scopes := st.Scopes(); len(scopes) != 1 || scopes[0] != "orders:read" {
+		t.Errorf("expected requested scope only, got %v", scopes)
+	}
+
+	if roles := st.Roles(); len(roles) != 1 || roles[0] != role.RLUser {
+		t.Errorf("expected client roles limited to the owner's, got %v", roles)
+	}
+
+	if _, err := newAPIKeyGuard().Authenticate(newAPIKeyRequest("/", "wrong-key")); err == nil {
+		t.Error("expected unknown key to fail")
+	}
+
+	if _, err := newAPIKeyGuard().Authenticate(newAPIKeyRequest("/?scope=orders:delete", "secret-key")); err == nil {
+		t.Error("expected ungranted scope to fail")
+	}
+}
+
+func TestRequireScopesAndRoles(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h, err := role.NewHierarchy(map[role.Role][]role.Role{role.RLAdmin: {role.RLUser}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		tok      token.Token
+		expected int
+	}{
+		{"anonymous", RequireScopes("orders:read")(ok), token.NewAnonymousToken(), http.StatusUnauthorized},
+		{"granted scope", RequireScopes("orders:read")(ok), token.NewScopedToken(nil, &identity.InMemoryIdentity{}, []token.Scope{"orders:read"}, nil), http.StatusOK},
+		{"missing scope", RequireScopes("orders:write")(ok), token.NewScopedToken(nil, &identity.InMemoryIdentity{}, []token.Scope{"orders:read"}, nil), http.StatusForbidden},
+		{"unscoped", RequireScopes("orders:write")(ok), token.NewAuthenticatedToken(&identity.InMemoryIdentity{}), http.StatusOK},
+		{"granted role", RequireRoles(nil, role.RLAdmin, role.RLUser)(ok), token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserRoles: []role.Role{role.RLUser}}), http.StatusOK},
+		{"missing role", RequireRoles(nil, role.RLAdmin)(ok), token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserRoles: []role.Role{role.RLUser}}), http.StatusForbidden},
+		{"inherited role", RequireRoles(h, role.RLUser)(ok), token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserRoles: []role.Role{role.RLAdmin}}), http.StatusOK},
+		{"anonymous role", RequireRoles(nil, role.RLAnon)(ok), token.NewAnonymousToken(), http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		store, r := token.WithStore(httptest.NewRequest("GET", "/", nil))
+		store.Write(tt.tok)
+
+		w := httptest.NewRecorder()
+		tt.handler.ServeHTTP(w, r)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.expected, w.Code)
+		}
+	}
+}
@@ -6,15 +6,27 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/iwyg/goauth/event"
 	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/metrics"
 	"github.com/iwyg/goauth/security"
 	"github.com/iwyg/goauth/token"
+	"github.com/iwyg/goauth/tracing"
 )
 
+// ErrNoSupportedAuthenticators is returned if no authenticator supports the request,
+// i.e. the request does not attempt to authenticate
+var ErrNoSupportedAuthenticators = errors.New("no supported authenticators")
+
 type authResult struct {
-	Token token.PostAuthToken
-	Err   error
+	Token         token.PostAuthToken
+	Err           error
+	Reason        string
+	Authenticator Authenticator
+	Credentials   interface{}
+	index         int
 }
 
 type credentialFields struct {
@@ -22,6 +34,10 @@ type credentialFields struct {
 	password   []byte
 }
 
+func (c *credentialFields) Username() string {
+	return c.credential
+}
+
 // Authenticator is a type that can extract credential information from a http request,
 // check credentials against an identity and generate an authenticated token
 type Authenticator interface {
@@ -32,6 +48,12 @@ type Authenticator interface {
 	NewAuthenticatedToken(identity identity.Identity) (token.PostAuthToken, error)
 }
 
+// CredentialsTokenAuthenticator is implemented by authenticators whose tokens depend on the
+// extracted credentials, e.g. scopes granted to an api key
+type CredentialsTokenAuthenticator interface {
+	NewCredentialsToken(credentials interface{}, identity identity.Identity) (token.PostAuthToken, error)
+}
+
 // DefaultLoginAuthenticator can extract credential information from request parameters (username / password)
 type DefaultLoginAuthenticator struct {
 	PasswordChecker security.PasswordChecker
@@ -91,7 +113,7 @@ func (a *DefaultLoginAuthenticator) Identity(ctx context.Context, identities ide
 	if !ok {
 		return nil, errors.New("credentials not supported")
 	}
-	return identities.Provide(c.credential)
+	return identity.ProvideContext(ctx, identities, c.credential)
 }
 
 func (a *DefaultLoginAuthenticator) NewAuthenticatedToken(
@@ -118,6 +140,37 @@ type GuardRequestAuthenticator struct {
 	idChecker      identity.IdentityChecker
 	storeProvider  token.StoreProvider
 	authenticators []Authenticator
+	events         event.Dispatcher
+	metrics        metrics.Collector
+	tracer         tracing.Tracer
+}
+
+// SetCollector records login attempts, token verification and identity lookups to c
+func (g *GuardRequestAuthenticator) SetCollector(c metrics.Collector) {
+	g.metrics = c
+	g.idProvider = metrics.InstrumentProvider(g.idProvider, c, "")
+}
+
+// SetDispatcher sets the dispatcher authentication events are sent to. Authenticators
+// run concurrently, so handlers of the check events must be safe for concurrent use.
+func (g *GuardRequestAuthenticator) SetDispatcher(d event.Dispatcher) {
+	g.events = d
+}
+
+// SetTracer traces authentication attempts, identity lookups and credential checks with t
+func (g *GuardRequestAuthenticator) SetTracer(t tracing.Tracer) {
+	g.tracer = t
+}
+
+type checkEvent interface {
+	event.Event
+	Err() error
+}
+
+// check dispatches a check event and returns the error of a handler that rejected it
+func (g *GuardRequestAuthenticator) check(e checkEvent) error {
+	event.Dispatch(g.events, e)
+	return e.Err()
 }
 
 func (g *GuardRequestAuthenticator) aggregateAuthenticators(ctx context.Context, authenticators ...Authenticator) <-chan Authenticator {
@@ -155,59 +208,131 @@ func (g *GuardRequestAuthenticator) doAuthenticateRequest(ctx context.Context, r
 	var id identity.Identity
 	var err error
 
+	res := &authResult{Authenticator: at}
+	fail := func(err error, reason string) *authResult {
+		res.Err = err
+		res.Reason = reason
+		return res
+	}
+
 	c, err = at.Credentials(r)
 	if err != nil {
-		return &authResult{Err: err}
+		return fail(err, ReasonInvalidCredentials)
 	}
 
-	id, err = at.Identity(ctx, g.idProvider, c)
+	res.Credentials = c
+	if err = g.check(event.NewCredentialsExtracted(r, c, at)); err != nil {
+		return fail(err, reason(err, ReasonRejected))
+	}
+
+	lookupCtx, span := tracing.Start(g.tracer, ctx, tracing.SpanIdentityLookup)
+	id, err = at.Identity(lookupCtx, g.idProvider, c)
+	tracing.End(span, err)
 
 	if err != nil {
-		return &authResult{Err: err}
+		return fail(err, ReasonInvalidCredentials)
+	}
+
+	if err = g.check(event.NewIdentityResolved(r, c, id, at)); err != nil {
+		return fail(err, reason(err, ReasonRejected))
 	}
 
 	if err = g.idChecker.CheckPreAuth(id); err != nil {
-		return &authResult{Err: err}
+		return fail(err, reason(err, ReasonAccountUnavailable))
 	}
 
-	if err = at.CheckCredentials(c, id); err != nil {
-		return &authResult{Err: err}
+	if err = g.check(event.NewCheckPassport(r, c, id, at)); err != nil {
+		return fail(err, reason(err, ReasonRejected))
+	}
+
+	_, span = tracing.Start(g.tracer, ctx, tracing.SpanCredentialsCheck)
+	err = at.CheckCredentials(c, id)
+	tracing.End(span, err)
+
+	if err != nil {
+		return fail(err, ReasonInvalidCredentials)
 	}
 
 	if err = g.idChecker.CheckPostAuth(id); err != nil {
-		return &authResult{Err: err}
+		return fail(err, reason(err, ReasonAccountUnavailable))
+	}
+
+	if err = g.check(event.NewPassportChecked(r, c, id, at)); err != nil {
+		return fail(err, reason(err, ReasonRejected))
+	}
+
+	var tok token.PostAuthToken
+	if ct, ok := at.(CredentialsTokenAuthenticator); ok {
+		tok, err = ct.NewCredentialsToken(c, id)
+	} else {
+		tok, err = at.NewAuthenticatedToken(id)
 	}
 
 	if err != nil {
-		return &authResult{Err: err}
+		return fail(err, ReasonInvalidCredentials)
+	}
+
+	created := event.NewTokenCreated(r, tok, id, at)
+	if err = g.check(created); err != nil {
+		return fail(err, reason(err, ReasonRejected))
 	}
 
-	return &authResult{Token: token.NewAuthenticatedToken(id)}
+	tok = created.Token
+	res.Token = tok
 
+	return res
 }
 
-func (g *GuardRequestAuthenticator) authenticateRequest(ctx context.Context, r *http.Request) (token.PostAuthToken, error) {
+// traceAuthenticateRequest runs an authenticator in its own span, the request
+// passed to the authenticator carries the span's context
+func (g *GuardRequestAuthenticator) traceAuthenticateRequest(ctx context.Context, r *http.Request, at Authenticator) *authResult {
+	if g.tracer == nil {
+		return g.doAuthenticateRequest(ctx, r, at)
+	}
+
+	ctx, span := tracing.Start(g.tracer, ctx, tracing.SpanAuthenticator, tracing.String("authenticator", AuthenticatorName(at)))
+	res := g.doAuthenticateRequest(ctx, r.WithContext(ctx), at)
+
+	span.SetAttributes(tracing.Bool("authenticated", res.Token != nil))
+	if res.Err != nil {
+		span.SetAttributes(tracing.String("reason", res.Reason))
+	}
+	tracing.End(span, res.Err)
+
+	return res
+}
+
+func (g *GuardRequestAuthenticator) authenticateRequest(ctx context.Context, r *http.Request) (res *Result, err error) {
 	sa := g.supportedAuthenticators(r)
 
 	if len(sa) == 0 {
-		return nil, errors.New("no supported authenticators")
+		return nil, ErrNoSupportedAuthenticators
 	}
 
+	defer metrics.ObserveSince(g.metrics, metrics.LoginDuration, nil, time.Now())
+
+	ctx, span := tracing.Start(g.tracer, ctx, tracing.SpanAuthenticate, tracing.Int("authenticators", len(sa)))
+	defer func() { tracing.End(span, err) }()
+
 	ch := make(chan *authResult)
 
 	var wg sync.WaitGroup
 
+	var i int
 	for at := range g.aggregateAuthenticators(ctx, sa...) {
 		wg.Add(1)
-		go func(auth Authenticator) {
+		go func(auth Authenticator, index int) {
 			defer wg.Done()
+			res := g.traceAuthenticateRequest(ctx, r, auth)
+			res.index = index
 			select {
-			case ch <- g.doAuthenticateRequest(ctx, r, auth):
+			case ch <- res:
 			case <-ctx.Done():
 				return
 
 			}
-		}(at)
+		}(at, i)
+		i++
 	}
 
 	go func() {
@@ -215,21 +340,53 @@ func (g *GuardRequestAuthenticator) authenticateRequest(ctx context.Context, r *
 		close(ch)
 	}()
 
+	failures := make([]*authResult, len(sa))
+
 	for ret := range ch {
 		if ret.Token != nil {
-			return ret.Token, nil
+			metrics.Count(g.metrics, metrics.LoginAttempts, metrics.Labels{
+				"authenticator": AuthenticatorName(ret.Authenticator), "outcome": metrics.OutcomeSuccess,
+			})
+			event.Dispatch(g.events, event.NewLoginSuccess(r, ret.Token, ret.Authenticator))
+			return &Result{Token: ret.Token, Authenticator: ret.Authenticator}, nil
 		}
+		failures[ret.index] = ret
 	}
 
-	return nil, errors.New("authentication failed")
+	failed := &AuthenticationFailed{Err: errors.New("authentication failed"), Reason: ReasonInvalidCredentials}
+
+	// report the failure of the first configured authenticator
+	for _, f := range failures {
+		if f != nil {
+			failed = &AuthenticationFailed{
+				Err:           f.Err,
+				Reason:        f.Reason,
+				Authenticator: f.Authenticator,
+				Credentials:   f.Credentials,
+			}
+			break
+		}
+	}
+
+	metrics.Count(g.metrics, metrics.LoginAttempts, metrics.Labels{
+		"authenticator": AuthenticatorName(failed.Authenticator), "outcome": metrics.OutcomeFailure,
+	})
+
+	e := event.NewLoginFailure(r, failed.Err, failed.Reason, failed.Username())
+	e.Authenticator = failed.Authenticator
+	event.Dispatch(g.events, e)
+
+	return nil, failed
 }
 
 func (g *GuardRequestAuthenticator) verifyToken(ctx context.Context, t token.PostAuthToken) (token.PostAuthToken, error) {
 	return t, nil
 }
 
-func (g *GuardRequestAuthenticator) Authenticate(r *http.Request) (token.PostAuthToken, error) {
-	ctx, cancel := context.WithCancel(context.Background())
+// AuthenticateRequest authenticates the request and reports which authenticator
+// issued the token. Failures are returned as *AuthenticationFailed.
+func (g *GuardRequestAuthenticator) AuthenticateRequest(r *http.Request) (*Result, error) {
+	ctx, cancel := context.WithCancel(r.Context())
 	defer cancel()
 
 	ts, err := g.storeProvider.Provide(r)
@@ -241,16 +398,56 @@ func (g *GuardRequestAuthenticator) Authenticate(r *http.Request) (token.PostAut
 	foundToken, _ := ts.Read()
 	switch foundToken.(type) {
 	case token.PostAuthToken:
-		return g.verifyToken(ctx, foundToken.(token.PostAuthToken))
+		tok, err := g.verifyToken(ctx, foundToken.(token.PostAuthToken))
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Token: tok}, nil
 	default:
 		return g.authenticateRequest(ctx, r)
 	}
 }
 
+func (g *GuardRequestAuthenticator) Authenticate(r *http.Request) (token.PostAuthToken, error) {
+	res, err := g.AuthenticateRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Token, nil
+}
+
 type RequestAuthenticator interface {
 	Authenticate(r *http.Request) (token.PostAuthToken, error)
 }
 
+// Result is a successful authentication. Authenticator is nil if the request
+// already carried an authenticated token.
+type Result struct {
+	Token         token.PostAuthToken
+	Authenticator Authenticator
+}
+
+// ResultAuthenticator is implemented by request authenticators that report which
+// authenticator handled a request, so its success and failure handlers can respond
+type ResultAuthenticator interface {
+	AuthenticateRequest(r *http.Request) (*Result, error)
+}
+
+// AuthenticateResult authenticates the request, reporting the authenticator if a supports it
+func AuthenticateResult(a RequestAuthenticator, r *http.Request) (*Result, error) {
+	if ra, ok := a.(ResultAuthenticator); ok {
+		return ra.AuthenticateRequest(r)
+	}
+
+	tok, err := a.Authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Token: tok}, nil
+}
+
 func NewGuardRequestAuthenticator(storeProvider token.StoreProvider, auths []Authenticator, idProvider identity.Provider,
 	idChecker identity.IdentityChecker) *GuardRequestAuthenticator {
 
@@ -0,0 +1,235 @@
+package authentication
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iwyg/goauth/event"
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+	"github.com/iwyg/goauth/tracing"
+)
+
+type headerAuthenticator struct{}
+
+func (a *headerAuthenticator) Supports(r *http.Request) bool {
+	return r.Header.Get("X-User") != ""
+}
+
+func (a *headerAuthenticator) Credentials(r *http.Request) (interface{}, error) {
+	return r.Header.Get("X-User"), nil
+}
+
+func (a *headerAuthenticator) CheckCredentials(credentials interface{}, id identity.Identity) error {
+	return nil
+}
+
+func (a *headerAuthenticator) Identity(ctx context.Context, ids identity.Provider, credentials interface{}) (identity.Identity, error) {
+	return &identity.InMemoryIdentity{UserId: credentials, UserCredential: credentials, UserRoles: []role.Role{role.RLUser}}, nil
+}
+
+func (a *headerAuthenticator) NewAuthenticatedToken(id identity.Identity) (token.PostAuthToken, error) {
+	return token.NewAuthenticatedToken(id), nil
+}
+
+func newTestGuard(d event.Dispatcher) *GuardRequestAuthenticator {
+	g := NewGuardRequestAuthenticator(
+		&token.RequestContextStoreProvider{},
+		[]Authenticator{&headerAuthenticator{}},
+		nil,
+		identity.NewBaseIdentityChecker(),
+	)
+	g.SetDispatcher(d)
+
+	return g
+}
+
+func newTestRequest(user string) *http.Request {
+	_, r := token.WithStore(httptest.NewRequest("GET", "/", nil))
+	r.Header.Set("X-User", user)
+
+	return r
+}
+
+func TestGuardEventsVeto(t *testing.T) {
+	d := event.NewEventDispatcher()
+	event.Listen(d, event.IdentityResolvedEvent, func(e *event.IdentityResolved) {
+		switch e.Identity.ID() {
+		case "blocked":
+			e.Fail(NewReasonError("login not allowed"))
+		case "broken":
+			e.Fail(errors.New("lookup failed: connection refused"))
+		}
+	}, 0)
+
+	var failure *event.LoginFailure
+	event.Listen(d, event.LoginFailureEvent, func(e *event.LoginFailure) { failure = e }, 0)
+
+	_, err := newTestGuard(d).Authenticate(newTestRequest("blocked"))
+	af, ok := err.(*AuthenticationFailed)
+	if !ok {
+		t.Fatalf("expected AuthenticationFailed, got %v", err)
+	}
+
+	if af.Reason != "login not allowed" {
+		t.Errorf("expected veto reason, got \"%s\"", af.Reason)
+	}
+
+	if failure == nil || failure.Reason != af.Reason {
+		t.Errorf("expected login failure event with reason \"%s\"", af.Reason)
+	}
+
+	_, err = newTestGuard(d).Authenticate(newTestRequest("broken"))
+	if af, ok := err.(*AuthenticationFailed); !ok || af.Reason != ReasonRejected {
+		t.Errorf("expected internal error to be reported as \"%s\", got %v", ReasonRejected, err)
+	}
+
+	if _, err := newTestGuard(d).Authenticate(newTestRequest("alice")); err != nil {
+		t.Errorf("expected login to succeed, got %v", err)
+	}
+}
+
+func TestGuardEventsEnrichToken(t *testing.T) {
+	d := event.NewEventDispatcher()
+	event.Listen(d, event.TokenCreatedEvent, func(e *event.TokenCreated) {
+		e.Token = token.NewScopedToken(nil, e.Identity, []token.Scope{"read"}, nil)
+	}, 0)
+
+	var success *event.LoginSuccess
+	event.Listen(d, event.LoginSuccessEvent, func(e *event.LoginSuccess) { success = e }, 0)
+
+	tok, err := newTestGuard(d).Authenticate(newTestRequest("alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := tok.(token.ScopedToken); !ok {
+		t.Errorf("expected enriched token, got %T", tok)
+	}
+
+	if success == nil || success.Token != tok {
+		t.Error("expected login success event with the issued token")
+	}
+}
+
+func TestGuardTracing(t *testing.T) {
+	t.Parallel()
+
+	rec := &tracing.Recorder{}
+	g := newTestGuard(nil)
+	g.SetTracer(rec)
+
+	r := newTestRequest("alice")
+	ctx, root := tracing.Start(rec, r.Context(), "request")
+	if _, err := g.Authenticate(r.WithContext(ctx)); err != nil {
+		t.Fatal(err)
+	}
+	root.End()
+
+	parents := map[string]string{
+		tracing.SpanAuthenticate:     "request",
+		tracing.SpanAuthenticator:    tracing.SpanAuthenticate,
+		tracing.SpanIdentityLookup:   tracing.SpanAuthenticator,
+		tracing.SpanCredentialsCheck: tracing.SpanAuthenticator,
+	}
+
+	for name, parent := range parents {
+		spans := rec.Spans(name)
+		if len(spans) != 1 {
+			t.Fatalf("expected one %s span, got %d", name, len(spans))
+		}
+
+		s := spans[0]
+		if s.Parent == nil || s.Parent.Name != parent {
+			t.Errorf("expected %s to be a child of %s", name, parent)
+		}
+
+		if !s.Ended {
+			t.Errorf("expected %s to be ended", name)
+		}
+	}
+
+	if v, _ := rec.Spans(tracing.SpanAuthenticator)[0].Attribute("authenticated"); v != true {
+		t.Error("expected authenticator span to report the authentication")
+	}
+}
+
+type lockedChecker struct{}
+
+func (c *lockedChecker) CheckPreAuth(id identity.Identity) error {
+	if id.ID() == "locked" {
+		return NewReasonError("account is locked")
+	}
+
+	return nil
+}
+
+func (c *lockedChecker) CheckPostAuth(id identity.Identity) error {
+	if id.ID() == "expired" {
+		return errors.New("credentials_expired_at column is null")
+	}
+
+	return nil
+}
+
+func TestGuardIdentityCheckerReasons(t *testing.T) {
+	g := NewGuardRequestAuthenticator(
+		&token.RequestContextStoreProvider{},
+		[]Authenticator{&headerAuthenticator{}},
+		nil,
+		&lockedChecker{},
+	)
+
+	tests := map[string]string{
+		"locked":  "account is locked",
+		"expired": ReasonAccountUnavailable,
+	}
+
+	for user, expected := range tests {
+		_, err := g.Authenticate(newTestRequest(user))
+		af, ok := err.(*AuthenticationFailed)
+		if !ok {
+			t.Fatalf("%s: expected AuthenticationFailed, got %v", user, err)
+		}
+
+		if af.Reason != expected {
+			t.Errorf("%s: expected reason \"%s\", got \"%s\"", user, expected, af.Reason)
+		}
+
+		if af.Err == nil {
+			t.Errorf("%s: expected the underlying error", user)
+		}
+	}
+}
+
+type lookupContextKey struct{}
+
+type contextProvider struct {
+	identity.Provider
+	ctx context.Context
+}
+
+func (p *contextProvider) ProvideContext(ctx context.Context, id interface{}) (identity.Identity, error) {
+	p.ctx = ctx
+	return p.Provide(id)
+}
+
+func TestIdentityLookupUsesContext(t *testing.T) {
+	p := &contextProvider{Provider: identity.NewInMemoryIdentityProvider(map[interface{}]identity.Identity{
+		"alice": &identity.InMemoryIdentity{UserId: 1, UserCredential: "alice"},
+	})}
+	ctx := context.WithValue(context.Background(), lookupContextKey{}, "lookup")
+
+	id, err := (&DefaultLoginAuthenticator{}).Identity(ctx, p, &credentialFields{credential: "alice"})
+	if err != nil || id.Credential() != "alice" {
+		t.Fatalf("expected alice, got %v %v", id, err)
+	}
+
+	if p.ctx == nil || p.ctx.Value(lookupContextKey{}) != "lookup" {
+		t.Error("expected the provider to get the lookup context")
+	}
+}
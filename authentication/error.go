@@ -29,3 +29,110 @@ func NewNotAuthenticatedError(msg string, tok token.Token) *notAuthenticatedErr
 		Tok: tok,
 	}
 }
+
+// AccessDenied is returned when an authenticated token lacks the authority for an action
+type AccessDenied interface {
+	error
+	Token() token.Token
+	IsAccessDenied() bool
+}
+
+type accessDeniedErr struct {
+	Err error
+	Tok token.Token
+}
+
+func (er *accessDeniedErr) Error() string {
+	return er.Err.Error()
+}
+
+func (er *accessDeniedErr) Token() token.Token {
+	return er.Tok
+}
+
+func (er *accessDeniedErr) IsAccessDenied() bool {
+	return true
+}
+
+func NewAccessDeniedError(msg string, tok token.Token) *accessDeniedErr {
+	return &accessDeniedErr{
+		Err: errors.New(msg),
+		Tok: tok,
+	}
+}
+
+// ReasonInvalidCredentials is reported for unknown identities and wrong credentials
+// alike, so failures do not reveal which identities exist
+const ReasonInvalidCredentials = "invalid credentials"
+
+// ReasonAccountUnavailable is reported if an identity checker rejects the identity
+const ReasonAccountUnavailable = "account is not available"
+
+// ReasonRejected is reported if an event handler rejects the attempt without a
+// ReasonError
+const ReasonRejected = "authentication rejected"
+
+// ReasonError is an error whose Reason may be shown to the user. Identity checkers
+// and event handlers return it to report more than the generic reasons.
+type ReasonError struct {
+	Reason string
+	Err    error
+}
+
+func (e *ReasonError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+
+	return e.Reason
+}
+
+func (e *ReasonError) Unwrap() error {
+	return e.Err
+}
+
+// NewReasonError creates an error that is reported to the user with reason
+func NewReasonError(reason string) *ReasonError {
+	return &ReasonError{Reason: reason}
+}
+
+// reason returns the reason of a ReasonError in err's chain, or fallback, so
+// internal error messages never reach the user
+func reason(err error, fallback string) string {
+	for err != nil {
+		if re, ok := err.(*ReasonError); ok && re.Reason != "" {
+			return re.Reason
+		}
+
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = u.Unwrap()
+	}
+
+	return fallback
+}
+
+// AuthenticationFailed is returned if all authenticators supporting a request failed.
+// Reason is safe to show to the user, Err is the underlying error.
+type AuthenticationFailed struct {
+	Err           error
+	Reason        string
+	Authenticator Authenticator
+	Credentials   interface{}
+}
+
+func (e *AuthenticationFailed) Error() string {
+	return e.Err.Error()
+}
+
+// Username returns the credential the user tried to log in with, if the
+// credentials expose it
+func (e *AuthenticationFailed) Username() string {
+	if c, ok := e.Credentials.(interface{ Username() string }); ok {
+		return c.Username()
+	}
+
+	return ""
+}
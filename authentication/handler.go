@@ -0,0 +1,176 @@
+package authentication
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/session"
+	"github.com/iwyg/goauth/token"
+)
+
+const (
+	LastErrorFlash    = "_security.last_error"
+	LastUsernameFlash = "_security.last_username"
+)
+
+// AuthenticationSuccessHandler responds to a request that was authenticated
+type AuthenticationSuccessHandler interface {
+	OnAuthenticationSuccess(w http.ResponseWriter, r *http.Request, tok token.Token)
+}
+
+// AuthenticationFailureHandler responds to a failed authentication attempt
+type AuthenticationFailureHandler interface {
+	OnAuthenticationFailure(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// HandlerAwareAuthenticator is implemented by authenticators that respond to their
+// own results. A nil success handler lets the request continue, e.g. for api keys.
+type HandlerAwareAuthenticator interface {
+	Authenticator
+	SuccessHandler() AuthenticationSuccessHandler
+	FailureHandler() AuthenticationFailureHandler
+}
+
+type handlerAuthenticator struct {
+	Authenticator
+	success AuthenticationSuccessHandler
+	failure AuthenticationFailureHandler
+}
+
+// Unwrap returns the configured authenticator
+func (a *handlerAuthenticator) Unwrap() Authenticator {
+	return a.Authenticator
+}
+
+func (a *handlerAuthenticator) SuccessHandler() AuthenticationSuccessHandler {
+	return a.success
+}
+
+func (a *handlerAuthenticator) FailureHandler() AuthenticationFailureHandler {
+	return a.failure
+}
+
+func (a *handlerAuthenticator) NewCredentialsToken(credentials interface{}, id identity.Identity) (token.PostAuthToken, error) {
+	if ct, ok := a.Authenticator.(CredentialsTokenAuthenticator); ok {
+		return ct.NewCredentialsToken(credentials, id)
+	}
+
+	return a.Authenticator.NewAuthenticatedToken(id)
+}
+
+// AuthenticatorName returns the type of an authenticator, unwrapping decorators
+// like WithHandlers
+func AuthenticatorName(a interface{}) string {
+	if a == nil {
+		return ""
+	}
+
+	for {
+		u, ok := a.(interface{ Unwrap() Authenticator })
+		if !ok {
+			break
+		}
+		a = u.Unwrap()
+	}
+
+	return fmt.Sprintf("%T", a)
+}
+
+// WithHandlers configures the success and failure handlers of an authenticator
+func WithHandlers(a Authenticator, success AuthenticationSuccessHandler, failure AuthenticationFailureHandler) HandlerAwareAuthenticator {
+	return &handlerAuthenticator{Authenticator: a, success: success, failure: failure}
+}
+
+// SuccessHandlerFor returns the handler responding to a result, or nil
+func SuccessHandlerFor(res *Result) AuthenticationSuccessHandler {
+	if ha, ok := res.Authenticator.(HandlerAwareAuthenticator); ok {
+		return ha.SuccessHandler()
+	}
+
+	return nil
+}
+
+// FailureHandlerFor returns the handler responding to an authentication error, or nil
+func FailureHandlerFor(err error) AuthenticationFailureHandler {
+	if af, ok := err.(*AuthenticationFailed); ok {
+		if ha, ok := af.Authenticator.(HandlerAwareAuthenticator); ok {
+			return ha.FailureHandler()
+		}
+	}
+
+	return nil
+}
+
+// FailureReason returns the reason of an authentication error that is safe to
+// show to the user
+func FailureReason(err error) string {
+	if af, ok := err.(*AuthenticationFailed); ok {
+		return af.Reason
+	}
+
+	return ReasonInvalidCredentials
+}
+
+// FormLoginSuccessHandler stores the token in the session and redirects to the
+// target path. Session.TokenKey may be empty if the token is persisted elsewhere,
+// e.g. by a firewall.
+type FormLoginSuccessHandler struct {
+	TargetPathRedirect
+}
+
+func (h *FormLoginSuccessHandler) OnAuthenticationSuccess(w http.ResponseWriter, r *http.Request, tok token.Token) {
+	if s := h.session(r); s != nil && h.Session.TokenKey != "" {
+		if saveToken, err := session.GetSessionToken(tok); err == nil {
+			s.SetValue(h.Session.TokenKey, saveToken)
+			session.Migrate(h.Sessions, w, r, s, h.Session.Events)
+		}
+	}
+
+	h.Redirect(w, r)
+}
+
+// FormLoginFailureHandler redirects back to the login form. The failure reason and
+// the last username are available as session flashes LastErrorFlash and LastUsernameFlash.
+type FormLoginFailureHandler struct {
+	FailurePath string
+	Session     session.Config
+	Sessions    session.Provider
+}
+
+func (h *FormLoginFailureHandler) OnAuthenticationFailure(w http.ResponseWriter, r *http.Request, err error) {
+	if s, serr := h.Sessions.Provide(r, h.Session.Name); serr == nil {
+		session.SetFlash(s, LastErrorFlash, FailureReason(err))
+		if af, ok := err.(*AuthenticationFailed); ok {
+			session.SetFlash(s, LastUsernameFlash, af.Username())
+		}
+		h.Sessions.Save(w, r, s)
+	}
+
+	http.Redirect(w, r, h.FailurePath, http.StatusFound)
+}
+
+type JSONSuccessHandler struct{}
+
+func (h *JSONSuccessHandler) OnAuthenticationSuccess(w http.ResponseWriter, r *http.Request, tok token.Token) {
+	body := map[string]interface{}{"status": "authenticated"}
+	if it, ok := tok.(token.IdentityToken); ok && it.Identity() != nil {
+		body["id"] = it.Identity().ID()
+		body["roles"] = tok.Roles()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+type JSONFailureHandler struct{}
+
+func (h *JSONFailureHandler) OnAuthenticationFailure(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "failed",
+		"error":  FailureReason(err),
+	})
+}
@@ -0,0 +1,159 @@
+package authentication
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iwyg/goauth/token"
+)
+
+type usernameCredentials string
+
+func (c usernameCredentials) Username() string {
+	return string(c)
+}
+
+func TestAuthenticationFailed(t *testing.T) {
+	af := &AuthenticationFailed{
+		Err:         errors.New("select failed: connection refused"),
+		Reason:      ReasonInvalidCredentials,
+		Credentials: usernameCredentials("alice"),
+	}
+
+	if af.Error() != "select failed: connection refused" {
+		t.Errorf("expected the underlying error, got \"%s\"", af.Error())
+	}
+
+	if af.Username() != "alice" {
+		t.Errorf("expected username alice, got \"%s\"", af.Username())
+	}
+
+	if (&AuthenticationFailed{Err: af.Err, Credentials: "token"}).Username() != "" {
+		t.Error("expected no username for credentials without one")
+	}
+
+	if FailureReason(af) != ReasonInvalidCredentials {
+		t.Errorf("expected reason \"%s\", got \"%s\"", ReasonInvalidCredentials, FailureReason(af))
+	}
+
+	if FailureReason(errors.New("internal")) != ReasonInvalidCredentials {
+		t.Error("expected other errors to report invalid credentials")
+	}
+}
+
+func TestJSONHandlers(t *testing.T) {
+	rec := httptest.NewRecorder()
+	(&JSONFailureHandler{}).OnAuthenticationFailure(rec, httptest.NewRequest("POST", "/login", nil), &AuthenticationFailed{
+		Err:    errors.New("internal"),
+		Reason: ReasonAccountUnavailable,
+	})
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", rec.Code)
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body["error"] != ReasonAccountUnavailable {
+		t.Errorf("expected reason in body, got %v", body["error"])
+	}
+
+	rec = httptest.NewRecorder()
+	r := newTestRequest("alice")
+	tok, err := newTestGuard(nil).Authenticate(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	(&JSONSuccessHandler{}).OnAuthenticationSuccess(rec, r, tok)
+
+	body = nil
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body["status"] != "authenticated" || body["id"] != "alice" {
+		t.Errorf("unexpected body %v", body)
+	}
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected json content type, got \"%s\"", ct)
+	}
+}
+
+func TestAuthenticationHandlerMiddleware(t *testing.T) {
+	var successes, failures int
+	success := successFunc(func(w http.ResponseWriter, r *http.Request, tok token.Token) {
+		successes++
+		w.WriteHeader(http.StatusNoContent)
+	})
+	failure := failureFunc(func(w http.ResponseWriter, r *http.Request, err error) {
+		failures++
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	newHandler := func(a Authenticator) http.Handler {
+		g := NewGuardRequestAuthenticator(&token.RequestContextStoreProvider{}, []Authenticator{a}, nil, &lockedChecker{})
+		return NewAuthenticationHandlerMiddleware(g)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+	}
+
+	tests := []struct {
+		name     string
+		a        Authenticator
+		user     string
+		code     int
+		contains string
+	}{
+		{"no credentials pass", WithHandlers(&headerAuthenticator{}, success, failure), "", http.StatusOK, ""},
+		{"success handler responds", WithHandlers(&headerAuthenticator{}, success, failure), "alice", http.StatusNoContent, ""},
+		{"nil success handler continues", WithHandlers(&headerAuthenticator{}, nil, failure), "alice", http.StatusOK, ""},
+		{"failure handler responds", WithHandlers(&headerAuthenticator{}, success, failure), "expired", http.StatusTeapot, ""},
+		{"default failure hides internal errors", &headerAuthenticator{}, "expired", http.StatusUnauthorized, ReasonAccountUnavailable},
+	}
+
+	for _, test := range tests {
+		_, r := token.WithStore(httptest.NewRequest("GET", "/", nil))
+		if test.user != "" {
+			r.Header.Set("X-User", test.user)
+		}
+
+		rec := httptest.NewRecorder()
+		newHandler(test.a).ServeHTTP(rec, r)
+
+		if rec.Code != test.code {
+			t.Errorf("%s: expected %d, got %d", test.name, test.code, rec.Code)
+		}
+
+		if !strings.Contains(rec.Body.String(), test.contains) {
+			t.Errorf("%s: expected body to contain \"%s\", got \"%s\"", test.name, test.contains, rec.Body.String())
+		}
+
+		if strings.Contains(rec.Body.String(), "credentials_expired_at") {
+			t.Errorf("%s: internal error leaked to the response", test.name)
+		}
+	}
+
+	if successes != 1 || failures != 1 {
+		t.Errorf("expected one success and one failure handler call, got %d and %d", successes, failures)
+	}
+}
+
+type successFunc func(w http.ResponseWriter, r *http.Request, tok token.Token)
+
+func (f successFunc) OnAuthenticationSuccess(w http.ResponseWriter, r *http.Request, tok token.Token) {
+	f(w, r, tok)
+}
+
+type failureFunc func(w http.ResponseWriter, r *http.Request, err error)
+
+func (f failureFunc) OnAuthenticationFailure(w http.ResponseWriter, r *http.Request, err error) {
+	f(w, r, err)
+}
@@ -1,13 +1,18 @@
 package authentication
 
 import (
-	"github.com/iwyg/goauth/token"
-	"log"
+	"log/slog"
 	"net/http"
+
+	"github.com/iwyg/goauth/logging"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/session"
+	"github.com/iwyg/goauth/token"
 )
 
 type authenticationHandler struct {
 	authenticator RequestAuthenticator
+	logger        *slog.Logger
 }
 
 func (a *authenticationHandler) needsAuthentication(w http.ResponseWriter, r *http.Request) {
@@ -27,94 +32,116 @@ func (a *authenticationHandler) postAuthToken(t token.IdentityToken) token.PostA
 	return token.NewAuthenticatedToken(t.Identity())
 }
 
-func (a *authenticationHandler) doAuthenticate(r *http.Request) error {
+func (a *authenticationHandler) failed(w http.ResponseWriter, r *http.Request, err error) {
+	attrs := []interface{}{"path", r.URL.Path, "reason", FailureReason(err)}
+	if af, ok := err.(*AuthenticationFailed); ok {
+		attrs = append(attrs, "username", af.Username(), "authenticator", AuthenticatorName(af.Authenticator))
+	}
+	a.logger.Info("authentication failed", attrs...)
+
+	if h := FailureHandlerFor(err); h != nil {
+		h.OnAuthenticationFailure(w, r, err)
+		return
+	}
+
+	http.Error(w, FailureReason(err), http.StatusUnauthorized)
+}
+
+func (a *authenticationHandler) doAuthenticate(r *http.Request) (*Result, error) {
 	ts, err := token.TokenStoreFromRequest(r)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	tok, err := a.authenticator.Authenticate(r)
+	res, err := AuthenticateResult(a.authenticator, r)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	ts.Clear()
-	return ts.Write(tok)
+	return res, ts.Write(res.Token)
 }
 
+// NewAuthenticationHandlerMiddleware authenticates requests that carry credentials.
+// Requests without credentials pass, failures and successes are answered by the
+// handlers of the authenticator (see WithHandlers) or with 401 on failure.
 func NewAuthenticationHandlerMiddleware(
 	authenticator RequestAuthenticator,
+	opts ...logging.Option,
 ) func(http.Handler) http.Handler {
 	a := &authenticationHandler{
 		authenticator: authenticator,
+		logger:        logging.New(opts...),
 	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			a.doAuthenticate(r)
-			next.ServeHTTP(w, r)
-		})
-	}
-}
+			res, err := a.doAuthenticate(r)
 
-func NewLogoutHandler(path string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			store, err := token.TokenStoreFromRequest(r)
-			if err != nil {
+			switch err {
+			case nil:
+				if res.Authenticator != nil {
+					a.logger.Info("authenticated", "path", r.URL.Path, "authenticator", AuthenticatorName(res.Authenticator))
+				}
+				if h := SuccessHandlerFor(res); h != nil {
+					h.OnAuthenticationSuccess(w, r, res.Token)
+					return
+				}
+			case ErrNoSupportedAuthenticators:
+			default:
+				a.failed(w, r, err)
 				return
 			}
 
-			tok, err := store.Read()
-
-			log.Printf("logout at  %s <-> %s\n", path, r.URL.Path)
-			if path == r.URL.Path && err == nil && tok.IsFullyAuthenticated() {
-				log.Printf("logout\n")
-				store.Clear()
-			}
-
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// NewLogoutHandler logs out POST requests to path and redirects to "/", use
+// NewLogoutMiddleware to configure the logout
+func NewLogoutHandler(path string, opts ...logging.Option) func(http.Handler) http.Handler {
+	return NewLogoutMiddleware(&LogoutConfig{Path: path}, opts...)
+}
+
 //NewRedirectLoggedIn handle redirects of logged in users from the login url
-func NewRedirectLoggedIn(path string) func(http.Handler) http.Handler {
+func NewRedirectLoggedIn(path string, opts ...logging.Option) func(http.Handler) http.Handler {
+	return NewTargetPathRedirectLoggedIn(path, &TargetPathRedirect{AlwaysUseDefault: true}, opts...)
+}
+
+// NewTargetPathRedirectLoggedIn redirects logged in users from the login url to
+// the page they requested before logging in
+func NewTargetPathRedirectLoggedIn(path string, target *TargetPathRedirect, opts ...logging.Option) func(http.Handler) http.Handler {
+	l := logging.New(opts...)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if r.URL.Path != path {
 				next.ServeHTTP(w, r)
 				return
 			}
-			if !func(w http.ResponseWriter, r *http.Request) bool {
-				s, err := token.TokenStoreFromRequest(r)
-				if err != nil {
-					return false
-				}
-
-				tok, err := s.Read()
-
-				if err != nil {
-					return false
-				}
 
-				if !tok.IsFullyAuthenticated() {
-					return false
-				}
-
-				return true
-			}(w, r) {
+			if _, ok := authenticatedToken(r); !ok {
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			l.Debug("redirect logged in user", "path", path)
+			target.Redirect(w, r)
 		})
 	}
 }
 
-func NewLoginRedirectHandler(path string) func(http.Handler) http.Handler {
+func NewLoginRedirectHandler(path string, opts ...logging.Option) func(http.Handler) http.Handler {
+	return NewTargetPathLoginRedirectHandler(path, "", session.Config{}, nil, opts...)
+}
+
+// NewTargetPathLoginRedirectHandler redirects unauthenticated users to the login
+// and stores the requested path in the session
+func NewTargetPathLoginRedirectHandler(path string, firewall string, conf session.Config, sp session.Provider, opts ...logging.Option) func(http.Handler) http.Handler {
+	l := logging.New(opts...)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			store, err := token.TokenStoreFromRequest(r)
@@ -123,7 +150,15 @@ func NewLoginRedirectHandler(path string) func(http.Handler) http.Handler {
 			}
 			tok, err := store.Read()
 			if err != nil || !tok.IsFullyAuthenticated() {
-				log.Printf("token %#v\n", tok)
+				l.Debug("redirect to login", "path", r.URL.Path, "login", path)
+
+				if sp != nil && r.Method == http.MethodGet {
+					if s, err := sp.Provide(r, conf.Name); err == nil {
+						session.SetTargetPath(s, firewall, r.URL.RequestURI())
+						sp.Save(w, r, s)
+					}
+				}
+
 				http.Redirect(w, r, path, http.StatusTemporaryRedirect)
 				return
 			}
@@ -132,3 +167,63 @@ func NewLoginRedirectHandler(path string) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+func authenticatedToken(r *http.Request) (token.Token, bool) {
+	store, err := token.TokenStoreFromRequest(r)
+	if err != nil {
+		return nil, false
+	}
+
+	tok, err := store.Read()
+	if err != nil || !tok.IsFullyAuthenticated() {
+		return nil, false
+	}
+
+	return tok, true
+}
+
+// RequireScopes denies access unless the token was granted all given scopes.
+// Tokens without scope restriction pass, so combine it with RequireRoles to check authority.
+func RequireScopes(scopes ...token.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tok, ok := authenticatedToken(r)
+			if !ok {
+				http.Error(w, "need authentication", http.StatusUnauthorized)
+				return
+			}
+
+			if !token.HasScopes(tok, scopes...) {
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRoles denies access unless the token has or reaches in h at least one of
+// the given roles
+func RequireRoles(h role.Hierarchy, roles ...role.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tok, ok := authenticatedToken(r)
+			if !ok {
+				http.Error(w, "need authentication", http.StatusUnauthorized)
+				return
+			}
+
+			for _, have := range role.Reachable(h, tok.Roles()) {
+				for _, want := range roles {
+					if have == want {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		})
+	}
+}
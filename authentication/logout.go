@@ -0,0 +1,300 @@
+package authentication
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/iwyg/goauth/event"
+	httpUtil "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/logging"
+	"github.com/iwyg/goauth/session"
+	"github.com/iwyg/goauth/token"
+)
+
+const (
+	DefaultLogoutCSRFTokenID  = "logout"
+	DefaultRememberMeCookie   = "REMEMBERME"
+	DefaultLogoutRedirectPath = "/"
+)
+
+// LogoutHandler cleans up after a user logged out. tok is nil if the request
+// was not authenticated.
+type LogoutHandler interface {
+	Logout(w http.ResponseWriter, r *http.Request, tok token.Token) error
+}
+
+type LogoutHandlerFunc func(w http.ResponseWriter, r *http.Request, tok token.Token) error
+
+func (f LogoutHandlerFunc) Logout(w http.ResponseWriter, r *http.Request, tok token.Token) error {
+	return f(w, r, tok)
+}
+
+// LogoutSuccessHandler responds to a completed logout
+type LogoutSuccessHandler interface {
+	OnLogoutSuccess(w http.ResponseWriter, r *http.Request)
+}
+
+// LogoutListener is notified after a user logged out
+type LogoutListener func(r *http.Request, tok token.Token)
+
+// SessionLogoutHandler removes the token from the session and expires it
+type SessionLogoutHandler struct {
+	Session  session.Config
+	Sessions session.Provider
+}
+
+func (h *SessionLogoutHandler) Logout(w http.ResponseWriter, r *http.Request, tok token.Token) error {
+	s, err := h.Sessions.Provide(r, h.Session.Name)
+	if err != nil {
+		return nil
+	}
+
+	if h.Session.TokenKey != "" {
+		s.RemoveValue(h.Session.TokenKey)
+	}
+	s.Expire()
+
+	return h.Sessions.Save(w, r, s)
+}
+
+// CookieClearingLogoutHandler expires the given cookies
+type CookieClearingLogoutHandler struct {
+	Cookies []string
+	Path    string
+	Domain  string
+}
+
+func (h *CookieClearingLogoutHandler) Logout(w http.ResponseWriter, r *http.Request, tok token.Token) error {
+	path := h.Path
+	if path == "" {
+		path = "/"
+	}
+
+	for _, name := range h.Cookies {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     path,
+			Domain:   h.Domain,
+			MaxAge:   -1,
+			HttpOnly: true,
+		})
+	}
+
+	return nil
+}
+
+// NewRememberMeLogoutHandler removes the remember-me cookie, DefaultRememberMeCookie if name is empty
+func NewRememberMeLogoutHandler(name string) *CookieClearingLogoutHandler {
+	if name == "" {
+		name = DefaultRememberMeCookie
+	}
+
+	return &CookieClearingLogoutHandler{Cookies: []string{name}}
+}
+
+// TokenRevoker invalidates a token so it can no longer be used, e.g. a persistent
+// remember-me token or an api key issued to the user
+type TokenRevoker interface {
+	Revoke(tok token.Token) error
+}
+
+// TokenRevocationLogoutHandler revokes the token of the user and dispatches a
+// TokenRevoked event to Events
+type TokenRevocationLogoutHandler struct {
+	Revoker TokenRevoker
+	Events  event.Dispatcher
+}
+
+func (h *TokenRevocationLogoutHandler) Logout(w http.ResponseWriter, r *http.Request, tok token.Token) error {
+	if tok == nil {
+		return nil
+	}
+
+	if err := h.Revoker.Revoke(tok); err != nil {
+		return err
+	}
+
+	event.Dispatch(h.Events, event.NewTokenRevoked(r, tok))
+
+	return nil
+}
+
+// RedirectLogoutSuccessHandler redirects to Target, DefaultLogoutRedirectPath if empty
+type RedirectLogoutSuccessHandler struct {
+	Target string
+}
+
+func (h *RedirectLogoutSuccessHandler) OnLogoutSuccess(w http.ResponseWriter, r *http.Request) {
+	target := h.Target
+	if target == "" {
+		target = DefaultLogoutRedirectPath
+	}
+
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+type JSONLogoutSuccessHandler struct{}
+
+func (h *JSONLogoutSuccessHandler) OnLogoutSuccess(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "logged out"})
+}
+
+// LogoutConfig configures the logout at Path. Only POST requests log out unless
+// Methods is set. Setting CSRFParameter requires a valid csrf token (see
+// session.CSRFToken) with the id CSRFTokenID in that form field, which needs Sessions.
+// A Logout event is dispatched to Events after the handlers ran. Logger logs the
+// logouts served by ServeHTTP, e.g. by a firewall, it defaults to slog.Default().
+// NewLogoutMiddleware logs with its options.
+type LogoutConfig struct {
+	Path          string
+	Methods       []string
+	CSRFParameter string
+	CSRFTokenID   string
+	Session       session.Config
+	Sessions      session.Provider
+	Handlers      []LogoutHandler
+	Success       LogoutSuccessHandler
+	Listeners     []LogoutListener
+	Events        event.Dispatcher
+	Logger        *slog.Logger
+}
+
+// Matches reports if the request is sent to the logout path
+func (c *LogoutConfig) Matches(r *http.Request) bool {
+	return r.URL.Path == c.Path
+}
+
+func (c *LogoutConfig) methods() []string {
+	if len(c.Methods) == 0 {
+		return []string{http.MethodPost}
+	}
+
+	return c.Methods
+}
+
+func (c *LogoutConfig) allowsMethod(r *http.Request) bool {
+	return allowsMethod(c.methods(), r)
+}
+
+func allowsMethod(methods []string, r *http.Request) bool {
+	for _, m := range methods {
+		if strings.EqualFold(m, r.Method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *LogoutConfig) csrfTokenID() string {
+	if c.CSRFTokenID == "" {
+		return DefaultLogoutCSRFTokenID
+	}
+
+	return c.CSRFTokenID
+}
+
+func (c *LogoutConfig) checkCSRFToken(r *http.Request) bool {
+	if c.CSRFParameter == "" {
+		return true
+	}
+
+	return checkCSRFToken(r, c.Session, c.Sessions, c.csrfTokenID(), c.CSRFParameter)
+}
+
+// checkCSRFToken validates the token with the given id sent in the form field parameter
+func checkCSRFToken(r *http.Request, conf session.Config, sp session.Provider, id string, parameter string) bool {
+	if sp == nil {
+		return false
+	}
+
+	s, err := sp.Provide(r, conf.Name)
+	if err != nil {
+		return false
+	}
+
+	return session.IsCSRFTokenValid(s, id, r.FormValue(parameter))
+}
+
+func (c *LogoutConfig) success() LogoutSuccessHandler {
+	if c.Success == nil {
+		return &RedirectLogoutSuccessHandler{}
+	}
+
+	return c.Success
+}
+
+// ServeHTTP logs out the user of the request. Errors are reported with httpUtil.Fail.
+func (c *LogoutConfig) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.serve(w, r, logging.New(logging.WithLogger(c.Logger)))
+}
+
+func (c *LogoutConfig) serve(w http.ResponseWriter, r *http.Request, l *slog.Logger) {
+	if !c.allowsMethod(r) {
+		w.Header().Set("Allow", strings.Join(c.methods(), ", "))
+		httpUtil.Fail(w, r, &httpUtil.StatusError{
+			Code: http.StatusMethodNotAllowed,
+			Err:  errors.New(http.StatusText(http.StatusMethodNotAllowed)),
+		})
+		return
+	}
+
+	if !c.checkCSRFToken(r) {
+		l.Warn("logout with invalid csrf token", "path", r.URL.Path)
+		httpUtil.Fail(w, r, &httpUtil.StatusError{Code: http.StatusForbidden, Err: errors.New("invalid csrf token")})
+		return
+	}
+
+	store, err := token.TokenStoreFromRequest(r)
+	if err != nil {
+		httpUtil.Fail(w, r, err)
+		return
+	}
+
+	tok, _ := store.Read()
+	store.Clear()
+
+	var handlerErr error
+	for _, h := range c.Handlers {
+		// all handlers run, so a failing one does not leave a half logged out user
+		if err := h.Logout(w, r, tok); err != nil && handlerErr == nil {
+			handlerErr = err
+		}
+	}
+
+	if handlerErr != nil {
+		l.Error("logout failed", "path", r.URL.Path, "error", handlerErr)
+		httpUtil.Fail(w, r, handlerErr)
+		return
+	}
+
+	for _, listener := range c.Listeners {
+		listener(r, tok)
+	}
+
+	event.Dispatch(c.Events, event.NewLogout(r, tok))
+	l.Info("logged out", "path", r.URL.Path, "token", tok)
+
+	c.success().OnLogoutSuccess(w, r)
+}
+
+// NewLogoutMiddleware answers requests to the logout path
+func NewLogoutMiddleware(conf *LogoutConfig, opts ...logging.Option) func(http.Handler) http.Handler {
+	l := logging.New(opts...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !conf.Matches(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			conf.serve(w, r, l)
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package authentication
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/iwyg/goauth/event"
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/logging"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/session"
+	"github.com/iwyg/goauth/token"
+)
+
+const (
+	DefaultSwitchUserParameter   = "_switch_user"
+	DefaultSwitchUserExitValue   = "_exit"
+	DefaultSwitchUserCSRFTokenID = "switch_user"
+)
+
+// switchUserDenied is the response to every denied switch, the reason is only
+// logged so responses do not reveal which identities exist or what roles they have
+const switchUserDenied = "cannot switch user"
+
+// SwitchUserConfig configures impersonation. The target credential is read from
+// Parameter (query or form), ExitValue restores the original token. If Path is set,
+// switching is only possible on that endpoint. The handler must run before the
+// session writer so the impersonation token is persisted.
+//
+// Switching changes the user of the session, so only POST requests switch unless
+// Methods is set. Setting CSRFParameter requires a valid csrf token with the id
+// CSRFTokenID in that form field, like LogoutConfig. Provider is required. Roles
+// of both identities are resolved against Hierarchy.
+type SwitchUserConfig struct {
+	Path          string
+	Parameter     string
+	ExitValue     string
+	Role          role.Role
+	Methods       []string
+	CSRFParameter string
+	CSRFTokenID   string
+	Session       session.Config
+	Sessions      session.Provider
+	Provider      identity.Provider
+	Events        event.Dispatcher
+	Hierarchy     role.Hierarchy
+}
+
+func (c *SwitchUserConfig) defaults() {
+	if c.Parameter == "" {
+		c.Parameter = DefaultSwitchUserParameter
+	}
+
+	if c.ExitValue == "" {
+		c.ExitValue = DefaultSwitchUserExitValue
+	}
+
+	if c.Role == "" {
+		c.Role = role.RLAllowedToSwitch
+	}
+
+	if len(c.Methods) == 0 {
+		c.Methods = []string{http.MethodPost}
+	}
+
+	if c.CSRFTokenID == "" {
+		c.CSRFTokenID = DefaultSwitchUserCSRFTokenID
+	}
+}
+
+// SwitchUser creates an impersonation token for the identity identified by target.
+// It returns an AccessDenied error if tok may not impersonate or if the target has
+// roles tok does not have, so impersonation never escalates privileges.
+func SwitchUser(conf SwitchUserConfig, tok token.Token, target interface{}) (*token.SwitchUserToken, error) {
+	conf.defaults()
+
+	if conf.Provider == nil {
+		return nil, errors.New("switch user requires an identity provider")
+	}
+
+	original, ok := tok.(token.IdentityToken)
+	if !ok || !tok.IsFullyAuthenticated() {
+		return nil, NewNotAuthenticatedError("need authentication", tok)
+	}
+
+	if _, switched := tok.(*token.SwitchUserToken); switched {
+		return nil, NewAccessDeniedError("already impersonating an identity", tok)
+	}
+
+	reachable := role.Reachable(conf.Hierarchy, tok.Roles())
+	if !hasRole(reachable, conf.Role) {
+		return nil, NewAccessDeniedError(fmt.Sprintf("switching user requires %s", conf.Role), tok)
+	}
+
+	id, err := conf.Provider.Provide(target)
+	if err != nil {
+		return nil, NewAccessDeniedError(fmt.Sprintf("cannot switch to \"%v\"", target), tok)
+	}
+
+	for _, r := range role.Reachable(conf.Hierarchy, id.Roles()) {
+		if !hasRole(reachable, r) {
+			return nil, NewAccessDeniedError(fmt.Sprintf("cannot switch to \"%v\", it has %s", target, r), tok)
+		}
+	}
+
+	return token.NewSwitchUserToken(id, original), nil
+}
+
+// ExitSwitchUser returns the impersonator's token
+func ExitSwitchUser(tok token.Token) (token.IdentityToken, error) {
+	st, ok := tok.(*token.SwitchUserToken)
+	if !ok {
+		return nil, NewAccessDeniedError("not impersonating an identity", tok)
+	}
+
+	return st.Original(), nil
+}
+
+func hasRole(roles []role.Role, r role.Role) bool {
+	for _, have := range roles {
+		if have == r {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewSwitchUserHandler switches the user of requests with the switch parameter,
+// it panics if conf has no Provider
+func NewSwitchUserHandler(conf SwitchUserConfig, opts ...logging.Option) func(http.Handler) http.Handler {
+	if conf.Provider == nil {
+		panic("authentication: switch user requires an identity provider")
+	}
+
+	conf.defaults()
+	l := logging.New(opts...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if conf.Path != "" && conf.Path != r.URL.Path {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			target := r.FormValue(conf.Parameter)
+			if target == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !allowsMethod(conf.Methods, r) {
+				w.Header().Set("Allow", strings.Join(conf.Methods, ", "))
+				http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+				return
+			}
+
+			if conf.CSRFParameter != "" && !checkCSRFToken(r, conf.Session, conf.Sessions, conf.CSRFTokenID, conf.CSRFParameter) {
+				l.Warn("switch user with invalid csrf token", "target", target)
+				http.Error(w, "invalid csrf token", http.StatusForbidden)
+				return
+			}
+
+			store, err := token.TokenStoreFromRequest(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			tok, _ := store.Read()
+
+			var switched token.Token
+			if target == conf.ExitValue {
+				switched, err = ExitSwitchUser(tok)
+			} else {
+				switched, err = SwitchUser(conf, tok, target)
+			}
+
+			switch err.(type) {
+			case nil:
+				l.Info("switch user", "target", target, "exit", target == conf.ExitValue)
+			case AccessDenied:
+				l.Warn("switch user denied", "target", target, "reason", err.Error())
+				http.Error(w, switchUserDenied, http.StatusForbidden)
+				return
+			default:
+				http.Error(w, "need authentication", http.StatusUnauthorized)
+				return
+			}
+
+			var targetID identity.Identity
+			if it, ok := switched.(token.IdentityToken); ok {
+				targetID = it.Identity()
+			}
+			event.Dispatch(conf.Events, event.NewSwitchUser(r, switched, targetID, target == conf.ExitValue))
+
+			store.Write(switched)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package authentication
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+)
+
+func newSwitchUserConfig() SwitchUserConfig {
+	return SwitchUserConfig{Provider: identity.NewInMemoryIdentityProvider(map[interface{}]identity.Identity{
+		"bob":   &identity.InMemoryIdentity{UserId: 2, UserCredential: "bob", UserRoles: []role.Role{role.RLUser}},
+		"carol": &identity.InMemoryIdentity{UserId: 3, UserCredential: "carol", UserRoles: []role.Role{role.RLAdmin}},
+	})}
+}
+
+func newSwitcherToken(roles ...role.Role) *token.AuthenticatedToken {
+	return token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserId: 1, UserCredential: "alice", UserRoles: roles})
+}
+
+func serveSwitchUser(conf SwitchUserConfig, method string, target string, tok token.Token) (*httptest.ResponseRecorder, token.Token) {
+	store, r := token.WithStore(httptest.NewRequest(method, "/?_switch_user="+target, nil))
+	store.Write(tok)
+
+	w := httptest.NewRecorder()
+	NewSwitchUserHandler(conf)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+
+	switched, _ := store.Read()
+
+	return w, switched
+}
+
+func TestSwitchUser(t *testing.T) {
+	original := newSwitcherToken(role.RLUser, role.RLAllowedToSwitch)
+
+	w, switched := serveSwitchUser(newSwitchUserConfig(), http.MethodPost, "bob", original)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected switch to succeed, got %d", w.Code)
+	}
+
+	st, ok := switched.(*token.SwitchUserToken)
+	if !ok || st.Identity().Credential() != "bob" || st.Original() != original {
+		t.Fatalf("expected impersonation token for bob, got %#v", switched)
+	}
+
+	w, exited := serveSwitchUser(newSwitchUserConfig(), http.MethodPost, DefaultSwitchUserExitValue, st)
+	if w.Code != http.StatusOK || exited != original {
+		t.Errorf("expected exit to restore the original token, got %d %#v", w.Code, exited)
+	}
+}
+
+func TestSwitchUserDenied(t *testing.T) {
+	switcher := newSwitcherToken(role.RLUser, role.RLAllowedToSwitch)
+	nested := token.NewSwitchUserToken(&identity.InMemoryIdentity{UserId: 2, UserCredential: "bob", UserRoles: []role.Role{role.RLUser, role.RLAllowedToSwitch}}, switcher)
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		tok      token.Token
+		expected int
+	}{
+		{"anonymous", http.MethodPost, "bob", token.NewAnonymousToken(), http.StatusUnauthorized},
+		{"missing role", http.MethodPost, "bob", newSwitcherToken(role.RLUser), http.StatusForbidden},
+		{"escalation", http.MethodPost, "carol", switcher, http.StatusForbidden},
+		{"unknown target", http.MethodPost, "dave", switcher, http.StatusForbidden},
+		{"nested switch", http.MethodPost, "bob", nested, http.StatusForbidden},
+		{"exit without switch", http.MethodPost, DefaultSwitchUserExitValue, switcher, http.StatusForbidden},
+		{"get request", http.MethodGet, "bob", switcher, http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		w, tok := serveSwitchUser(newSwitchUserConfig(), tt.method, tt.target, tt.tok)
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.expected, w.Code)
+		}
+
+		if tok != tt.tok {
+			t.Errorf("%s: expected token to be unchanged", tt.name)
+		}
+	}
+}
+
+func TestSwitchUserDeniedResponseIsFixed(t *testing.T) {
+	switcher := newSwitcherToken(role.RLUser, role.RLAllowedToSwitch)
+
+	var body string
+	for _, target := range []string{"carol", "dave", DefaultSwitchUserExitValue} {
+		w, _ := serveSwitchUser(newSwitchUserConfig(), http.MethodPost, target, switcher)
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("%s: expected %d, got %d", target, http.StatusForbidden, w.Code)
+		}
+
+		if body != "" && w.Body.String() != body {
+			t.Errorf("%s: expected the same response for every denial, got %q and %q", target, body, w.Body.String())
+		}
+		body = w.Body.String()
+	}
+}
+
+func TestSwitchUserResolvesHierarchy(t *testing.T) {
+	h, err := role.NewHierarchy(map[role.Role][]role.Role{role.RLAdmin: {role.RLUser, role.RLAllowedToSwitch}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := newSwitchUserConfig()
+	if w, _ := serveSwitchUser(conf, http.MethodPost, "bob", newSwitcherToken(role.RLAdmin)); w.Code != http.StatusForbidden {
+		t.Errorf("expected switch to be denied without a hierarchy, got %d", w.Code)
+	}
+
+	conf.Hierarchy = h
+	w, switched := serveSwitchUser(conf, http.MethodPost, "bob", newSwitcherToken(role.RLAdmin))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected admin to impersonate a user, got %d", w.Code)
+	}
+
+	if st, ok := switched.(*token.SwitchUserToken); !ok || st.Identity().Credential() != "bob" {
+		t.Errorf("expected impersonation token for bob, got %#v", switched)
+	}
+}
+
+func TestSwitchUserRequiresProvider(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected missing provider to panic")
+		}
+	}()
+
+	NewSwitchUserHandler(SwitchUserConfig{})
+}
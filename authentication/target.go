@@ -0,0 +1,79 @@
+package authentication
+
+import (
+	"net/http"
+
+	httpUtil "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/session"
+)
+
+const DefaultTargetPathParameter = "_target_path"
+
+// TargetPathRedirect sends users back to the page they requested before they were
+// redirected to the login. The target is read from the TargetParameter form field
+// or the session and must be same-origin, otherwise DefaultTarget is used.
+type TargetPathRedirect struct {
+	DefaultTarget    string
+	AlwaysUseDefault bool
+	TargetParameter  string
+	Firewall         string
+	Session          session.Config
+	Sessions         session.Provider
+}
+
+func (t *TargetPathRedirect) defaultTarget() string {
+	if t.DefaultTarget == "" {
+		return "/"
+	}
+
+	return t.DefaultTarget
+}
+
+func (t *TargetPathRedirect) session(r *http.Request) session.Session {
+	if t.Sessions == nil {
+		return nil
+	}
+
+	s, err := t.Sessions.Provide(r, t.Session.Name)
+	if err != nil {
+		return nil
+	}
+
+	return s
+}
+
+// TargetURL resolves the url to redirect to after login
+func (t *TargetPathRedirect) TargetURL(r *http.Request) string {
+	if t.AlwaysUseDefault {
+		return t.defaultTarget()
+	}
+
+	param := t.TargetParameter
+	if param == "" {
+		param = DefaultTargetPathParameter
+	}
+
+	if target := r.FormValue(param); httpUtil.IsSafeRedirect(r, target) {
+		return target
+	}
+
+	if s := t.session(r); s != nil {
+		if target := session.TargetPath(s, t.Firewall); httpUtil.IsSafeRedirect(r, target) {
+			return target
+		}
+	}
+
+	return t.defaultTarget()
+}
+
+// Redirect redirects to the target url and removes it from the session
+func (t *TargetPathRedirect) Redirect(w http.ResponseWriter, r *http.Request) {
+	target := t.TargetURL(r)
+
+	if s := t.session(r); s != nil && session.TargetPath(s, t.Firewall) != "" {
+		session.RemoveTargetPath(s, t.Firewall)
+		t.Sessions.Save(w, r, s)
+	}
+
+	http.Redirect(w, r, target, http.StatusFound)
+}
@@ -0,0 +1,165 @@
+package authorization
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+)
+
+type Strategy int
+
+const (
+	// StrategyAffirmative grants access as soon as one voter grants
+	StrategyAffirmative Strategy = iota
+	// StrategyConsensus grants access if more voters grant than deny
+	StrategyConsensus
+	// StrategyUnanimous grants access only if no voter denies
+	StrategyUnanimous
+)
+
+type AccessDecisionManager interface {
+	Decide(ctx context.Context, tok token.Token, attributes []interface{}, subject interface{}) bool
+	IsGranted(ctx context.Context, tok token.Token, attribute interface{}, subject interface{}) bool
+}
+
+type DefaultAccessDecisionManager struct {
+	Voters                    []Voter
+	Strategy                  Strategy
+	AllowIfAllAbstain         bool
+	AllowIfEqualGrantedDenied bool
+}
+
+func NewAccessDecisionManager(strategy Strategy, voters ...Voter) *DefaultAccessDecisionManager {
+	return &DefaultAccessDecisionManager{
+		Voters:                    voters,
+		Strategy:                  strategy,
+		AllowIfEqualGrantedDenied: true,
+	}
+}
+
+// NewDefaultAccessDecisionManager uses the affirmative strategy with the role,
+// authenticated and scope voters
+func NewDefaultAccessDecisionManager(voters ...Voter) *DefaultAccessDecisionManager {
+	return NewAccessDecisionManager(
+		StrategyAffirmative,
+		append([]Voter{NewRoleVoter(), &AuthenticatedVoter{}, NewScopeVoter()}, voters...)...,
+	)
+}
+
+// NewHierarchyAccessDecisionManager is NewDefaultAccessDecisionManager with a
+// role voter that resolves roles against h
+func NewHierarchyAccessDecisionManager(h role.Hierarchy, voters ...Voter) *DefaultAccessDecisionManager {
+	return NewAccessDecisionManager(
+		StrategyAffirmative,
+		append([]Voter{NewRoleHierarchyVoter(h), &AuthenticatedVoter{}, NewScopeVoter()}, voters...)...,
+	)
+}
+
+// vote collects a voter's votes on all attributes. A voter grants if it grants any
+// of the attributes, and denies if it denies one and grants none.
+func vote(ctx context.Context, v Voter, tok token.Token, attributes []interface{}, subject interface{}) Vote {
+	result := AccessAbstain
+	for _, a := range attributes {
+		switch v.Vote(ctx, tok, a, subject) {
+		case AccessGranted:
+			return AccessGranted
+		case AccessDenied:
+			result = AccessDenied
+		}
+	}
+
+	return result
+}
+
+func (m *DefaultAccessDecisionManager) Decide(ctx context.Context, tok token.Token, attributes []interface{}, subject interface{}) bool {
+	var granted, denied int
+
+	for _, v := range m.Voters {
+		switch vote(ctx, v, tok, attributes, subject) {
+		case AccessGranted:
+			if m.Strategy == StrategyAffirmative {
+				return true
+			}
+			granted++
+		case AccessDenied:
+			if m.Strategy == StrategyUnanimous {
+				return false
+			}
+			denied++
+		}
+	}
+
+	switch {
+	case m.Strategy == StrategyConsensus && granted > denied:
+		return true
+	case m.Strategy == StrategyConsensus && denied > granted:
+		return false
+	case m.Strategy == StrategyConsensus && granted > 0:
+		return m.AllowIfEqualGrantedDenied
+	case denied > 0:
+		return false
+	case granted > 0:
+		return true
+	}
+
+	return m.AllowIfAllAbstain
+}
+
+func (m *DefaultAccessDecisionManager) IsGranted(ctx context.Context, tok token.Token, attribute interface{}, subject interface{}) bool {
+	return m.Decide(ctx, tok, []interface{}{attribute}, subject)
+}
+
+type contextKey int
+
+const requestKey contextKey = iota
+
+// WithRequest makes the request available to voters
+func WithRequest(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, requestKey, r)
+}
+
+func RequestFromContext(ctx context.Context) (*http.Request, bool) {
+	r, ok := ctx.Value(requestKey).(*http.Request)
+	return r, ok
+}
+
+// IsGranted checks an attribute against the token of the current request
+func IsGranted(m AccessDecisionManager, r *http.Request, attribute interface{}, subject interface{}) bool {
+	store, err := token.TokenStoreFromRequest(r)
+	if err != nil {
+		return false
+	}
+
+	tok, _ := store.Read()
+
+	return m.IsGranted(WithRequest(r.Context(), r), tok, attribute, subject)
+}
+
+// NewRequireGrantedHandler denies access unless the token is granted one of the attributes
+func NewRequireGrantedHandler(m AccessDecisionManager, attributes ...interface{}) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			store, err := token.TokenStoreFromRequest(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			tok, _ := store.Read()
+
+			if m.Decide(WithRequest(r.Context(), r), tok, attributes, r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if tok == nil || !tok.IsFullyAuthenticated() {
+				http.Error(w, "need authentication", http.StatusUnauthorized)
+				return
+			}
+
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package authorization
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+)
+
+func fixedVoter(v Vote) Voter {
+	return VoterFunc(func(ctx context.Context, tok token.Token, attribute interface{}, subject interface{}) Vote {
+		return v
+	})
+}
+
+func TestStrategies(t *testing.T) {
+	tests := []struct {
+		strategy Strategy
+		votes    []Vote
+		expected bool
+	}{
+		{StrategyAffirmative, []Vote{AccessDenied, AccessGranted}, true},
+		{StrategyAffirmative, []Vote{AccessDenied, AccessAbstain}, false},
+		{StrategyConsensus, []Vote{AccessDenied, AccessGranted, AccessGranted}, true},
+		{StrategyConsensus, []Vote{AccessDenied, AccessDenied, AccessGranted}, false},
+		{StrategyConsensus, []Vote{AccessDenied, AccessGranted}, true},
+		{StrategyUnanimous, []Vote{AccessGranted, AccessDenied}, false},
+		{StrategyUnanimous, []Vote{AccessGranted, AccessAbstain}, true},
+		{StrategyUnanimous, []Vote{AccessAbstain}, false},
+	}
+
+	for i, tt := range tests {
+		var voters []Voter
+		for _, v := range tt.votes {
+			voters = append(voters, fixedVoter(v))
+		}
+
+		m := NewAccessDecisionManager(tt.strategy, voters...)
+		if got := m.IsGranted(context.Background(), nil, "ATTR", nil); got != tt.expected {
+			t.Errorf("%d: expected %v, got %v", i, tt.expected, got)
+		}
+	}
+}
+
+func TestDefaultVoters(t *testing.T) {
+	m := NewDefaultAccessDecisionManager()
+	ctx := context.Background()
+
+	user := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserRoles: []role.Role{role.RLUser}})
+	anon := token.NewAnonymousToken()
+
+	if !m.IsGranted(ctx, user, role.RLUser, nil) {
+		t.Error("expected user to be granted ROLE_USER")
+	}
+
+	if m.IsGranted(ctx, user, "ROLE_ADMIN", nil) {
+		t.Error("expected user to be denied ROLE_ADMIN")
+	}
+
+	if !m.IsGranted(ctx, user, IsAuthenticatedFully, nil) {
+		t.Error("expected user to be fully authenticated")
+	}
+
+	if m.IsGranted(ctx, anon, IsAuthenticatedFully, nil) {
+		t.Error("expected anonymous token not to be fully authenticated")
+	}
+
+	scoped := token.NewScopedToken(nil, &identity.InMemoryIdentity{}, []token.Scope{"orders:read"}, nil)
+	if !m.IsGranted(ctx, scoped, "SCOPE_orders:read", nil) || m.IsGranted(ctx, scoped, token.Scope("orders:write"), nil) {
+		t.Error("expected scope voter to check granted scopes")
+	}
+
+	if v := NewScopeVoter().Vote(ctx, user, "SCOPE_orders:read", nil); v != AccessAbstain {
+		t.Errorf("expected scope voter to abstain for unscoped tokens, got %v", v)
+	}
+
+	if m.IsGranted(ctx, user, "SCOPE_orders:read", nil) {
+		t.Error("expected unscoped token not to be granted a scope")
+	}
+}
+
+func TestRoleHierarchyVoter(t *testing.T) {
+	h, err := role.NewHierarchy(map[role.Role][]role.Role{role.RLAdmin: {role.RLUser}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserRoles: []role.Role{role.RLAdmin}})
+	ctx := context.Background()
+
+	if !NewHierarchyAccessDecisionManager(h).IsGranted(ctx, admin, role.RLUser, nil) {
+		t.Error("expected admin to reach ROLE_USER with the hierarchy")
+	}
+
+	if NewDefaultAccessDecisionManager().IsGranted(ctx, admin, role.RLUser, nil) {
+		t.Error("expected the hierarchy not to leak into other managers")
+	}
+}
@@ -0,0 +1,178 @@
+package authorization
+
+import (
+	"context"
+	"strings"
+
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+)
+
+type Vote int
+
+const (
+	AccessDenied  Vote = -1
+	AccessAbstain Vote = 0
+	AccessGranted Vote = 1
+)
+
+// Voter votes on whether a token is granted an attribute on a subject.
+// Voters abstain on attributes they do not support.
+type Voter interface {
+	Vote(ctx context.Context, tok token.Token, attribute interface{}, subject interface{}) Vote
+}
+
+// VoterFunc adapts a function to the Voter interface
+type VoterFunc func(ctx context.Context, tok token.Token, attribute interface{}, subject interface{}) Vote
+
+func (f VoterFunc) Vote(ctx context.Context, tok token.Token, attribute interface{}, subject interface{}) Vote {
+	return f(ctx, tok, attribute, subject)
+}
+
+const DefaultRolePrefix = "ROLE_"
+
+// RoleVoter votes on role.Role attributes and string attributes starting with Prefix.
+// If Hierarchy is set the token's roles are resolved against it.
+type RoleVoter struct {
+	Prefix    string
+	Hierarchy role.Hierarchy
+}
+
+func NewRoleVoter() *RoleVoter {
+	return &RoleVoter{Prefix: DefaultRolePrefix}
+}
+
+// NewRoleHierarchyVoter creates a role voter that resolves roles against h
+func NewRoleHierarchyVoter(h role.Hierarchy) *RoleVoter {
+	return &RoleVoter{Prefix: DefaultRolePrefix, Hierarchy: h}
+}
+
+func (v *RoleVoter) Vote(ctx context.Context, tok token.Token, attribute interface{}, subject interface{}) Vote {
+	var want role.Role
+
+	switch a := attribute.(type) {
+	case role.Role:
+		want = a
+	case string:
+		if !strings.HasPrefix(a, v.Prefix) {
+			return AccessAbstain
+		}
+		want = role.Role(a)
+	default:
+		return AccessAbstain
+	}
+
+	if tok == nil {
+		return AccessDenied
+	}
+
+	for _, r := range role.Reachable(v.Hierarchy, tok.Roles()) {
+		if r == want {
+			return AccessGranted
+		}
+	}
+
+	return AccessDenied
+}
+
+const (
+	IsAuthenticatedFully       = "IS_AUTHENTICATED_FULLY"
+	IsAuthenticatedRemembered  = "IS_AUTHENTICATED_REMEMBERED"
+	IsAuthenticatedAnonymously = "IS_AUTHENTICATED_ANONYMOUSLY"
+	IsAnonymous                = "IS_ANONYMOUS"
+	IsRememberMe               = "IS_REMEMBERED"
+	IsImpersonator             = "IS_IMPERSONATOR"
+)
+
+// AuthenticatedVoter votes on the authentication state of a token
+type AuthenticatedVoter struct{}
+
+func IsFullyAuthenticated(tok token.Token) bool {
+	if tok == nil || !tok.IsFullyAuthenticated() {
+		return false
+	}
+
+	_, remembered := tok.(token.RememberMe)
+
+	return !remembered
+}
+
+func IsRemembered(tok token.Token) bool {
+	_, remembered := tok.(token.RememberMe)
+	return remembered
+}
+
+func IsAnonymousToken(tok token.Token) bool {
+	return tok == nil || (!tok.IsFullyAuthenticated() && !IsRemembered(tok))
+}
+
+func (v *AuthenticatedVoter) Vote(ctx context.Context, tok token.Token, attribute interface{}, subject interface{}) Vote {
+	a, ok := attribute.(string)
+	if !ok {
+		return AccessAbstain
+	}
+
+	var granted bool
+
+	switch a {
+	case IsAuthenticatedFully:
+		granted = IsFullyAuthenticated(tok)
+	case IsAuthenticatedRemembered:
+		granted = IsFullyAuthenticated(tok) || IsRemembered(tok)
+	case IsAuthenticatedAnonymously:
+		granted = tok != nil
+	case IsAnonymous:
+		granted = IsAnonymousToken(tok)
+	case IsRememberMe:
+		granted = IsRemembered(tok)
+	case IsImpersonator:
+		_, granted = tok.(*token.SwitchUserToken)
+	default:
+		return AccessAbstain
+	}
+
+	if granted {
+		return AccessGranted
+	}
+
+	return AccessDenied
+}
+
+const DefaultScopePrefix = "SCOPE_"
+
+// ScopeVoter votes on token.Scope attributes and string attributes starting with Prefix.
+// It abstains for tokens without scopes, e.g. session tokens, so scope attributes
+// never grant access to them on their own.
+type ScopeVoter struct {
+	Prefix string
+}
+
+func NewScopeVoter() *ScopeVoter {
+	return &ScopeVoter{Prefix: DefaultScopePrefix}
+}
+
+func (v *ScopeVoter) Vote(ctx context.Context, tok token.Token, attribute interface{}, subject interface{}) Vote {
+	var want token.Scope
+
+	switch a := attribute.(type) {
+	case token.Scope:
+		want = a
+	case string:
+		if !strings.HasPrefix(a, v.Prefix) {
+			return AccessAbstain
+		}
+		want = token.Scope(strings.TrimPrefix(a, v.Prefix))
+	default:
+		return AccessAbstain
+	}
+
+	if _, scoped := tok.(token.ScopedToken); !scoped {
+		return AccessAbstain
+	}
+
+	if !tok.IsFullyAuthenticated() || !token.HasScopes(tok, want) {
+		return AccessDenied
+	}
+
+	return AccessGranted
+}
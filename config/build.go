@@ -0,0 +1,462 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/iwyg/goauth/authentication"
+	"github.com/iwyg/goauth/authorization"
+	"github.com/iwyg/goauth/event"
+	"github.com/iwyg/goauth/expression"
+	"github.com/iwyg/goauth/firewall"
+	httpUtil "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/metrics"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/session"
+	"github.com/iwyg/goauth/tracing"
+)
+
+// Security holds the components built from a config. AccessManager and the
+// authenticators resolve roles against Hierarchy, tokens are not changed.
+type Security struct {
+	Encoders      map[string]*Encoder
+	Providers     map[string]identity.Provider
+	Hierarchy     *role.DefaultHierarchy
+	Session       session.Config
+	Sessions      session.Provider
+	AccessMap     *firewall.AccessMap
+	AccessManager authorization.AccessDecisionManager
+	Firewalls     *firewall.DefaultFirewallMap
+}
+
+// RoleHierarchy returns the configured hierarchy, or nil if there is none. A nil
+// *DefaultHierarchy must not become a non-nil role.Hierarchy.
+func (s *Security) RoleHierarchy() role.Hierarchy {
+	if s == nil || s.Hierarchy == nil {
+		return nil
+	}
+
+	return s.Hierarchy
+}
+
+// Loader builds configs with the factories of Registry. Events, Metrics and
+// Tracer are passed to the firewalls, session stores and session config.
+type Loader struct {
+	Registry *Registry
+	Events   event.Dispatcher
+	Metrics  metrics.Collector
+	Tracer   tracing.Tracer
+}
+
+func NewLoader() *Loader {
+	return &Loader{Registry: NewRegistry()}
+}
+
+// LoadFile reads and builds a json or yaml config
+func (l *Loader) LoadFile(path string) (*Security, error) {
+	conf, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.Build(conf)
+}
+
+func sortedKeys(m map[string]Component) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Build creates the components of conf. All invalid values are reported in a
+// *ValidationError.
+func (l *Loader) Build(conf *Config) (*Security, error) {
+	reg := l.Registry
+	if reg == nil {
+		reg = NewRegistry()
+	}
+
+	errs := &errorList{}
+	s := &Security{
+		Encoders:  make(map[string]*Encoder),
+		Providers: make(map[string]identity.Provider),
+		Firewalls: firewall.NewFirewallMap(),
+	}
+
+	s.Session = session.Config{Name: conf.Session.Name, TokenKey: conf.Session.TokenKey, Events: l.Events}
+	if s.Session.Name == "" {
+		s.Session.Name = "goauth"
+	}
+	if s.Session.TokenKey == "" {
+		s.Session.TokenKey = "__security"
+	}
+	ctx := &Context{Security: s, Session: s.Session, Tracer: l.Tracer}
+
+	for _, name := range sortedKeys(conf.Encoders) {
+		c, path := conf.Encoders[name], "encoders."+name
+		f, ok := reg.encoders[c.Type]
+		if !ok {
+			errs.add(path+".type", unknownType("encoder", c.Type, reg.encoders))
+			continue
+		}
+		enc, err := f(ctx, c.Options)
+		if err != nil {
+			errs.add(path+".options", err)
+			continue
+		}
+		s.Encoders[name] = enc
+	}
+
+	for _, name := range sortedKeys(conf.Providers) {
+		c, path := conf.Providers[name], "providers."+name
+		f, ok := reg.providers[c.Type]
+		if !ok {
+			errs.add(path+".type", unknownType("provider", c.Type, reg.providers))
+			continue
+		}
+		p, err := f(ctx, c.Options)
+		if err != nil {
+			errs.add(path+".options", err)
+			continue
+		}
+		s.Providers[name] = p
+	}
+
+	if len(conf.RoleHierarchy) > 0 {
+		h, err := role.NewHierarchy(conf.RoleHierarchy)
+		if err != nil {
+			errs.add("role_hierarchy", err)
+		}
+		s.Hierarchy = h
+	}
+
+	if st := conf.Session.Store; st != nil {
+		if f, ok := reg.sessionStores[st.Type]; !ok {
+			errs.add("session.store.type", unknownType("session store", st.Type, reg.sessionStores))
+		} else if sp, err := f(ctx, st.Options); err != nil {
+			errs.add("session.store.options", err)
+		} else {
+			s.Sessions = sp
+		}
+	}
+
+	l.buildAccessControl(reg, conf, s, errs)
+
+	if len(conf.Firewalls) == 0 {
+		errs.addf("firewalls", "at least one firewall is required")
+	}
+
+	names := make(map[string]bool)
+	for i, fc := range conf.Firewalls {
+		path := index("firewalls", i)
+		if fc.Name != "" && names[fc.Name] {
+			errs.addf(path+".name", "duplicate firewall %q", fc.Name)
+			continue
+		}
+		names[fc.Name] = true
+
+		if c, ok := l.buildFirewall(reg, conf, s, path, fc, errs); ok {
+			if err := s.Firewalls.Register(c); err != nil {
+				errs.add(path, err)
+			}
+		}
+	}
+
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func strategy(name string) (authorization.Strategy, error) {
+	switch name {
+	case "", "affirmative":
+		return authorization.StrategyAffirmative, nil
+	case "consensus":
+		return authorization.StrategyConsensus, nil
+	case "unanimous":
+		return authorization.StrategyUnanimous, nil
+	}
+
+	return 0, fmt.Errorf("unknown strategy %q, use affirmative, consensus or unanimous", name)
+}
+
+func (l *Loader) buildAccessControl(reg *Registry, conf *Config, s *Security, errs *errorList) {
+	st, err := strategy(conf.AccessStrategy)
+	if err != nil {
+		errs.add("access_decision_strategy", err)
+	}
+
+	// the role voter and expressions of the access manager resolve roles against
+	// the configured hierarchy
+	h := s.RoleHierarchy()
+	exprVoter := &expression.Voter{Hierarchy: h}
+	adm := authorization.NewHierarchyAccessDecisionManager(h, exprVoter)
+	adm.Strategy = st
+	exprVoter.Manager = adm
+	s.AccessManager = adm
+
+	if len(conf.AccessControl) == 0 {
+		return
+	}
+
+	s.AccessMap = firewall.NewAccessMap()
+	for i, rc := range conf.AccessControl {
+		path := index("access_control", i)
+		rule := &firewall.AccessRule{Name: rc.Name, Channel: rc.Channel, IPs: rc.IPs}
+
+		m, ok := buildMatcher(reg, path+".match", rc.Match, errs)
+
+		for _, attr := range rc.Attributes {
+			rule.Attributes = append(rule.Attributes, attr)
+		}
+
+		if rc.Expression != "" {
+			expr, err := expression.Parse(rc.Expression)
+			if err != nil {
+				errs.add(path+".expression", err)
+				ok = false
+			} else {
+				rule.Attributes = append(rule.Attributes, expr)
+			}
+		}
+
+		switch rc.Channel {
+		case "", "http", "https":
+		default:
+			errs.addf(path+".channel", "unknown channel %q, use http or https", rc.Channel)
+			ok = false
+		}
+
+		for j, ip := range rc.IPs {
+			if _, err := httpUtil.ParseIPRanges(ip); err != nil {
+				errs.add(index(path+".ips", j), err)
+				ok = false
+			}
+		}
+
+		if ok {
+			rule.Matcher = m
+			if err := s.AccessMap.Add(rule); err != nil {
+				errs.add(path+".ips", err)
+			}
+		}
+	}
+}
+
+func (l *Loader) buildFirewall(reg *Registry, conf *Config, s *Security, path string, fc FirewallConfig, errs *errorList) (firewall.Config, bool) {
+	n := len(errs.errs)
+	// a provider that failed to build was reported already
+	providerFailed := false
+
+	c := firewall.Config{
+		Name:          fc.Name,
+		Stateless:     fc.Stateless,
+		Anonymous:     fc.Anonymous,
+		ContextKey:    fc.Context,
+		Session:       s.Session,
+		Sessions:      s.Sessions,
+		AccessMap:     s.AccessMap,
+		AccessManager: s.AccessManager,
+		Events:        l.Events,
+		Metrics:       l.Metrics,
+		Tracer:        l.Tracer,
+	}
+
+	if fc.Name == "" {
+		errs.addf(path+".name", "name is required")
+	}
+
+	if m, ok := buildMatcher(reg, path+".match", fc.Match, errs); ok {
+		c.Matcher = m
+	}
+
+	if !fc.Stateless && conf.Session.Store == nil {
+		errs.addf(path+".stateless", "session.store is required unless the firewall is stateless")
+	}
+
+	switch {
+	case fc.Provider != "":
+		if p, ok := s.Providers[fc.Provider]; ok {
+			c.Provider = p
+		} else if _, configured := conf.Providers[fc.Provider]; configured {
+			providerFailed = true
+		} else {
+			errs.addf(path+".provider", "unknown provider %q", fc.Provider)
+		}
+	case len(conf.Providers) == 1:
+		for _, p := range s.Providers {
+			c.Provider = p
+		}
+		providerFailed = c.Provider == nil
+	case len(fc.Authenticators) > 0:
+		errs.addf(path+".provider", "provider is required")
+	}
+
+	sc := s.Session
+	sc.TokenKey = c.SessionTokenKey()
+	ctx := &Context{Security: s, Firewall: fc.Name, Session: sc, Tracer: l.Tracer}
+
+	for i, ac := range fc.Authenticators {
+		apath := index(path+".authenticators", i)
+		f, ok := reg.authenticators[ac.Type]
+		if !ok {
+			errs.add(apath+".type", unknownType("authenticator", ac.Type, reg.authenticators))
+			continue
+		}
+
+		a, err := f(ctx, ac.Options)
+		if err != nil {
+			errs.add(apath+".options", err)
+			continue
+		}
+		c.Authenticators = append(c.Authenticators, a)
+	}
+
+	if ep := fc.EntryPoint; ep != nil {
+		if f, ok := reg.entryPoints[ep.Type]; !ok {
+			errs.add(path+".entry_point.type", unknownType("entry point", ep.Type, reg.entryPoints))
+		} else if e, err := f(ctx, ep.Options); err != nil {
+			errs.add(path+".entry_point.options", err)
+		} else {
+			c.EntryPoint = e
+		}
+	}
+
+	if lc := fc.Logout; lc != nil {
+		if lc.Path == "" {
+			errs.addf(path+".logout.path", "path is required")
+		}
+
+		c.Logout = &authentication.LogoutConfig{
+			Path:          lc.Path,
+			Methods:       lc.Methods,
+			CSRFParameter: lc.CSRFParameter,
+			Session:       sc,
+			Sessions:      s.Sessions,
+			Success:       &authentication.RedirectLogoutSuccessHandler{Target: lc.Target},
+			Events:        l.Events,
+		}
+		if s.Sessions != nil {
+			c.Logout.Handlers = []authentication.LogoutHandler{&authentication.SessionLogoutHandler{Session: sc, Sessions: s.Sessions}}
+		}
+	}
+
+	return c, len(errs.errs) == n && !providerFailed
+}
+
+// guard turns a panic of a matcher constructor into an error
+func guard(build func() httpUtil.RequestMatcher) (m httpUtil.RequestMatcher, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("%v", rec)
+		}
+	}()
+
+	return build(), nil
+}
+
+func buildMatcher(reg *Registry, path string, mc MatcherConfig, errs *errorList) (httpUtil.RequestMatcher, bool) {
+	n := len(errs.errs)
+	var ms []httpUtil.RequestMatcher
+
+	if mc.Path != "" {
+		ms = append(ms, httpUtil.Path(mc.Path))
+	}
+	if mc.PathPrefix != "" {
+		ms = append(ms, httpUtil.PathPrefix(mc.PathPrefix))
+	}
+	if mc.PathGlob != "" {
+		if m, err := guard(func() httpUtil.RequestMatcher { return httpUtil.PathGlob(mc.PathGlob) }); err != nil {
+			errs.add(path+".path_glob", err)
+		} else {
+			ms = append(ms, m)
+		}
+	}
+	if mc.PathRegexp != "" {
+		if _, err := regexp.Compile(mc.PathRegexp); err != nil {
+			errs.add(path+".path_regexp", err)
+		} else {
+			ms = append(ms, httpUtil.NewRequestMatcher(httpUtil.RequestMatcherConfig{Path: mc.PathRegexp}))
+		}
+	}
+	if len(mc.Host) > 0 {
+		ms = append(ms, httpUtil.Host(mc.Host...))
+	}
+	if len(mc.Methods) > 0 {
+		ms = append(ms, httpUtil.Methods(mc.Methods...))
+	}
+	if len(mc.IPs) > 0 {
+		for i, ip := range mc.IPs {
+			if _, err := httpUtil.ParseIPRanges(ip); err != nil {
+				errs.add(index(path+".ips", i), err)
+			}
+		}
+		if len(errs.errs) == n {
+			ms = append(ms, httpUtil.IPRange(mc.IPs...))
+		}
+	}
+	if len(mc.Ports) > 0 {
+		ms = append(ms, httpUtil.Port(mc.Ports...))
+	}
+	for _, name := range sortedStrings(mc.Headers) {
+		ms = append(ms, httpUtil.Header(name, mc.Headers[name]))
+	}
+	for _, name := range sortedStrings(mc.Query) {
+		ms = append(ms, httpUtil.Query(name, mc.Query[name]))
+	}
+	if len(mc.ContentTypes) > 0 {
+		ms = append(ms, httpUtil.ContentType(mc.ContentTypes...))
+	}
+	if len(mc.Accepts) > 0 {
+		ms = append(ms, httpUtil.Accepts(mc.Accepts...))
+	}
+	if mc.Custom != "" {
+		if m, ok := reg.matchers[mc.Custom]; ok {
+			ms = append(ms, m)
+		} else {
+			errs.add(path+".custom", fmt.Errorf("unknown matcher %q", mc.Custom))
+		}
+	}
+	if mc.Not != nil {
+		if m, ok := buildMatcher(reg, path+".not", *mc.Not, errs); ok {
+			ms = append(ms, httpUtil.Not(m))
+		}
+	}
+	if len(mc.Any) > 0 {
+		var alternatives []httpUtil.RequestMatcher
+		for i, sub := range mc.Any {
+			if m, ok := buildMatcher(reg, index(path+".any", i), sub, errs); ok {
+				alternatives = append(alternatives, m)
+			}
+		}
+		ms = append(ms, httpUtil.Or(alternatives...))
+	}
+
+	if len(errs.errs) != n {
+		return nil, false
+	}
+
+	if len(ms) == 1 {
+		return ms[0], true
+	}
+
+	return httpUtil.And(ms...), true
+}
+
+func sortedStrings(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
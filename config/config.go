@@ -0,0 +1,201 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/iwyg/goauth/role"
+	"gopkg.in/yaml.v2"
+)
+
+// Config describes the security setup of an application, it is read from yaml
+// or json and turned into components by a Loader, e.g.
+//
+//	encoders:
+//	  default: {type: bcrypt}
+//	providers:
+//	  users:
+//	    type: memory
+//	    options:
+//	      users:
+//	        admin@example.org: {id: 1, password: "$2a$10$...", roles: [ROLE_ADMIN]}
+//	role_hierarchy:
+//	  ROLE_ADMIN: [ROLE_USER]
+//	session:
+//	  name: app
+//	  store: {type: cookie, options: {secret: change-me}}
+//	firewalls:
+//	  - name: main
+//	    match: {path_prefix: /}
+//	    anonymous: true
+//	    authenticators:
+//	      - type: form_login
+//	        options: {username_field: email, failure_path: /login}
+//	    entry_point: {type: form_login, options: {login_path: /login}}
+//	    logout: {path: /logout, csrf_parameter: _csrf_token}
+//	access_control:
+//	  - match: {path_prefix: /admin}
+//	    attributes: [ROLE_ADMIN]
+type Config struct {
+	Encoders       map[string]Component      `json:"encoders" yaml:"encoders"`
+	Providers      map[string]Component      `json:"providers" yaml:"providers"`
+	RoleHierarchy  map[role.Role][]role.Role `json:"role_hierarchy" yaml:"role_hierarchy"`
+	Session        SessionConfig             `json:"session" yaml:"session"`
+	Firewalls      []FirewallConfig          `json:"firewalls" yaml:"firewalls"`
+	AccessStrategy string                    `json:"access_decision_strategy" yaml:"access_decision_strategy"`
+	AccessControl  []AccessRuleConfig        `json:"access_control" yaml:"access_control"`
+}
+
+// Component references a factory of the registry by type, options are decoded
+// by the factory
+type Component struct {
+	Type    string  `json:"type" yaml:"type"`
+	Options Options `json:"options" yaml:"options"`
+}
+
+type SessionConfig struct {
+	Name     string     `json:"name" yaml:"name"`
+	TokenKey string     `json:"token_key" yaml:"token_key"`
+	Store    *Component `json:"store" yaml:"store"`
+}
+
+// MatcherConfig builds a request matcher from all fields that are set, a
+// request must match each of them. An empty config matches any request.
+type MatcherConfig struct {
+	Path         string            `json:"path" yaml:"path"`
+	PathPrefix   string            `json:"path_prefix" yaml:"path_prefix"`
+	PathGlob     string            `json:"path_glob" yaml:"path_glob"`
+	PathRegexp   string            `json:"path_regexp" yaml:"path_regexp"`
+	Host         []string          `json:"host" yaml:"host"`
+	Methods      []string          `json:"methods" yaml:"methods"`
+	IPs          []string          `json:"ips" yaml:"ips"`
+	Ports        []int             `json:"ports" yaml:"ports"`
+	Headers      map[string]string `json:"headers" yaml:"headers"`
+	Query        map[string]string `json:"query" yaml:"query"`
+	ContentTypes []string          `json:"content_types" yaml:"content_types"`
+	Accepts      []string          `json:"accepts" yaml:"accepts"`
+	// Custom names a matcher added with Registry.RegisterMatcher
+	Custom string          `json:"custom" yaml:"custom"`
+	Not    *MatcherConfig  `json:"not" yaml:"not"`
+	Any    []MatcherConfig `json:"any" yaml:"any"`
+}
+
+type LogoutConfig struct {
+	Path          string   `json:"path" yaml:"path"`
+	Methods       []string `json:"methods" yaml:"methods"`
+	CSRFParameter string   `json:"csrf_parameter" yaml:"csrf_parameter"`
+	Target        string   `json:"target" yaml:"target"`
+}
+
+// FirewallConfig describes a firewall. Firewalls are matched in order. Provider
+// names an entry of the providers section and may be omitted if there is only one.
+type FirewallConfig struct {
+	Name           string        `json:"name" yaml:"name"`
+	Match          MatcherConfig `json:"match" yaml:"match"`
+	Provider       string        `json:"provider" yaml:"provider"`
+	Stateless      bool          `json:"stateless" yaml:"stateless"`
+	Anonymous      bool          `json:"anonymous" yaml:"anonymous"`
+	Context        string        `json:"context" yaml:"context"`
+	Authenticators []Component   `json:"authenticators" yaml:"authenticators"`
+	EntryPoint     *Component    `json:"entry_point" yaml:"entry_point"`
+	Logout         *LogoutConfig `json:"logout" yaml:"logout"`
+}
+
+// AccessRuleConfig protects matched requests. Attributes are roles or
+// authentication states like IS_AUTHENTICATED_FULLY, Expression is parsed
+// by the expression package.
+type AccessRuleConfig struct {
+	Name       string        `json:"name" yaml:"name"`
+	Match      MatcherConfig `json:"match" yaml:"match"`
+	Attributes []string      `json:"attributes" yaml:"attributes"`
+	Expression string        `json:"expression" yaml:"expression"`
+	Channel    string        `json:"channel" yaml:"channel"`
+	IPs        []string      `json:"ips" yaml:"ips"`
+}
+
+// Options are the factory specific settings of a component
+type Options map[string]interface{}
+
+// normalize converts the maps produced by yaml into maps with string keys
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			out[fmt.Sprint(k)] = normalize(val)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			out[k] = normalize(val)
+		}
+		return out
+	case Options:
+		return normalize(map[string]interface{}(t))
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, val := range t {
+			out[i] = normalize(val)
+		}
+		return out
+	}
+
+	return v
+}
+
+// Decode decodes the options into v using its json tags. Unknown options are
+// an error.
+func (o Options) Decode(v interface{}) error {
+	data, err := json.Marshal(normalize(o))
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	return dec.Decode(v)
+}
+
+// ParseJSON reads a config, unknown fields are an error
+func ParseJSON(data []byte) (*Config, error) {
+	conf := &Config{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(conf); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+// ParseYAML reads a config, unknown fields are an error
+func ParseYAML(data []byte) (*Config, error) {
+	conf := &Config{}
+	if err := yaml.UnmarshalStrict(data, conf); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+// LoadFile reads a json or yaml config, depending on the file extension
+func LoadFile(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		return ParseYAML(data)
+	default:
+		return ParseJSON(data)
+	}
+}
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/iwyg/goauth/expression"
+	"github.com/iwyg/goauth/firewall"
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+	"github.com/iwyg/goauth/tracing"
+)
+
+const testConfig = `
+encoders:
+  plain: {type: plain}
+providers:
+  users:
+    type: memory
+    options:
+      users:
+        admin@example.org: {id: 1, password: secret, roles: [ROLE_ADMIN]}
+role_hierarchy:
+  ROLE_ADMIN: [ROLE_USER]
+session:
+  name: app
+  store: {type: cookie, options: {secret: test-secret}}
+firewalls:
+  - name: main
+    match: {path_prefix: /}
+    anonymous: true
+    authenticators:
+      - type: form_login
+        options: {username_field: email, failure_path: /login, default_target: /home}
+    entry_point: {type: form_login, options: {login_path: /login}}
+    logout: {path: /logout}
+access_control:
+  - name: admin
+    match: {path_glob: /admin/**}
+    attributes: [ROLE_ADMIN]
+`
+
+type plainChecker struct{}
+
+func (plainChecker) CheckPass(plain []byte, hash []byte) error {
+	if string(plain) != string(hash) {
+		return errors.New("invalid password")
+	}
+
+	return nil
+}
+
+func newTestLoader() *Loader {
+	l := NewLoader()
+	l.Registry.RegisterEncoder("plain", func(ctx *Context, opts Options) (*Encoder, error) {
+		return &Encoder{Checker: plainChecker{}}, nil
+	})
+
+	return l
+}
+
+func TestBuild(t *testing.T) {
+	// the cookie store gob encodes the token of the login
+	token.Init()
+	identity.Register(&identity.InMemoryIdentity{})
+
+	conf, err := ParseYAML([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := newTestLoader().Build(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Firewalls.Firewall("main") == nil {
+		t.Fatal("expected firewall main")
+	}
+
+	h := firewall.NewFirewallMiddleware(&firewall.Firewall{Map: s.Firewalls})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	login := func(password string) *http.Request {
+		form := url.Values{"email": {"admin@example.org"}, "password": {password}}
+		r := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+
+	tests := []struct {
+		name     string
+		request  *http.Request
+		status   int
+		location string
+	}{
+		{"public", httptest.NewRequest("GET", "/", nil), http.StatusNoContent, ""},
+		{"protected", httptest.NewRequest("GET", "/admin/users", nil), http.StatusFound, "/login"},
+		{"login", login("secret"), http.StatusFound, "/home"},
+		{"failed login", login("wrong"), http.StatusFound, "/login"},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, tt.request)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, rec.Code)
+		}
+
+		if loc := rec.Header().Get("Location"); loc != tt.location {
+			t.Errorf("%s: expected location %q, got %q", tt.name, tt.location, loc)
+		}
+	}
+}
+
+func TestBuildAppliesRoleHierarchy(t *testing.T) {
+	conf, err := ParseYAML([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := newTestLoader().Build(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserRoles: []role.Role{role.RLAdmin}})
+	user := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserRoles: []role.Role{role.RLUser}})
+
+	tests := []struct {
+		name     string
+		tok      token.Token
+		attr     interface{}
+		expected bool
+	}{
+		{"inherited role", admin, role.RLUser, true},
+		{"inherited role in expression", admin, expression.MustParse("has_role('ROLE_USER')"), true},
+		{"own role", user, role.RLUser, true},
+		{"role not inherited", user, role.RLAdmin, false},
+	}
+
+	for _, tt := range tests {
+		if got := s.AccessManager.Decide(context.Background(), tt.tok, []interface{}{tt.attr}, nil); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestBuildTraces(t *testing.T) {
+	t.Parallel()
+
+	conf, err := ParseYAML([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &tracing.Recorder{}
+	l := newTestLoader()
+	l.Tracer = rec
+
+	s, err := l.Build(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := firewall.NewFirewallMiddleware(&firewall.Firewall{Map: s.Firewalls})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	form := url.Values{"email": {"admin@example.org"}, "password": {"secret"}}
+	r := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	for _, name := range []string{tracing.SpanSessionLoad, tracing.SpanAuthenticate, tracing.SpanIdentityLookup, tracing.SpanSessionSave} {
+		if len(rec.Spans(name)) == 0 {
+			t.Errorf("expected a %s span", name)
+		}
+	}
+}
+
+func TestBuildReportsPaths(t *testing.T) {
+	conf, err := ParseJSON([]byte(`{
+		"encoders": {"default": {"type": "bcrypt", "options": {"cost": 99}}},
+		"providers": {"users": {"type": "ldap"}},
+		"firewalls": [
+			{"name": "api", "stateless": true, "match": {"path_glob": "/api/[", "ips": ["10.0.0.0/8", "nope"]},
+			 "authenticators": [{"type": "api_key", "options": {"clients": {"k": {}}}}, {"type": "oauth"}]},
+			{"name": "api", "stateless": true}
+		],
+		"access_control": [{"expression": "has_role(", "channel": "ftp"}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewLoader().Build(conf)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+
+	paths := make(map[string]bool)
+	for _, e := range verr.Errors {
+		paths[e.Path] = true
+	}
+
+	for _, p := range []string{
+		"encoders.default.options.cost",
+		"providers.users.type",
+		"firewalls[0].match.path_glob",
+		"firewalls[0].match.ips[1]",
+		"firewalls[0].authenticators[0].options.clients.k.owner",
+		"firewalls[0].authenticators[1].type",
+		"firewalls[1].name",
+		"access_control[0].expression",
+		"access_control[0].channel",
+	} {
+		if !paths[p] {
+			t.Errorf("expected error at %s, got %v", p, err)
+		}
+	}
+}
+
+func TestParseRejectsUnknownFields(t *testing.T) {
+	if _, err := ParseYAML([]byte("firewall: []")); err == nil {
+		t.Error("expected unknown yaml field to fail")
+	}
+
+	if _, err := ParseJSON([]byte(`{"firewalls": [{"nmae": "main"}]}`)); err == nil {
+		t.Error("expected unknown json field to fail")
+	}
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError is an invalid config value, Path locates it, e.g.
+// "firewalls[0].authenticators[1].type". Factories may return a FieldError
+// with a path relative to their options.
+type FieldError struct {
+	Path string
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError holds all errors found while building a config
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("invalid security config:\n  %s", strings.Join(msgs, "\n  "))
+}
+
+type errorList struct {
+	errs []*FieldError
+}
+
+func (l *errorList) add(path string, err error) {
+	if fe, ok := err.(*FieldError); ok && fe.Path != "" {
+		l.errs = append(l.errs, &FieldError{Path: path + "." + fe.Path, Err: fe.Err})
+		return
+	}
+
+	l.errs = append(l.errs, &FieldError{Path: path, Err: err})
+}
+
+func (l *errorList) addf(path string, format string, args ...interface{}) {
+	l.add(path, fmt.Errorf(format, args...))
+}
+
+func (l *errorList) err() error {
+	if len(l.errs) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Errors: l.errs}
+}
+
+func index(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
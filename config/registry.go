@@ -0,0 +1,424 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/sessions"
+	"github.com/iwyg/goauth/authentication"
+	"github.com/iwyg/goauth/firewall"
+	httpUtil "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/security"
+	"github.com/iwyg/goauth/session"
+	"github.com/iwyg/goauth/token"
+	"github.com/iwyg/goauth/tracing"
+)
+
+// Encoder hashes and checks passwords
+type Encoder struct {
+	Encoder security.PasswordEncoder
+	Checker security.PasswordChecker
+}
+
+// Context gives factories access to the components built so far. Firewall and
+// Session are those of the firewall being built, the session token key is the
+// one of the firewall context. Tracer is the tracer of the Loader.
+type Context struct {
+	Security *Security
+	Firewall string
+	Session  session.Config
+	Tracer   tracing.Tracer
+}
+
+// Encoder returns an encoder by name, an empty name selects the only encoder
+func (c *Context) Encoder(name string) (*Encoder, error) {
+	if name == "" && len(c.Security.Encoders) == 1 {
+		for _, enc := range c.Security.Encoders {
+			return enc, nil
+		}
+	}
+
+	if enc, ok := c.Security.Encoders[name]; ok {
+		return enc, nil
+	}
+
+	if name == "" {
+		return nil, &FieldError{Path: "encoder", Err: errors.New("encoder is required")}
+	}
+
+	return nil, &FieldError{Path: "encoder", Err: fmt.Errorf("unknown encoder %q", name)}
+}
+
+type EncoderFactory func(ctx *Context, opts Options) (*Encoder, error)
+type ProviderFactory func(ctx *Context, opts Options) (identity.Provider, error)
+type AuthenticatorFactory func(ctx *Context, opts Options) (authentication.Authenticator, error)
+type EntryPointFactory func(ctx *Context, opts Options) (firewall.EntryPoint, error)
+type SessionStoreFactory func(ctx *Context, opts Options) (session.Provider, error)
+
+// Registry holds the factories components are created with, keyed by the type
+// name used in the config
+type Registry struct {
+	encoders       map[string]EncoderFactory
+	providers      map[string]ProviderFactory
+	authenticators map[string]AuthenticatorFactory
+	entryPoints    map[string]EntryPointFactory
+	sessionStores  map[string]SessionStoreFactory
+	matchers       map[string]httpUtil.RequestMatcher
+}
+
+// NewRegistry creates a registry with the built-in factories. Registering a
+// type again replaces its factory.
+func NewRegistry() *Registry {
+	r := &Registry{
+		encoders:       make(map[string]EncoderFactory),
+		providers:      make(map[string]ProviderFactory),
+		authenticators: make(map[string]AuthenticatorFactory),
+		entryPoints:    make(map[string]EntryPointFactory),
+		sessionStores:  make(map[string]SessionStoreFactory),
+		matchers:       make(map[string]httpUtil.RequestMatcher),
+	}
+
+	r.RegisterEncoder("bcrypt", newBCryptEncoder)
+	r.RegisterProvider("memory", newMemoryProvider)
+	r.RegisterAuthenticator("form_login", newFormLoginAuthenticator)
+	r.RegisterAuthenticator("api_key", newAPIKeyAuthenticator)
+	r.RegisterEntryPoint("form_login", newFormLoginEntryPoint)
+	r.RegisterEntryPoint("redirect", newRedirectEntryPoint)
+	r.RegisterEntryPoint("basic", newBasicEntryPoint)
+	r.RegisterEntryPoint("json", func(ctx *Context, opts Options) (firewall.EntryPoint, error) {
+		return &firewall.JSONEntryPoint{}, nil
+	})
+	r.RegisterEntryPoint("unauthorized", func(ctx *Context, opts Options) (firewall.EntryPoint, error) {
+		return &firewall.UnauthorizedEntryPoint{}, nil
+	})
+	r.RegisterSessionStore("cookie", newCookieSessionStore)
+
+	return r
+}
+
+func (r *Registry) RegisterEncoder(typ string, f EncoderFactory) {
+	r.encoders[typ] = f
+}
+
+func (r *Registry) RegisterProvider(typ string, f ProviderFactory) {
+	r.providers[typ] = f
+}
+
+func (r *Registry) RegisterAuthenticator(typ string, f AuthenticatorFactory) {
+	r.authenticators[typ] = f
+}
+
+func (r *Registry) RegisterEntryPoint(typ string, f EntryPointFactory) {
+	r.entryPoints[typ] = f
+}
+
+func (r *Registry) RegisterSessionStore(typ string, f SessionStoreFactory) {
+	r.sessionStores[typ] = f
+}
+
+// RegisterMatcher adds a matcher that is referenced by the custom field of a matcher config
+func (r *Registry) RegisterMatcher(name string, m httpUtil.RequestMatcher) {
+	r.matchers[name] = m
+}
+
+func typeNames(m interface{}) []string {
+	var names []string
+	switch t := m.(type) {
+	case map[string]EncoderFactory:
+		for n := range t {
+			names = append(names, n)
+		}
+	case map[string]ProviderFactory:
+		for n := range t {
+			names = append(names, n)
+		}
+	case map[string]AuthenticatorFactory:
+		for n := range t {
+			names = append(names, n)
+		}
+	case map[string]EntryPointFactory:
+		for n := range t {
+			names = append(names, n)
+		}
+	case map[string]SessionStoreFactory:
+		for n := range t {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func unknownType(kind string, typ string, factories interface{}) error {
+	if typ == "" {
+		return fmt.Errorf("%s type is required", kind)
+	}
+
+	return fmt.Errorf("unknown %s type %q, known types are %v", kind, typ, typeNames(factories))
+}
+
+func newBCryptEncoder(ctx *Context, opts Options) (*Encoder, error) {
+	var o struct {
+		Cost int `json:"cost"`
+	}
+	if err := opts.Decode(&o); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case o.Cost == 0:
+		o.Cost = 10
+	case o.Cost < 4 || o.Cost > 31:
+		return nil, &FieldError{Path: "cost", Err: fmt.Errorf("cost must be between 4 and 31, got %d", o.Cost)}
+	}
+
+	return &Encoder{
+		Encoder: &security.BCryptPasswordEncoder{Cost: o.Cost},
+		Checker: security.NewBCryptPasswordChecker(),
+	}, nil
+}
+
+type memoryUser struct {
+	ID         interface{}            `json:"id"`
+	Password   string                 `json:"password"`
+	Roles      []role.Role            `json:"roles"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// newMemoryProvider provides the users of the config or of a users json file
+func newMemoryProvider(ctx *Context, opts Options) (identity.Provider, error) {
+	var o struct {
+		File  string                 `json:"file"`
+		Users map[string]*memoryUser `json:"users"`
+	}
+	if err := opts.Decode(&o); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case o.File != "" && len(o.Users) > 0:
+		return nil, errors.New("either file or users may be set")
+	case o.File != "":
+		p, err := identity.LoadInMemoryProvider(identity.InMemoryProviderConfig{UsersJSON: o.File})
+		if err != nil {
+			return nil, &FieldError{Path: "file", Err: err}
+		}
+		return p, nil
+	}
+
+	users := make(map[interface{}]identity.Identity, len(o.Users))
+	for credential, u := range o.Users {
+		if u == nil {
+			return nil, &FieldError{Path: "users." + credential, Err: errors.New("user is empty")}
+		}
+
+		id := u.ID
+		if id == nil {
+			id = credential
+		}
+
+		users[credential] = &identity.InMemoryIdentity{
+			UserId:         id,
+			UserCredential: credential,
+			UserPass:       u.Password,
+			UserRoles:      u.Roles,
+			UserAttributes: u.Attributes,
+		}
+	}
+
+	return identity.NewInMemoryIdentityProvider(users), nil
+}
+
+// newFormLoginAuthenticator authenticates username and password form fields,
+// failures redirect to the failure path with a flash message
+func newFormLoginAuthenticator(ctx *Context, opts Options) (authentication.Authenticator, error) {
+	var o struct {
+		Encoder          string `json:"encoder"`
+		UsernameField    string `json:"username_field"`
+		PasswordField    string `json:"password_field"`
+		FailurePath      string `json:"failure_path"`
+		DefaultTarget    string `json:"default_target"`
+		AlwaysUseDefault bool   `json:"always_use_default"`
+		JSON             bool   `json:"json"`
+	}
+	if err := opts.Decode(&o); err != nil {
+		return nil, err
+	}
+
+	enc, err := ctx.Encoder(o.Encoder)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.UsernameField == "" {
+		o.UsernameField = "username"
+	}
+	if o.PasswordField == "" {
+		o.PasswordField = "password"
+	}
+
+	a := &authentication.DefaultLoginAuthenticator{
+		PasswordChecker: enc.Checker,
+		CredentialField: o.UsernameField,
+		PasswordField:   o.PasswordField,
+	}
+
+	if o.JSON {
+		return authentication.WithHandlers(a, &authentication.JSONSuccessHandler{}, &authentication.JSONFailureHandler{}), nil
+	}
+
+	if ctx.Security.Sessions == nil {
+		return nil, errors.New("form login requires a session store")
+	}
+
+	if o.FailurePath == "" {
+		o.FailurePath = "/login"
+	}
+
+	return authentication.WithHandlers(a,
+		&authentication.FormLoginSuccessHandler{TargetPathRedirect: authentication.TargetPathRedirect{
+			DefaultTarget:    o.DefaultTarget,
+			AlwaysUseDefault: o.AlwaysUseDefault,
+			Firewall:         ctx.Firewall,
+			Session:          ctx.Session,
+			Sessions:         ctx.Security.Sessions,
+		}},
+		&authentication.FormLoginFailureHandler{FailurePath: o.FailurePath, Session: ctx.Session, Sessions: ctx.Security.Sessions},
+	), nil
+}
+
+type apiClient struct {
+	Owner  interface{}   `json:"owner"`
+	Scopes []token.Scope `json:"scopes"`
+	Roles  []role.Role   `json:"roles"`
+}
+
+// newAPIKeyAuthenticator authenticates the api keys of the configured clients
+func newAPIKeyAuthenticator(ctx *Context, opts Options) (authentication.Authenticator, error) {
+	var o struct {
+		Header         string                `json:"header"`
+		ScopeParameter string                `json:"scope_parameter"`
+		Clients        map[string]*apiClient `json:"clients"`
+	}
+	if err := opts.Decode(&o); err != nil {
+		return nil, err
+	}
+
+	clients := make(map[string]*authentication.APIClient, len(o.Clients))
+	for key, c := range o.Clients {
+		if c == nil || c.Owner == nil {
+			return nil, &FieldError{Path: "clients." + key + ".owner", Err: errors.New("owner is required")}
+		}
+		clients[key] = &authentication.APIClient{Owner: c.Owner, Scopes: c.Scopes, Roles: c.Roles}
+	}
+
+	return &authentication.APIKeyAuthenticator{
+		Clients:        &authentication.InMemoryAPIClientProvider{Clients: clients},
+		Header:         o.Header,
+		ScopeParameter: o.ScopeParameter,
+		Hierarchy:      ctx.Security.RoleHierarchy(),
+	}, nil
+}
+
+func newFormLoginEntryPoint(ctx *Context, opts Options) (firewall.EntryPoint, error) {
+	var o struct {
+		LoginPath string `json:"login_path"`
+	}
+	if err := opts.Decode(&o); err != nil {
+		return nil, err
+	}
+
+	if o.LoginPath == "" {
+		o.LoginPath = "/login"
+	}
+
+	return &firewall.FormLoginEntryPoint{
+		LoginPath: o.LoginPath,
+		Firewall:  ctx.Firewall,
+		Session:   ctx.Session,
+		Sessions:  ctx.Security.Sessions,
+	}, nil
+}
+
+func newRedirectEntryPoint(ctx *Context, opts Options) (firewall.EntryPoint, error) {
+	var o struct {
+		Path string `json:"path"`
+	}
+	if err := opts.Decode(&o); err != nil {
+		return nil, err
+	}
+
+	if o.Path == "" {
+		return nil, &FieldError{Path: "path", Err: errors.New("path is required")}
+	}
+
+	return &firewall.LoginRedirectEntryPoint{Path: o.Path}, nil
+}
+
+func newBasicEntryPoint(ctx *Context, opts Options) (firewall.EntryPoint, error) {
+	var o struct {
+		Realm string `json:"realm"`
+	}
+	if err := opts.Decode(&o); err != nil {
+		return nil, err
+	}
+
+	return &firewall.BasicEntryPoint{Realm: o.Realm}, nil
+}
+
+// newCookieSessionStore stores sessions in signed cookies
+func newCookieSessionStore(ctx *Context, opts Options) (session.Provider, error) {
+	o := struct {
+		Secret        string `json:"secret"`
+		EncryptionKey string `json:"encryption_key"`
+		Path          string `json:"path"`
+		Domain        string `json:"domain"`
+		MaxAge        int    `json:"max_age"`
+		Secure        bool   `json:"secure"`
+		HttpOnly      *bool  `json:"http_only"`
+		SameSite      string `json:"same_site"`
+	}{Path: "/", MaxAge: 86400}
+	if err := opts.Decode(&o); err != nil {
+		return nil, err
+	}
+
+	if o.Secret == "" {
+		return nil, &FieldError{Path: "secret", Err: errors.New("secret is required")}
+	}
+
+	keys := [][]byte{[]byte(o.Secret)}
+	if o.EncryptionKey != "" {
+		if n := len(o.EncryptionKey); n != 16 && n != 24 && n != 32 {
+			return nil, &FieldError{Path: "encryption_key", Err: errors.New("encryption key must have 16, 24 or 32 bytes")}
+		}
+		keys = append(keys, []byte(o.EncryptionKey))
+	}
+
+	sameSite := map[string]http.SameSite{
+		"":       http.SameSiteDefaultMode,
+		"lax":    http.SameSiteLaxMode,
+		"strict": http.SameSiteStrictMode,
+		"none":   http.SameSiteNoneMode,
+	}
+	mode, ok := sameSite[o.SameSite]
+	if !ok {
+		return nil, &FieldError{Path: "same_site", Err: fmt.Errorf("unknown same site mode %q", o.SameSite)}
+	}
+
+	cs := sessions.NewCookieStore(keys...)
+	cs.Options = &sessions.Options{
+		Path:     o.Path,
+		Domain:   o.Domain,
+		MaxAge:   o.MaxAge,
+		Secure:   o.Secure,
+		HttpOnly: o.HttpOnly == nil || *o.HttpOnly,
+		SameSite: mode,
+	}
+
+	return &session.GorillaSessionProvider{Store: cs, Tracer: ctx.Tracer}, nil
+}
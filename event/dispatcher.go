@@ -0,0 +1,236 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"github.com/iwyg/goauth/logging"
+)
+
+const (
+	DefaultWorkers   = 4
+	DefaultQueueSize = 256
+)
+
+var (
+	// ErrQueueFull is returned by DispatchAsync if all workers are busy and the queue is full
+	ErrQueueFull = errors.New("event queue is full")
+	// ErrDispatcherClosed is returned by DispatchAsync after Shutdown
+	ErrDispatcherClosed = errors.New("event dispatcher is closed")
+)
+
+// Handler handles an event
+type Handler func(e Event)
+
+type HandlerRegistry interface {
+	// Add registers a handler for all events
+	Add(h Handler, priority int)
+	// On registers a handler for events with the given name
+	On(name string, h Handler, priority int)
+}
+
+// Dispatcher calls the handlers of an event in order of priority, highest first.
+// Handlers of the same priority run in the order they were registered.
+type Dispatcher interface {
+	Dispatch(e Event)
+	DispatchAsync(e Event) error
+}
+
+type listener struct {
+	handler  Handler
+	priority int
+	seq      int
+}
+
+// DefaultDispatcher dispatches asynchronous events on a bounded pool of workers
+// which is started by the first DispatchAsync. The zero value is ready to use with
+// DefaultWorkers, DefaultQueueSize and the default logger.
+type DefaultDispatcher struct {
+	mu        sync.RWMutex
+	listeners map[string][]listener
+	seq       int
+
+	workers   int
+	queueSize int
+	start     sync.Once
+	queue     chan Event
+	closeMu   sync.RWMutex
+	closed    bool
+	wg        sync.WaitGroup
+	logger    *slog.Logger
+}
+
+// NewDispatcher creates a dispatcher running asynchronous events on the given
+// number of workers, queuing up to queueSize events. Panics of asynchronous
+// handlers are logged to the logger configured by opts.
+func NewDispatcher(workers int, queueSize int, opts ...logging.Option) *DefaultDispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	return &DefaultDispatcher{
+		listeners: make(map[string][]listener),
+		workers:   workers,
+		queueSize: queueSize,
+		logger:    logging.New(opts...),
+	}
+}
+
+func NewEventDispatcher(opts ...logging.Option) *DefaultDispatcher {
+	return NewDispatcher(DefaultWorkers, DefaultQueueSize, opts...)
+}
+
+func (d *DefaultDispatcher) Add(h Handler, priority int) {
+	d.On("", h, priority)
+}
+
+func (d *DefaultDispatcher) On(name string, h Handler, priority int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.listeners == nil {
+		d.listeners = make(map[string][]listener)
+	}
+
+	d.seq++
+	ls := append(d.listeners[name], listener{handler: h, priority: priority, seq: d.seq})
+	sortListeners(ls)
+	d.listeners[name] = ls
+}
+
+// Listen registers a handler for events with the given name which are of type E.
+// Events of another type are ignored.
+func Listen[E Event](r HandlerRegistry, name string, h func(e E), priority int) {
+	r.On(name, func(e Event) {
+		if ev, ok := e.(E); ok {
+			h(ev)
+		}
+	}, priority)
+}
+
+func sortListeners(ls []listener) {
+	sort.SliceStable(ls, func(i, j int) bool {
+		if ls[i].priority != ls[j].priority {
+			return ls[i].priority > ls[j].priority
+		}
+
+		return ls[i].seq < ls[j].seq
+	})
+}
+
+// handlers returns the handlers of the event and the handlers registered for all events
+func (d *DefaultDispatcher) handlers(e Event) []Handler {
+	d.mu.RLock()
+	ls := make([]listener, 0, len(d.listeners[e.Name()])+len(d.listeners[""]))
+	ls = append(ls, d.listeners[e.Name()]...)
+	if e.Name() != "" {
+		ls = append(ls, d.listeners[""]...)
+	}
+	d.mu.RUnlock()
+
+	sortListeners(ls)
+
+	hs := make([]Handler, len(ls))
+	for i, l := range ls {
+		hs[i] = l.handler
+	}
+
+	return hs
+}
+
+// Dispatch calls the handlers of the event until one stops the propagation
+func (d *DefaultDispatcher) Dispatch(e Event) {
+	for _, h := range d.handlers(e) {
+		if e.IsStopped() {
+			return
+		}
+		h(e)
+	}
+}
+
+func (d *DefaultDispatcher) work() {
+	defer d.wg.Done()
+
+	for e := range d.queue {
+		d.dispatchRecover(e)
+	}
+}
+
+func (d *DefaultDispatcher) dispatchRecover(e Event) {
+	defer func() {
+		if err := recover(); err != nil {
+			d.logger.Error("event handler panicked", "event", e.Name(), "error", err)
+		}
+	}()
+
+	d.Dispatch(e)
+}
+
+// DispatchAsync queues the event for a worker. Handlers of an asynchronous event
+// run in order on one worker, but must not rely on the request still being served.
+func (d *DefaultDispatcher) DispatchAsync(e Event) error {
+	d.start.Do(func() {
+		if d.workers < 1 {
+			d.workers = DefaultWorkers
+			d.queueSize = DefaultQueueSize
+		}
+		if d.logger == nil {
+			d.logger = logging.New()
+		}
+		d.queue = make(chan Event, d.queueSize)
+		d.wg.Add(d.workers)
+		for i := 0; i < d.workers; i++ {
+			go d.work()
+		}
+	})
+
+	d.closeMu.RLock()
+	defer d.closeMu.RUnlock()
+
+	if d.closed {
+		return ErrDispatcherClosed
+	}
+
+	select {
+	case d.queue <- e:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Shutdown stops accepting asynchronous events and waits until the queued events
+// are handled or ctx is done
+func (d *DefaultDispatcher) Shutdown(ctx context.Context) error {
+	d.closeMu.Lock()
+	if d.closed {
+		d.closeMu.Unlock()
+		return nil
+	}
+	d.closed = true
+	d.start.Do(func() {})
+	if d.queue != nil {
+		close(d.queue)
+	}
+	d.closeMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
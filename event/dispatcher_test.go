@@ -0,0 +1,144 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iwyg/goauth/logging"
+)
+
+func TestDispatchPriorityAndStop(t *testing.T) {
+	d := NewEventDispatcher()
+
+	var calls []string
+	d.Add(func(e Event) { calls = append(calls, "all") }, 200)
+	d.On(LogoutEvent, func(e Event) { calls = append(calls, "low") }, 100)
+	Listen(d, LogoutEvent, func(e *Logout) { calls = append(calls, "high") }, 300)
+	Listen(d, LogoutEvent, func(e *Logout) { calls = append(calls, "stop"); e.Stop() }, 150)
+	Listen(d, LoginSuccessEvent, func(e *LoginSuccess) { calls = append(calls, "login") }, 1000)
+
+	d.Dispatch(NewLogout(httptest.NewRequest("POST", "/logout", nil), nil))
+
+	expected := []string{"high", "all", "stop"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+}
+
+func TestDispatchAsyncWhenStopped(t *testing.T) {
+	d := NewDispatcher(2, 4)
+
+	var mu sync.Mutex
+	var calls []string
+	d.Add(func(e Event) {
+		mu.Lock()
+		calls = append(calls, "a")
+		mu.Unlock()
+	}, 100)
+	d.Add(func(e Event) {
+		mu.Lock()
+		calls = append(calls, "b")
+		mu.Unlock()
+		e.Stop()
+	}, 300)
+
+	if err := d.DispatchAsync(New("test", httptest.NewRequest("GET", "/", nil))); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := d.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(calls, []string{"b"}) {
+		t.Errorf("expected only the stopping handler to run, got %v", calls)
+	}
+
+	if err := d.DispatchAsync(New("test", nil)); err != ErrDispatcherClosed {
+		t.Errorf("expected ErrDispatcherClosed, got %v", err)
+	}
+}
+
+func TestDispatchAsyncBounded(t *testing.T) {
+	d := NewDispatcher(1, 1)
+
+	block := make(chan struct{})
+	started := make(chan struct{}, 1)
+	d.Add(func(e Event) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-block
+	}, 0)
+
+	if err := d.DispatchAsync(New("test", nil)); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	if err := d.DispatchAsync(New("test", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.DispatchAsync(New("test", nil)); err != ErrQueueFull {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+
+	close(block)
+	d.Shutdown(context.Background())
+}
+
+func TestDispatchAsyncLogsPanics(t *testing.T) {
+	var buf bytes.Buffer
+	d := NewDispatcher(1, 1, logging.WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+	d.Add(func(e Event) { panic("boom") }, 0)
+
+	if err := d.DispatchAsync(New("test", nil)); err != nil {
+		t.Fatal(err)
+	}
+	d.Shutdown(context.Background())
+
+	if out := buf.String(); !strings.Contains(out, "event handler panicked") || !strings.Contains(out, "boom") {
+		t.Errorf("expected the panic to be logged, got \"%s\"", out)
+	}
+}
+
+func TestZeroValueDispatcher(t *testing.T) {
+	var d DefaultDispatcher
+
+	var mu sync.Mutex
+	var calls []string
+	Listen(&d, LogoutEvent, func(e *Logout) {
+		mu.Lock()
+		calls = append(calls, "logout")
+		mu.Unlock()
+	}, 0)
+
+	d.Dispatch(NewLogout(httptest.NewRequest("POST", "/logout", nil), nil))
+	if err := d.DispatchAsync(NewLogout(httptest.NewRequest("POST", "/logout", nil), nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := d.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"logout", "logout"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+}
@@ -0,0 +1,327 @@
+package event
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/token"
+)
+
+const (
+	LoginSuccessEvent   = "security.login_success"
+	LoginFailureEvent   = "security.login_failure"
+	LogoutEvent         = "security.logout"
+	TokenRefreshedEvent = "security.token_refreshed"
+	AccessDeniedEvent   = "security.access_denied"
+	SwitchUserEvent     = "security.switch_user"
+	CheckPassportEvent  = "security.check_passport"
+
+	CredentialsExtractedEvent = "security.credentials_extracted"
+	IdentityResolvedEvent     = "security.identity_resolved"
+	PassportCheckedEvent      = "security.passport_checked"
+	TokenCreatedEvent         = "security.token_created"
+	SessionMigratedEvent      = "security.session_migrated"
+	TokenRevokedEvent         = "security.token_revoked"
+)
+
+// Event is dispatched to the handlers registered for its name. A handler may stop
+// the propagation, handlers with a lower priority are skipped then.
+type Event interface {
+	Name() string
+	Request() *http.Request
+	IsStopped() bool
+	Stop()
+}
+
+// Base implements propagation and request access for events embedding it
+type Base struct {
+	request *http.Request
+	stopped int32
+}
+
+func NewBase(r *http.Request) Base {
+	return Base{request: r}
+}
+
+func (e *Base) Request() *http.Request {
+	return e.request
+}
+
+func (e *Base) Stop() {
+	atomic.StoreInt32(&e.stopped, 1)
+}
+
+func (e *Base) IsStopped() bool {
+	return atomic.LoadInt32(&e.stopped) == 1
+}
+
+type firewallKey struct{}
+
+// WithFirewall records the name of the firewall handling the request, events
+// created for the request report it
+func WithFirewall(r *http.Request, name string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), firewallKey{}, name))
+}
+
+// FirewallName returns the name of the firewall handling the request, or an
+// empty string
+func FirewallName(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+
+	name, _ := r.Context().Value(firewallKey{}).(string)
+	return name
+}
+
+// Check is embedded by events that let handlers reject an authentication attempt
+type Check struct {
+	Base
+	err error
+}
+
+// Fail rejects the authentication attempt and stops the propagation
+func (e *Check) Fail(err error) {
+	e.err = err
+	e.Stop()
+}
+
+func (e *Check) Err() error {
+	return e.err
+}
+
+type namedEvent struct {
+	Base
+	name string
+}
+
+func (e *namedEvent) Name() string {
+	return e.name
+}
+
+// New creates an event without payload
+func New(name string, r *http.Request) Event {
+	return &namedEvent{Base: NewBase(r), name: name}
+}
+
+// LoginSuccess is dispatched after a request was authenticated. Authenticator is
+// the authenticator that issued the token, Firewall the name of the firewall
+// handling the request.
+type LoginSuccess struct {
+	Base
+	Token         token.Token
+	Authenticator interface{}
+	Firewall      string
+}
+
+func (e *LoginSuccess) Name() string {
+	return LoginSuccessEvent
+}
+
+func NewLoginSuccess(r *http.Request, tok token.Token, authenticator interface{}) *LoginSuccess {
+	return &LoginSuccess{Base: NewBase(r), Token: tok, Authenticator: authenticator, Firewall: FirewallName(r)}
+}
+
+// LoginFailure is dispatched after an authentication attempt failed
+type LoginFailure struct {
+	Base
+	Err           error
+	Reason        string
+	Username      string
+	Authenticator interface{}
+	Firewall      string
+}
+
+func (e *LoginFailure) Name() string {
+	return LoginFailureEvent
+}
+
+func NewLoginFailure(r *http.Request, err error, reason string, username string) *LoginFailure {
+	return &LoginFailure{Base: NewBase(r), Err: err, Reason: reason, Username: username, Firewall: FirewallName(r)}
+}
+
+// Logout is dispatched after a user logged out. Token is nil if the request was
+// not authenticated.
+type Logout struct {
+	Base
+	Token token.Token
+}
+
+func (e *Logout) Name() string {
+	return LogoutEvent
+}
+
+func NewLogout(r *http.Request, tok token.Token) *Logout {
+	return &Logout{Base: NewBase(r), Token: tok}
+}
+
+// TokenRefreshed is dispatched after the identity of a token was reloaded
+type TokenRefreshed struct {
+	Base
+	Previous token.Token
+	Token    token.Token
+}
+
+func (e *TokenRefreshed) Name() string {
+	return TokenRefreshedEvent
+}
+
+func NewTokenRefreshed(r *http.Request, previous token.Token, tok token.Token) *TokenRefreshed {
+	return &TokenRefreshed{Base: NewBase(r), Previous: previous, Token: tok}
+}
+
+// AccessDenied is dispatched if the access decision manager denied a request
+type AccessDenied struct {
+	Base
+	Token      token.Token
+	Attributes []interface{}
+	Subject    interface{}
+}
+
+func (e *AccessDenied) Name() string {
+	return AccessDeniedEvent
+}
+
+func NewAccessDenied(r *http.Request, tok token.Token, attributes []interface{}, subject interface{}) *AccessDenied {
+	return &AccessDenied{Base: NewBase(r), Token: tok, Attributes: attributes, Subject: subject}
+}
+
+// SwitchUser is dispatched when a user impersonates Target or, with Exit set,
+// returns to the original token
+type SwitchUser struct {
+	Base
+	Token  token.Token
+	Target identity.Identity
+	Exit   bool
+}
+
+func (e *SwitchUser) Name() string {
+	return SwitchUserEvent
+}
+
+func NewSwitchUser(r *http.Request, tok token.Token, target identity.Identity, exit bool) *SwitchUser {
+	return &SwitchUser{Base: NewBase(r), Token: tok, Target: target, Exit: exit}
+}
+
+// CredentialsExtracted is dispatched after an authenticator read the credentials
+// of a request. Handlers reject the attempt with Fail.
+type CredentialsExtracted struct {
+	Check
+	Credentials   interface{}
+	Authenticator interface{}
+}
+
+func (e *CredentialsExtracted) Name() string {
+	return CredentialsExtractedEvent
+}
+
+func NewCredentialsExtracted(r *http.Request, credentials interface{}, authenticator interface{}) *CredentialsExtracted {
+	return &CredentialsExtracted{Check: Check{Base: NewBase(r)}, Credentials: credentials, Authenticator: authenticator}
+}
+
+// IdentityResolved is dispatched after the identity of an authentication attempt
+// was loaded. Handlers reject the attempt with Fail.
+type IdentityResolved struct {
+	Check
+	Credentials   interface{}
+	Identity      identity.Identity
+	Authenticator interface{}
+}
+
+func (e *IdentityResolved) Name() string {
+	return IdentityResolvedEvent
+}
+
+func NewIdentityResolved(r *http.Request, credentials interface{}, id identity.Identity, authenticator interface{}) *IdentityResolved {
+	return &IdentityResolved{Check: Check{Base: NewBase(r)}, Credentials: credentials, Identity: id, Authenticator: authenticator}
+}
+
+// CheckPassport is dispatched after the pre authentication checks passed and before
+// the credentials are checked. Handlers reject the attempt with Fail.
+type CheckPassport struct {
+	Check
+	Credentials   interface{}
+	Identity      identity.Identity
+	Authenticator interface{}
+}
+
+func (e *CheckPassport) Name() string {
+	return CheckPassportEvent
+}
+
+func NewCheckPassport(r *http.Request, credentials interface{}, id identity.Identity, authenticator interface{}) *CheckPassport {
+	return &CheckPassport{Check: Check{Base: NewBase(r)}, Credentials: credentials, Identity: id, Authenticator: authenticator}
+}
+
+// PassportChecked is dispatched after the credentials and the post authentication
+// checks passed. Handlers reject the attempt with Fail.
+type PassportChecked struct {
+	Check
+	Credentials   interface{}
+	Identity      identity.Identity
+	Authenticator interface{}
+}
+
+func (e *PassportChecked) Name() string {
+	return PassportCheckedEvent
+}
+
+func NewPassportChecked(r *http.Request, credentials interface{}, id identity.Identity, authenticator interface{}) *PassportChecked {
+	return &PassportChecked{Check: Check{Base: NewBase(r)}, Credentials: credentials, Identity: id, Authenticator: authenticator}
+}
+
+// TokenCreated is dispatched after an authenticator issued a token. Handlers may
+// replace Token, e.g. to add scopes, or reject the attempt with Fail.
+type TokenCreated struct {
+	Check
+	Token         token.PostAuthToken
+	Identity      identity.Identity
+	Authenticator interface{}
+}
+
+func (e *TokenCreated) Name() string {
+	return TokenCreatedEvent
+}
+
+func NewTokenCreated(r *http.Request, tok token.PostAuthToken, id identity.Identity, authenticator interface{}) *TokenCreated {
+	return &TokenCreated{Check: Check{Base: NewBase(r)}, Token: tok, Identity: id, Authenticator: authenticator}
+}
+
+// SessionMigrated is dispatched after the session was given a new id on login.
+// The ids are empty for session stores without server side ids.
+type SessionMigrated struct {
+	Base
+	PreviousID string
+	ID         string
+}
+
+func (e *SessionMigrated) Name() string {
+	return SessionMigratedEvent
+}
+
+func NewSessionMigrated(r *http.Request, previousID string, id string) *SessionMigrated {
+	return &SessionMigrated{Base: NewBase(r), PreviousID: previousID, ID: id}
+}
+
+// TokenRevoked is dispatched after a token was revoked
+type TokenRevoked struct {
+	Base
+	Token token.Token
+}
+
+func (e *TokenRevoked) Name() string {
+	return TokenRevokedEvent
+}
+
+func NewTokenRevoked(r *http.Request, tok token.Token) *TokenRevoked {
+	return &TokenRevoked{Base: NewBase(r), Token: tok}
+}
+
+// Dispatch dispatches e if d is not nil
+func Dispatch(d Dispatcher, e Event) {
+	if d != nil {
+		d.Dispatch(e)
+	}
+}
@@ -3,19 +3,28 @@ package main
 import (
 	"context"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"text/template"
 	"time"
 
 	"github.com/gorilla/handlers"
-	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
+	"github.com/iwyg/goauth/audit"
 	"github.com/iwyg/goauth/authentication"
+	"github.com/iwyg/goauth/authorization"
+	"github.com/iwyg/goauth/event"
+	"github.com/iwyg/goauth/expression"
+	"github.com/iwyg/goauth/firewall"
+	goauthHttp "github.com/iwyg/goauth/http"
 	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/logging"
+	"github.com/iwyg/goauth/metrics"
 	"github.com/iwyg/goauth/role"
 	"github.com/iwyg/goauth/security"
 	"github.com/iwyg/goauth/session"
+	"github.com/iwyg/goauth/stack"
 	"github.com/iwyg/goauth/token"
 	"github.com/pkg/errors"
 )
@@ -40,10 +49,11 @@ var secureTemplate = template.Must(template.New("").Parse(`
 	<head>
 	</head>
   <body>
-    <h1>hello {{ . }} </h1>
-<ul>
-<li><a href="/logout">-> logout</a></li>
-</ul>
+    <h1>hello {{ .Message }} </h1>
+<form method="POST" action="/logout">
+  <input type="hidden" name="_csrf_token" value="{{ .CSRFToken }}"/>
+  <input type="submit" value="-> logout"/>
+</form>
 	</body>
 </html> `))
 var loginTemplate = template.Must(template.New("").Parse(`
@@ -53,10 +63,11 @@ var loginTemplate = template.Must(template.New("").Parse(`
 	</head>
   <body>
     <h1>please login </h1>
+{{ with .Error }}<p>{{ . }}</p>{{ end }}
 	  <form method="POST">
 		<label>
       email
-		  <input type="email" name="email"/>
+		  <input type="email" name="email" value="{{ .Username }}"/>
 	  </label>
 		<label>
       password
@@ -98,7 +109,6 @@ type idProvider struct {
 }
 
 func (i *idProvider) Provide(id interface{}) (identity.Identity, error) {
-	log.Printf("credentials, %#v\n", id)
 	cred, ok := id.(string)
 	if !ok {
 		return nil, errors.New("invalid credential")
@@ -120,6 +130,7 @@ func (i *idProvider) Supports(id identity.Identity) bool {
 }
 
 var sessStore *session.GorillaSessionProvider
+var hierarchy *role.DefaultHierarchy
 
 func recoverHandler(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
@@ -154,37 +165,48 @@ func init() {
 		&identity.InMemoryIdentity{},
 	)
 	token.Init()
-}
 
-func mergeM(middlewares ...[]mux.MiddlewareFunc) []mux.MiddlewareFunc {
-	var out []mux.MiddlewareFunc
-
-	for _, mw := range middlewares {
-		out = append(out, mw...)
+	var err error
+	hierarchy, err = role.NewHierarchy(map[role.Role][]role.Role{
+		role.RLAdmin: {role.RLUser},
+		role.RLUser:  {role.RLAnon},
+	})
+	if err != nil {
+		log.Fatal(err)
 	}
-
-	return out
 }
 
 func main() {
 
-	router := mux.NewRouter()
+	router := http.NewServeMux()
 	router.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
 		indexTemplate.Execute(w, "world")
 	}))
-	router.Handle("/login", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		loginTemplate.Execute(w, nil)
-	}))
+	logOpt := logging.WithLogger(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})))
 
-	router.Handle("/logout", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
-	}))
+	events := event.NewEventDispatcher()
+	audit.NewLogger(audit.NewHashChain(audit.NewJSONWriter(os.Stdout), "")).Subscribe(events)
 
 	sessCfg := session.Config{
 		Name:     "app",
 		TokenKey: "__security",
+		Events:   events,
 	}
 
+	router.Handle("/login", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := map[string]interface{}{}
+		if s, err := sessStore.Provide(r, sessCfg.Name); err == nil {
+			data["Error"] = session.Flash(s, authentication.LastErrorFlash)
+			data["Username"] = session.Flash(s, authentication.LastUsernameFlash)
+			sessStore.Save(w, r, s)
+		}
+		loginTemplate.Execute(w, data)
+	}))
+
 	users := make(map[string]identity.Identity)
 
 	users["admin@example.org"] = &identity.InMemoryIdentity{
@@ -209,59 +231,97 @@ func main() {
 
 	checker := security.NewBCryptPasswordChecker()
 
-	authHandler := authentication.NewAuthenticationHandlerMiddleware(
-		authentication.NewGuardRequestAuthenticator(
-			&token.RequestContextStoreProvider{},
-			[]authentication.Authenticator{
-				&delayedAuthenticator{
-					Authenticator: &authentication.DefaultLoginAuthenticator{
-						PasswordChecker: checker,
-						PasswordField:   "password",
-						CredentialField: "email",
-					},
-					delay: time.Second * 2,
-				},
-				&authentication.DefaultLoginAuthenticator{
-					PasswordChecker: checker,
-					PasswordField:   "password",
-					CredentialField: "email",
-				},
-				&authentication.DefaultLoginAuthenticator{
+	formLogin := func(a authentication.Authenticator) authentication.Authenticator {
+		return authentication.WithHandlers(a,
+			&authentication.FormLoginSuccessHandler{
+				TargetPathRedirect: authentication.TargetPathRedirect{Session: sessCfg, Sessions: sessStore},
+			},
+			&authentication.FormLoginFailureHandler{FailurePath: "/login", Session: sessCfg, Sessions: sessStore},
+		)
+	}
+
+	guard := authentication.NewGuardRequestAuthenticator(
+		&token.RequestContextStoreProvider{},
+		[]authentication.Authenticator{
+			formLogin(&delayedAuthenticator{
+				Authenticator: &authentication.DefaultLoginAuthenticator{
 					PasswordChecker: checker,
 					PasswordField:   "password",
 					CredentialField: "email",
 				},
-			},
-			idProvider,
-			identity.NewBaseIdentityChecker(),
-		),
-	)
-
-	router.Use(
-		//recoverHandler,
-		token.NewTokenStoreProviderMiddleware(),
-		session.NewSessionStartHandlerMiddleware(sessCfg, sessStore),
-		session.NewSessionReaderMiddleWare(sessCfg, sessStore),
+				delay: time.Second * 2,
+			}),
+			formLogin(&authentication.DefaultLoginAuthenticator{
+				PasswordChecker: checker,
+				PasswordField:   "password",
+				CredentialField: "email",
+			}),
+			formLogin(&authentication.DefaultLoginAuthenticator{
+				PasswordChecker: checker,
+				PasswordField:   "password",
+				CredentialField: "email",
+			}),
+		},
+		idProvider,
+		identity.NewBaseIdentityChecker(),
 	)
-
-	sec := router.PathPrefix("/secure").Subrouter()
-	sec.Handle("/{path:.*}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		secureTemplate.Execute(w, "cruel world. You are safe now")
+	guard.SetDispatcher(events)
+
+	collector := metrics.NewRegistry()
+	guard.SetCollector(collector)
+	router.Handle("/metrics", collector)
+
+	router.Handle("/secure/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := map[string]interface{}{"Message": "cruel world. You are safe now"}
+		if s, err := sessStore.Provide(r, sessCfg.Name); err == nil {
+			data["CSRFToken"], _ = session.CSRFToken(s, authentication.DefaultLogoutCSRFTokenID)
+			sessStore.Save(w, r, s)
+		}
+		secureTemplate.Execute(w, data)
 	}))
 
-	router.Use(
-		authHandler,
-		authentication.NewLogoutHandler("/logout"),
-		session.NewSessionWriterMiddleWare(sessCfg, sessStore),
-		session.NewSessionSaveHandlerMiddleware(sessCfg, sessStore),
-		authentication.NewRedirectLoggedIn("/login"),
-	)
-
-	sec.Use(
-		authentication.NewLoginRedirectHandler("/login"),
-	)
-
-	out := handlers.CombinedLoggingHandler(os.Stdout, router)
+	exprVoter := &expression.Voter{Hierarchy: hierarchy}
+	adm := authorization.NewHierarchyAccessDecisionManager(hierarchy, exprVoter)
+	exprVoter.Manager = adm
+
+	// the stack runs the middlewares in the order they depend on each other
+	security := stack.New(logOpt).
+		TokenStore().
+		Session(sessCfg, sessStore).
+		Authentication(guard).
+		Logout(&authentication.LogoutConfig{
+			Path:          "/logout",
+			CSRFParameter: "_csrf_token",
+			Session:       sessCfg,
+			Sessions:      sessStore,
+			Handlers: []authentication.LogoutHandler{
+				&authentication.SessionLogoutHandler{Session: sessCfg, Sessions: sessStore},
+				authentication.NewRememberMeLogoutHandler(""),
+			},
+			Events: events,
+		}).
+		LoggedInRedirect("/login", &authentication.TargetPathRedirect{
+			Session:  sessCfg,
+			Sessions: sessStore,
+		}).
+		AccessControl(
+			firewall.NewAccessMap(
+				&firewall.AccessRule{
+					Matcher:    goauthHttp.PathPrefix("/secure/admin"),
+					Attributes: []interface{}{expression.MustParse("has_role('ROLE_ADMIN') and request.method in ['GET', 'HEAD']")},
+				},
+				&firewall.AccessRule{
+					Matcher:    goauthHttp.PathPrefix("/secure"),
+					Attributes: []interface{}{authorization.IsAuthenticatedFully},
+				},
+			),
+			adm,
+			&firewall.FormLoginEntryPoint{LoginPath: "/login", Session: sessCfg, Sessions: sessStore},
+			&firewall.ForbiddenHandler{},
+		).
+		MustBuild()
+
+	out := handlers.CombinedLoggingHandler(os.Stdout, security(router))
 
 	log.Printf("start listening on 127.0.0.0:8005\n")
 	log.Fatal(http.ListenAndServe("localhost:8005", out))
@@ -0,0 +1,251 @@
+package expression
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type node interface {
+	typ() valueType
+	eval(env *Env) (interface{}, error)
+	String() string
+}
+
+type literal struct {
+	val interface{}
+	t   valueType
+}
+
+func (n *literal) typ() valueType {
+	return n.t
+}
+
+func (n *literal) eval(env *Env) (interface{}, error) {
+	return n.val, nil
+}
+
+func (n *literal) String() string {
+	switch v := n.val.(type) {
+	case string:
+		return strconv.Quote(v)
+	case nil:
+		return "null"
+	}
+
+	return fmt.Sprintf("%v", n.val)
+}
+
+type list struct {
+	items []node
+}
+
+func (n *list) typ() valueType {
+	return tList
+}
+
+func (n *list) eval(env *Env) (interface{}, error) {
+	out := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		v, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+
+	return out, nil
+}
+
+func (n *list) String() string {
+	items := make([]string, len(n.items))
+	for i, item := range n.items {
+		items[i] = item.String()
+	}
+
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+type varNode struct {
+	name string
+	v    *variable
+}
+
+func (n *varNode) typ() valueType {
+	if n.v.fields == nil {
+		return tAny
+	}
+
+	return tObject
+}
+
+func (n *varNode) eval(env *Env) (interface{}, error) {
+	return n.v.resolve(env), nil
+}
+
+func (n *varNode) String() string {
+	return n.name
+}
+
+type member struct {
+	obj   node
+	field string
+	t     valueType
+}
+
+func (n *member) typ() valueType {
+	return n.t
+}
+
+func (n *member) eval(env *Env) (interface{}, error) {
+	obj, err := n.obj.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	return field(obj, n.field), nil
+}
+
+func (n *member) String() string {
+	return n.obj.String() + "." + n.field
+}
+
+type call struct {
+	name string
+	fn   *function
+	args []node
+}
+
+func (n *call) typ() valueType {
+	return n.fn.result
+}
+
+func (n *call) eval(env *Env) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, a := range n.args {
+		v, err := a.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	return n.fn.call(env, args)
+}
+
+func (n *call) String() string {
+	args := make([]string, len(n.args))
+	for i, a := range n.args {
+		args[i] = a.String()
+	}
+
+	return n.name + "(" + strings.Join(args, ", ") + ")"
+}
+
+type unary struct {
+	x node
+}
+
+func (n *unary) typ() valueType {
+	return tBool
+}
+
+func (n *unary) eval(env *Env) (interface{}, error) {
+	v, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := toBool(v)
+
+	return !b, err
+}
+
+func (n *unary) String() string {
+	return "not " + n.x.String()
+}
+
+type binary struct {
+	op   string
+	l, r node
+}
+
+func (n *binary) typ() valueType {
+	return tBool
+}
+
+func (n *binary) eval(env *Env) (interface{}, error) {
+	l, err := n.l.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "and", "or":
+		lb, err := toBool(l)
+		if err != nil {
+			return nil, err
+		}
+		if (n.op == "and") != lb {
+			return lb, nil
+		}
+		r, err := n.r.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		return toBool(r)
+	}
+
+	r, err := n.r.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// comparisons with the null literal check for null, any other comparison
+	// with null is false
+	if isNullLiteral(n.l) || isNullLiteral(n.r) {
+		switch n.op {
+		case "==":
+			return isNull(l) && isNull(r), nil
+		case "!=":
+			return isNull(l) != isNull(r), nil
+		}
+	}
+
+	if (n.op == "!=" || n.op == "in") && isNull(l) {
+		return false, nil
+	}
+
+	switch n.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !isNull(r) && !equal(l, r), nil
+	case "in":
+		items, ok := toList(r)
+		if !ok {
+			return nil, &EvalError{Msg: fmt.Sprintf("cannot search in %T", r)}
+		}
+		for _, item := range items {
+			if equal(l, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if l == nil || r == nil {
+		return false, nil
+	}
+
+	return compare(n.op, l, r)
+}
+
+func isNullLiteral(n node) bool {
+	lit, ok := n.(*literal)
+	return ok && lit.t == tNull
+}
+
+func (n *binary) String() string {
+	return "(" + n.l.String() + " " + n.op + " " + n.r.String() + ")"
+}
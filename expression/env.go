@@ -0,0 +1,207 @@
+package expression
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/iwyg/goauth/authorization"
+	httpUtil "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+)
+
+// Env is the data an expression is evaluated against. If Hierarchy is set the
+// token's roles are resolved against it.
+type Env struct {
+	Context   context.Context
+	Token     token.Token
+	Request   *http.Request
+	Subject   interface{}
+	Manager   authorization.AccessDecisionManager
+	Hierarchy role.Hierarchy
+}
+
+func (env *Env) roles() []role.Role {
+	if env.Token == nil {
+		return nil
+	}
+
+	return role.Reachable(env.Hierarchy, env.Token.Roles())
+}
+
+type variable struct {
+	fields  map[string]valueType
+	resolve func(env *Env) interface{}
+}
+
+var variables = map[string]*variable{
+	"user": {
+		fields: map[string]valueType{
+			"id":         tAny,
+			"credential": tAny,
+			"roles":      tList,
+		},
+		resolve: func(env *Env) interface{} {
+			it, ok := env.Token.(token.IdentityToken)
+			if !ok || it.Identity() == nil {
+				return nil
+			}
+
+			id := it.Identity()
+			roles := make([]interface{}, 0)
+			for _, r := range env.roles() {
+				roles = append(roles, string(r))
+			}
+
+			return map[string]interface{}{
+				"id":         id.ID(),
+				"credential": id.Credential(),
+				"roles":      roles,
+			}
+		},
+	},
+	"request": {
+		fields: map[string]valueType{
+			"method": tString,
+			"path":   tString,
+			"host":   tString,
+			"ip":     tString,
+			"scheme": tString,
+		},
+		resolve: func(env *Env) interface{} {
+			r := env.Request
+			if r == nil {
+				return nil
+			}
+
+			scheme := "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+
+			return map[string]interface{}{
+				"method": r.Method,
+				"path":   r.URL.Path,
+				"host":   r.Host,
+				"ip":     httpUtil.ClientIPString(r),
+				"scheme": scheme,
+			}
+		},
+	},
+	"subject": {
+		resolve: func(env *Env) interface{} {
+			return env.Subject
+		},
+	},
+}
+
+// function params are checked at parse time. Optional is the number of trailing
+// params that may be omitted, variadic functions repeat their last param.
+type function struct {
+	params   []valueType
+	optional int
+	variadic bool
+	result   valueType
+	call     func(env *Env, args []interface{}) (interface{}, error)
+}
+
+func hasRole(env *Env, want string) bool {
+	for _, r := range env.roles() {
+		if string(r) == want {
+			return true
+		}
+	}
+
+	return false
+}
+
+func stringArg(v interface{}) (string, error) {
+	s, ok := toString(v)
+	if !ok {
+		return "", &EvalError{Msg: "expected string argument"}
+	}
+
+	return s, nil
+}
+
+var functions = map[string]*function{
+	"has_role": {
+		params: []valueType{tString},
+		result: tBool,
+		call: func(env *Env, args []interface{}) (interface{}, error) {
+			r, err := stringArg(args[0])
+			return err == nil && hasRole(env, r), err
+		},
+	},
+	"has_any_role": {
+		params:   []valueType{tString},
+		variadic: true,
+		result:   tBool,
+		call: func(env *Env, args []interface{}) (interface{}, error) {
+			for _, a := range args {
+				r, err := stringArg(a)
+				if err != nil {
+					return false, err
+				}
+				if hasRole(env, r) {
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+	},
+	"has_scope": {
+		params: []valueType{tString},
+		result: tBool,
+		call: func(env *Env, args []interface{}) (interface{}, error) {
+			s, err := stringArg(args[0])
+			if err != nil {
+				return false, err
+			}
+			return env.Token != nil && env.Token.IsFullyAuthenticated() && token.HasScopes(env.Token, token.Scope(s)), nil
+		},
+	},
+	"is_authenticated": {
+		result: tBool,
+		call: func(env *Env, args []interface{}) (interface{}, error) {
+			return authorization.IsFullyAuthenticated(env.Token) || authorization.IsRemembered(env.Token), nil
+		},
+	},
+	"is_fully_authenticated": {
+		result: tBool,
+		call: func(env *Env, args []interface{}) (interface{}, error) {
+			return authorization.IsFullyAuthenticated(env.Token), nil
+		},
+	},
+	"is_anonymous": {
+		result: tBool,
+		call: func(env *Env, args []interface{}) (interface{}, error) {
+			return authorization.IsAnonymousToken(env.Token), nil
+		},
+	},
+	"is_remember_me": {
+		result: tBool,
+		call: func(env *Env, args []interface{}) (interface{}, error) {
+			return authorization.IsRemembered(env.Token), nil
+		},
+	},
+	"is_granted": {
+		params:   []valueType{tAny, tAny},
+		optional: 1,
+		result:   tBool,
+		call: func(env *Env, args []interface{}) (interface{}, error) {
+			if env.Manager == nil {
+				return false, &EvalError{Msg: "is_granted requires an access decision manager"}
+			}
+			subject := env.Subject
+			if len(args) == 2 {
+				subject = args[1]
+			}
+			ctx := env.Context
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			return env.Manager.IsGranted(ctx, env.Token, args[0], subject), nil
+		},
+	},
+}
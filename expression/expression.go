@@ -0,0 +1,98 @@
+package expression
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/iwyg/goauth/authorization"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+)
+
+// Expression is a parsed access rule, e.g.
+//
+//	has_role('ROLE_ADMIN') or (is_fully_authenticated() and subject.owner_id == user.id)
+//
+// Variables are user (id, credential, roles), request (method, path, host, ip, scheme)
+// and subject, whose fields are resolved at runtime.
+type Expression struct {
+	src  string
+	root node
+}
+
+// Parse parses and type checks an expression. Unknown functions, variables and
+// fields as well as type errors are reported here rather than at evaluation.
+func Parse(src string) (*Expression, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tkEOF {
+		return nil, &SyntaxError{Pos: t.pos, Msg: "unexpected " + t.val}
+	}
+
+	if err := expectType(root, tBool, 0, "expression"); err != nil {
+		return nil, err
+	}
+
+	return &Expression{src: src, root: root}, nil
+}
+
+func MustParse(src string) *Expression {
+	e, err := Parse(src)
+	if err != nil {
+		panic(err)
+	}
+
+	return e
+}
+
+func (e *Expression) String() string {
+	return e.src
+}
+
+func (e *Expression) Evaluate(env *Env) (bool, error) {
+	v, err := e.root.eval(env)
+	if err != nil {
+		return false, err
+	}
+
+	return toBool(v)
+}
+
+// Voter grants *Expression attributes that evaluate to true. Manager is used by
+// is_granted() and may be the manager the voter is registered with, Hierarchy
+// resolves the roles seen by has_role() and user.roles.
+type Voter struct {
+	Manager   authorization.AccessDecisionManager
+	Hierarchy role.Hierarchy
+}
+
+func (v *Voter) Vote(ctx context.Context, tok token.Token, attribute interface{}, subject interface{}) authorization.Vote {
+	e, ok := attribute.(*Expression)
+	if !ok {
+		return authorization.AccessAbstain
+	}
+
+	env := &Env{Context: ctx, Token: tok, Subject: subject, Manager: v.Manager, Hierarchy: v.Hierarchy}
+
+	if r, ok := subject.(*http.Request); ok {
+		env.Request = r
+		env.Subject = nil
+	} else if r, ok := authorization.RequestFromContext(ctx); ok {
+		env.Request = r
+	}
+
+	if granted, err := e.Evaluate(env); err != nil || !granted {
+		return authorization.AccessDenied
+	}
+
+	return authorization.AccessGranted
+}
@@ -0,0 +1,183 @@
+package expression
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iwyg/goauth/authorization"
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+)
+
+type document struct {
+	OwnerID string `json:"owner_id"`
+	deleted bool
+}
+
+func (d *document) Delete() bool {
+	d.deleted = true
+	return true
+}
+
+type resolvedDocument struct{}
+
+func (resolvedDocument) ExpressionField(name string) (interface{}, bool) {
+	if name == "status" {
+		return "published", true
+	}
+
+	return nil, false
+}
+
+type namedDocument struct {
+	called *bool
+}
+
+func (d namedDocument) String() string {
+	*d.called = true
+	return "doc"
+}
+
+func TestEvaluate(t *testing.T) {
+	owner := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserId: "u1", UserRoles: []role.Role{role.RLUser}})
+	admin := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserId: "u2", UserRoles: []role.Role{role.RLAdmin}})
+	other := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserId: "u3", UserRoles: []role.Role{role.RLUser}})
+
+	e := MustParse("has_role('ROLE_ADMIN') or (is_fully_authenticated() and subject.owner_id == user.id)")
+	doc := &document{OwnerID: "u1"}
+
+	tests := []struct {
+		tok      token.Token
+		expected bool
+	}{
+		{owner, true},
+		{admin, true},
+		{other, false},
+		{token.NewAnonymousToken(), false},
+	}
+
+	for i, tt := range tests {
+		granted, err := e.Evaluate(&Env{Token: tt.tok, Subject: doc})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if granted != tt.expected {
+			t.Errorf("%d: expected %v, got %v", i, tt.expected, granted)
+		}
+	}
+}
+
+func TestNullNeverEquals(t *testing.T) {
+	e := MustParse("subject.owner_id == user.id")
+	var nilDoc *document
+	noID := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserRoles: []role.Role{role.RLUser}})
+
+	tests := []struct {
+		name    string
+		tok     token.Token
+		subject interface{}
+	}{
+		{"anonymous without subject", token.NewAnonymousToken(), nil},
+		{"anonymous with nil subject", token.NewAnonymousToken(), nilDoc},
+		{"no token", nil, map[string]interface{}{}},
+		{"identity without id", noID, map[string]interface{}{}},
+	}
+
+	for _, tt := range tests {
+		granted, err := e.Evaluate(&Env{Token: tt.tok, Subject: tt.subject})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if granted {
+			t.Errorf("%s: expected null not to equal null", tt.name)
+		}
+	}
+
+	for src, expected := range map[string]bool{
+		"subject.owner_id == null":         true,
+		"subject.owner_id != null":         false,
+		"subject.owner_id != 'u1'":         false,
+		"subject.owner_id in ['u1', null]": false,
+		"null == null":                     true,
+	} {
+		granted, err := MustParse(src).Evaluate(&Env{Subject: nilDoc})
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+
+		if granted != expected {
+			t.Errorf("%s: expected %v, got %v", src, expected, granted)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		"unknown()",
+		"has_role(1)",
+		"has_role()",
+		"'a' and true",
+		"not 'a'",
+		"user.unknown == 1",
+		"request.path > 1",
+		"has_role('ROLE_USER'",
+		"user.roles",
+	} {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("expected %q to fail", src)
+		}
+	}
+}
+
+func TestVoter(t *testing.T) {
+	v := &Voter{}
+	m := authorization.NewDefaultAccessDecisionManager(v)
+	v.Manager = m
+
+	tok := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserRoles: []role.Role{role.RLUser}})
+	e := MustParse("is_granted('ROLE_USER') and 'ROLE_USER' in user.roles")
+
+	if !m.IsGranted(context.Background(), tok, e, nil) {
+		t.Error("expected expression to be granted")
+	}
+}
+
+func TestSubjectFields(t *testing.T) {
+	doc := &document{OwnerID: "u1"}
+	var nilDoc *document
+
+	tests := []struct {
+		src      string
+		subject  interface{}
+		expected bool
+	}{
+		{"subject.owner_id == 'u1'", doc, true},
+		{"subject.delete == true", doc, false},
+		{"subject.owner_id == 'u1'", nilDoc, false},
+		{"subject.status == 'published'", resolvedDocument{}, true},
+		{"subject.other == 'published'", resolvedDocument{}, false},
+	}
+
+	for _, tt := range tests {
+		granted, err := MustParse(tt.src).Evaluate(&Env{Subject: tt.subject})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.src, err)
+		}
+
+		if granted != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.src, tt.expected, granted)
+		}
+	}
+
+	if doc.deleted {
+		t.Error("expected expressions not to call subject methods")
+	}
+
+	var called bool
+	if granted, err := MustParse("subject == 'doc'").Evaluate(&Env{Subject: namedDocument{called: &called}}); err != nil || granted || called {
+		t.Errorf("expected String not to be called, got %v %v %v", granted, err, called)
+	}
+}
@@ -0,0 +1,287 @@
+package expression
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type parser struct {
+	tokens []lexeme
+	pos    int
+}
+
+func (p *parser) peek() lexeme {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() lexeme {
+	t := p.tokens[p.pos]
+	if t.kind != tkEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+func (p *parser) is(vals ...string) bool {
+	t := p.peek()
+	if t.kind != tkOperator && t.kind != tkPunct && t.kind != tkIdent {
+		return false
+	}
+
+	for _, v := range vals {
+		if t.val == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *parser) expect(val string) error {
+	t := p.next()
+	if t.val != val || t.kind == tkString {
+		return &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("expected %q, got %q", val, t.val)}
+	}
+
+	return nil
+}
+
+func expectType(n node, want valueType, pos int, what string) error {
+	if !assignable(n.typ(), want) {
+		return &TypeError{Pos: pos, Msg: fmt.Sprintf("%s expects %s, got %s", what, want, n.typ())}
+	}
+
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.is("or", "||") {
+		t := p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := expectType(l, tBool, t.pos, "or"); err != nil {
+			return nil, err
+		}
+		if err := expectType(r, tBool, t.pos, "or"); err != nil {
+			return nil, err
+		}
+		l = &binary{op: "or", l: l, r: r}
+	}
+
+	return l, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.is("and", "&&") {
+		t := p.next()
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if err := expectType(l, tBool, t.pos, "and"); err != nil {
+			return nil, err
+		}
+		if err := expectType(r, tBool, t.pos, "and"); err != nil {
+			return nil, err
+		}
+		l = &binary{op: "and", l: l, r: r}
+	}
+
+	return l, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.is("not", "!") {
+		t := p.next()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if err := expectType(x, tBool, t.pos, "not"); err != nil {
+			return nil, err
+		}
+		return &unary{x: x}, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	l, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.is("==", "!=", "<", "<=", ">", ">=", "in") {
+		return l, nil
+	}
+
+	t := p.next()
+	r, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.val {
+	case "in":
+		if err := expectType(r, tList, t.pos, "in"); err != nil {
+			return nil, err
+		}
+	case "<", "<=", ">", ">=":
+		for _, n := range []node{l, r} {
+			if nt := n.typ(); nt != tAny && nt != tNumber && nt != tString {
+				return nil, &TypeError{Pos: t.pos, Msg: fmt.Sprintf("%s expects number or string, got %s", t.val, nt)}
+			}
+		}
+		if l.typ() != tAny && r.typ() != tAny && l.typ() != r.typ() {
+			return nil, &TypeError{Pos: t.pos, Msg: fmt.Sprintf("cannot compare %s with %s", l.typ(), r.typ())}
+		}
+	}
+
+	return &binary{op: t.val, l: l, r: r}, nil
+}
+
+func (p *parser) parseArgs(end string) ([]node, error) {
+	var args []node
+	if p.is(end) {
+		p.next()
+		return args, nil
+	}
+
+	for {
+		a, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, a)
+
+		if p.is(",") {
+			p.next()
+			continue
+		}
+
+		return args, p.expect(end)
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tkString:
+		return &literal{val: t.val, t: tString}, nil
+	case tkNumber:
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("invalid number %q", t.val)}
+		}
+		return &literal{val: f, t: tNumber}, nil
+	case tkPunct:
+		switch t.val {
+		case "(":
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return n, p.expect(")")
+		case "[":
+			items, err := p.parseArgs("]")
+			if err != nil {
+				return nil, err
+			}
+			return &list{items: items}, nil
+		}
+	case tkIdent:
+		switch t.val {
+		case "true", "false":
+			return &literal{val: t.val == "true", t: tBool}, nil
+		case "null":
+			return &literal{val: nil, t: tNull}, nil
+		}
+
+		if p.is("(") {
+			p.next()
+			return p.parseCall(t)
+		}
+
+		return p.parseMember(t)
+	}
+
+	return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %q", t.val)}
+}
+
+func (p *parser) parseCall(t lexeme) (node, error) {
+	fn, ok := functions[t.val]
+	if !ok {
+		return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unknown function %q", t.val)}
+	}
+
+	args, err := p.parseArgs(")")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) < len(fn.params)-fn.optional || (!fn.variadic && len(args) > len(fn.params)) {
+		return nil, &TypeError{Pos: t.pos, Msg: fmt.Sprintf("%s called with %d arguments", t.val, len(args))}
+	}
+
+	for i, a := range args {
+		want := fn.params[len(fn.params)-1]
+		if i < len(fn.params) {
+			want = fn.params[i]
+		}
+		if err := expectType(a, want, t.pos, fmt.Sprintf("argument %d of %s", i+1, t.val)); err != nil {
+			return nil, err
+		}
+	}
+
+	return &call{name: t.val, fn: fn, args: args}, nil
+}
+
+func (p *parser) parseMember(t lexeme) (node, error) {
+	v, ok := variables[t.val]
+	if !ok {
+		return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unknown variable %q", t.val)}
+	}
+
+	var n node = &varNode{name: t.val, v: v}
+	fields := v.fields
+
+	for p.is(".") {
+		p.next()
+		f := p.next()
+		if f.kind != tkIdent {
+			return nil, &SyntaxError{Pos: f.pos, Msg: "expected field name"}
+		}
+
+		ft := tAny
+		switch n.typ() {
+		case tObject:
+			var known bool
+			if ft, known = fields[f.val]; !known {
+				return nil, &TypeError{Pos: f.pos, Msg: fmt.Sprintf("%s has no field %q", n, f.val)}
+			}
+		case tAny:
+		default:
+			return nil, &TypeError{Pos: f.pos, Msg: fmt.Sprintf("cannot access field %q of %s", f.val, n.typ())}
+		}
+
+		fields = nil
+		n = &member{obj: n, field: f.val, t: ft}
+	}
+
+	return n, nil
+}
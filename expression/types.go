@@ -0,0 +1,249 @@
+package expression
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type valueType int
+
+const (
+	tAny valueType = iota
+	tBool
+	tString
+	tNumber
+	tList
+	tNull
+	tObject
+)
+
+func (t valueType) String() string {
+	switch t {
+	case tBool:
+		return "bool"
+	case tString:
+		return "string"
+	case tNumber:
+		return "number"
+	case tList:
+		return "list"
+	case tNull:
+		return "null"
+	case tObject:
+		return "object"
+	}
+
+	return "any"
+}
+
+func assignable(have, want valueType) bool {
+	return have == want || have == tAny || want == tAny
+}
+
+type TypeError struct {
+	Pos int
+	Msg string
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("type error at position %d: %s", e.Pos, e.Msg)
+}
+
+// EvalError is returned for failures that can only be detected at runtime,
+// e.g. comparing a subject field of the wrong type
+type EvalError struct {
+	Msg string
+}
+
+func (e *EvalError) Error() string {
+	return "evaluation error: " + e.Msg
+}
+
+func toBool(v interface{}) (bool, error) {
+	b, ok := v.(bool)
+	if !ok {
+		return false, &EvalError{Msg: fmt.Sprintf("expected bool, got %T", v)}
+	}
+
+	return b, nil
+}
+
+func toNumber(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+
+	return 0, false
+}
+
+// toString converts values of string kind, it never calls String methods of
+// subjects, see FieldResolver
+func toString(v interface{}) (string, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.String {
+		return rv.String(), true
+	}
+
+	return "", false
+}
+
+// equal compares two values, null equals nothing, not even null, so a missing
+// subject field never matches a missing user field. Use the null literal to
+// check for null, see binary.
+func equal(a, b interface{}) bool {
+	if isNull(a) || isNull(b) {
+		return false
+	}
+
+	if na, ok := toNumber(a); ok {
+		nb, ok := toNumber(b)
+		return ok && na == nb
+	}
+
+	if sa, ok := toString(a); ok {
+		sb, ok := toString(b)
+		return ok && sa == sb
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// isNull reports whether v is nil or a nil pointer, map, slice or interface
+func isNull(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	}
+
+	return false
+}
+
+func compare(op string, a, b interface{}) (bool, error) {
+	var c int
+
+	if na, ok := toNumber(a); ok {
+		nb, ok := toNumber(b)
+		if !ok {
+			return false, &EvalError{Msg: fmt.Sprintf("cannot compare %T with %T", a, b)}
+		}
+		switch {
+		case na < nb:
+			c = -1
+		case na > nb:
+			c = 1
+		}
+	} else if sa, ok := toString(a); ok {
+		sb, ok := toString(b)
+		if !ok {
+			return false, &EvalError{Msg: fmt.Sprintf("cannot compare %T with %T", a, b)}
+		}
+		c = strings.Compare(sa, sb)
+	} else {
+		return false, &EvalError{Msg: fmt.Sprintf("cannot compare %T", a)}
+	}
+
+	switch op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	}
+
+	return c >= 0, nil
+}
+
+func toList(v interface{}) ([]interface{}, bool) {
+	if l, ok := v.([]interface{}); ok {
+		return l, true
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	out := make([]interface{}, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+
+	return out, true
+}
+
+func normalizeName(s string) string {
+	return strings.ToLower(strings.Replace(s, "_", "", -1))
+}
+
+// FieldResolver lets a subject expose computed fields to expressions. Only
+// fields it resolves are visible, methods are never called by reflection.
+type FieldResolver interface {
+	ExpressionField(name string) (interface{}, bool)
+}
+
+// field resolves a member of maps and structs (by json tag or name), or of a
+// FieldResolver. Names are matched ignoring case and underscores, so owner_id
+// resolves OwnerID.
+func field(v interface{}, name string) interface{} {
+	if v == nil {
+		return nil
+	}
+
+	if m, ok := v.(map[string]interface{}); ok {
+		return m[name]
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+
+	if fr, ok := v.(FieldResolver); ok {
+		val, _ := fr.ExpressionField(name)
+		return val
+	}
+
+	want := normalizeName(name)
+
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		val := rv.MapIndex(reflect.ValueOf(name).Convert(rv.Type().Key()))
+		if !val.IsValid() {
+			return nil
+		}
+		return val.Interface()
+	case reflect.Struct:
+		t := rv.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			tag := strings.Split(f.Tag.Get("json"), ",")[0]
+			if tag == name || normalizeName(f.Name) == want {
+				return rv.Field(i).Interface()
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package firewall
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/iwyg/goauth/authentication"
+	"github.com/iwyg/goauth/authorization"
+	"github.com/iwyg/goauth/event"
+	http2 "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/logging"
+	"github.com/iwyg/goauth/metrics"
+	"github.com/iwyg/goauth/token"
+)
+
+// AccessRule protects all requests matched by Matcher. Attributes are decided by
+// the access decision manager with the request as subject, so they may be roles,
+// authentication states or expressions. A rule without attributes is public.
+// Channel "https" redirects plain http requests with a temporary redirect, so
+// browsers do not cache it, behind a trusted proxy the scheme is resolved by
+// http.IsSecure. IPs restricts the client addresses (single IPs or CIDR ranges)
+// that may access the resource, the client address is resolved by http.ClientIP.
+// IPs are parsed when the rule is added to an AccessMap. Name labels the rule in
+// metrics.
+type AccessRule struct {
+	Name       string
+	Matcher    http2.RequestMatcher
+	Attributes []interface{}
+	Channel    string
+	IPs        []string
+
+	ranges http2.IPRanges
+}
+
+// allowsIP reports whether the client address is in the parsed ranges, a rule
+// with IPs that was never added to a map allows no address
+func (a *AccessRule) allowsIP(r *http.Request) bool {
+	if len(a.IPs) == 0 {
+		return true
+	}
+
+	return a.ranges.Contains(http2.ClientIP(r))
+}
+
+// AccessMap is an ordered list of access rules, the first matching rule applies
+type AccessMap struct {
+	rules []*AccessRule
+}
+
+// NewAccessMap creates a map of the given rules, it panics if a rule has invalid IPs
+func NewAccessMap(rules ...*AccessRule) *AccessMap {
+	m := &AccessMap{}
+	for _, rule := range rules {
+		if err := m.Add(rule); err != nil {
+			panic(err)
+		}
+	}
+
+	return m
+}
+
+// Add appends rule, it returns an error if rule has invalid IPs
+func (m *AccessMap) Add(rule *AccessRule) error {
+	ranges, err := http2.ParseIPRanges(rule.IPs...)
+	if err != nil {
+		return err
+	}
+
+	rule.ranges = ranges
+	m.rules = append(m.rules, rule)
+
+	return nil
+}
+
+func (m *AccessMap) Rule(r *http.Request) *AccessRule {
+	for _, rule := range m.rules {
+		if rule.Matcher.Matches(r) {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+// httpsHost strips the port of host, the port of the plain http request does
+// not serve https
+func httpsHost(host string) string {
+	h, _, err := net.SplitHostPort(host)
+	if err != nil {
+		return host
+	}
+
+	if strings.Contains(h, ":") {
+		return "[" + h + "]"
+	}
+
+	return h
+}
+
+// AccessListener enforces the first access rule matching a request. It returns
+// AuthorisationRequired for unauthenticated users and AccessDenied for authenticated
+// users without permission.
+type AccessListener struct {
+	Map     *AccessMap
+	Manager authorization.AccessDecisionManager
+	Events  event.Dispatcher
+	Metrics metrics.Collector
+}
+
+func (a *AccessListener) denied(rule *AccessRule) {
+	name := rule.Name
+	if name == "" {
+		name = "unnamed"
+	}
+
+	metrics.Count(a.Metrics, metrics.AccessDenied, metrics.Labels{"rule": name})
+}
+
+func (a *AccessListener) Handle(r *http.Request) (http.Handler, error) {
+	rule := a.Map.Rule(r)
+	if rule == nil {
+		return nil, nil
+	}
+
+	if rule.Channel == "https" && !http2.IsSecure(r) {
+		u := *r.URL
+		u.Scheme = "https"
+		u.Host = httpsHost(r.Host)
+		return http.RedirectHandler(u.String(), http.StatusTemporaryRedirect), nil
+	}
+
+	var tok token.Token
+	if store, err := token.TokenStoreFromRequest(r); err == nil {
+		tok, _ = store.Read()
+	}
+
+	if !rule.allowsIP(r) {
+		a.denied(rule)
+		event.Dispatch(a.Events, event.NewAccessDenied(r, tok, rule.Attributes, r))
+		return nil, authentication.NewAccessDeniedError("client address not allowed", tok)
+	}
+
+	if len(rule.Attributes) == 0 || a.Manager.Decide(authorization.WithRequest(r.Context(), r), tok, rule.Attributes, r) {
+		return nil, nil
+	}
+
+	// unauthenticated requests are sent to the entry point, they are not denied
+	if !authorization.IsFullyAuthenticated(tok) {
+		return nil, NewAuthorisationRequired(tok)
+	}
+
+	a.denied(rule)
+	event.Dispatch(a.Events, event.NewAccessDenied(r, tok, rule.Attributes, r))
+	return nil, authentication.NewAccessDeniedError("access denied", tok)
+}
+
+// NewAccessControlMiddleware enforces the access map outside of a firewall.
+// Unauthenticated users are sent to the entry point, authenticated users without
+// permission to the access denied handler.
+func NewAccessControlMiddleware(
+	accessMap *AccessMap,
+	adm authorization.AccessDecisionManager,
+	entryPoint EntryPoint,
+	deniedHandler AccessDeniedHandler,
+	opts ...logging.Option,
+) func(http.Handler) http.Handler {
+	l := &AccessListener{Map: accessMap, Manager: adm}
+	fw := &Firewall{EntryPoint: entryPoint, AccessDenied: deniedHandler, logger: logging.New(opts...)}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h, err := l.Handle(r)
+
+			switch {
+			case err != nil:
+				fw.HandleError(w, r, err)
+			case h != nil:
+				h.ServeHTTP(w, r)
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package firewall
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iwyg/goauth/authorization"
+	"github.com/iwyg/goauth/event"
+	http2 "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/metrics"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+)
+
+func TestAccessMapFirstRuleApplies(t *testing.T) {
+	admin := &AccessRule{Name: "admin", Matcher: http2.PathPrefix("/admin")}
+	all := &AccessRule{Name: "all", Matcher: http2.PathPrefix("/")}
+	m := NewAccessMap(admin, all)
+
+	if rule := m.Rule(httptest.NewRequest("GET", "/admin/users", nil)); rule != admin {
+		t.Errorf("expected admin rule, got %v", rule)
+	}
+
+	if rule := m.Rule(httptest.NewRequest("GET", "/shop", nil)); rule != all {
+		t.Errorf("expected catch all rule, got %v", rule)
+	}
+
+	if rule := NewAccessMap(admin).Rule(httptest.NewRequest("GET", "/shop", nil)); rule != nil {
+		t.Errorf("expected no rule, got %v", rule)
+	}
+}
+
+func TestAccessMapRejectsInvalidIPs(t *testing.T) {
+	if err := NewAccessMap().Add(&AccessRule{Matcher: http2.PathPrefix("/"), IPs: []string{"10.0.0.0/33"}}); err == nil {
+		t.Error("expected invalid range to be rejected")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected NewAccessMap to panic on invalid ranges")
+		}
+	}()
+
+	NewAccessMap(&AccessRule{Matcher: http2.PathPrefix("/"), IPs: []string{"10.0.0.O"}})
+}
+
+func TestAccessControlMiddleware(t *testing.T) {
+	accessMap := NewAccessMap(
+		&AccessRule{Matcher: http2.PathPrefix("/secure"), Channel: "https"},
+		&AccessRule{Matcher: http2.PathPrefix("/internal"), IPs: []string{"10.0.0.0/8"}},
+		&AccessRule{Matcher: http2.PathPrefix("/admin"), Attributes: []interface{}{role.RLAdmin}},
+	)
+
+	h := NewAccessControlMiddleware(
+		accessMap,
+		authorization.NewDefaultAccessDecisionManager(),
+		&LoginRedirectEntryPoint{Path: "/login"},
+		&ForbiddenHandler{},
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	user := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserRoles: []role.Role{role.RLUser}})
+
+	tests := []struct {
+		name     string
+		target   string
+		remote   string
+		tok      token.Token
+		expected int
+		location string
+	}{
+		{"public", "/", "", nil, http.StatusNoContent, ""},
+		{"https channel", "http://example.org/secure?a=1", "", nil, http.StatusTemporaryRedirect, "https://example.org/secure?a=1"},
+		{"https request", "https://example.org/secure", "", nil, http.StatusNoContent, ""},
+		{"https channel with port", "http://example.org:8080/secure", "", nil, http.StatusTemporaryRedirect, "https://example.org/secure"},
+		{"https channel with ipv6", "http://[2001:db8::1]:8080/secure", "", nil, http.StatusTemporaryRedirect, "https://[2001:db8::1]/secure"},
+		{"allowed ip", "/internal", "10.1.2.3:1234", nil, http.StatusNoContent, ""},
+		{"denied ip", "/internal", "192.0.2.1:1234", user, http.StatusForbidden, ""},
+		{"anonymous", "/admin", "", token.NewAnonymousToken(), http.StatusFound, "/login"},
+		{"missing role", "/admin", "", user, http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		store, r := token.WithStore(httptest.NewRequest("GET", tt.target, nil))
+		if tt.remote != "" {
+			r.RemoteAddr = tt.remote
+		}
+		if tt.tok != nil {
+			store.Write(tt.tok)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.expected, w.Code)
+		}
+
+		if loc := w.Header().Get("Location"); loc != tt.location {
+			t.Errorf("%s: expected location \"%s\", got \"%s\"", tt.name, tt.location, loc)
+		}
+	}
+}
+
+func TestAccessListenerDispatchesAccessDenied(t *testing.T) {
+	var denied []*event.AccessDenied
+	d := event.NewEventDispatcher()
+	event.Listen(d, event.AccessDeniedEvent, func(e *event.AccessDenied) { denied = append(denied, e) }, 0)
+
+	l := &AccessListener{
+		Map: NewAccessMap(
+			&AccessRule{Matcher: http2.PathPrefix("/internal"), IPs: []string{"10.0.0.0/8"}},
+			&AccessRule{Matcher: http2.PathPrefix("/admin"), Attributes: []interface{}{role.RLAdmin}},
+		),
+		Manager: authorization.NewDefaultAccessDecisionManager(),
+		Events:  d,
+	}
+
+	user := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserRoles: []role.Role{role.RLUser}})
+
+	tests := []struct {
+		name     string
+		target   string
+		remote   string
+		tok      token.Token
+		dispatch bool
+	}{
+		{"anonymous", "/admin", "", token.NewAnonymousToken(), false},
+		{"missing token", "/admin", "", nil, false},
+		{"missing role", "/admin", "", user, true},
+		{"denied ip", "/internal", "192.0.2.1:1234", nil, true},
+		{"allowed ip", "/internal", "10.1.2.3:1234", nil, false},
+	}
+
+	for _, tt := range tests {
+		denied = nil
+		store, r := token.WithStore(httptest.NewRequest("GET", tt.target, nil))
+		if tt.remote != "" {
+			r.RemoteAddr = tt.remote
+		}
+		if tt.tok != nil {
+			store.Write(tt.tok)
+		}
+
+		l.Handle(r)
+
+		if dispatched := len(denied) == 1; dispatched != tt.dispatch {
+			t.Errorf("%s: expected access denied event %v, got %d events", tt.name, tt.dispatch, len(denied))
+		}
+	}
+}
+
+func TestAccessListenerTrustsProxyScheme(t *testing.T) {
+	resolver, err := http2.NewClientIPResolver("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := &AccessListener{
+		Map:     NewAccessMap(&AccessRule{Matcher: http2.PathPrefix("/"), Channel: "https"}),
+		Manager: authorization.NewDefaultAccessDecisionManager(),
+	}
+
+	for remote, redirect := range map[string]bool{"10.0.0.1:1234": false, "192.0.2.1:1234": true} {
+		r := httptest.NewRequest("GET", "http://example.org/", nil)
+		r.RemoteAddr = remote
+		r.Header.Set(http2.HeaderXForwardedProto, "https")
+
+		h, _ := l.Handle(http2.WithClientIPResolver(r, resolver))
+		if (h != nil) != redirect {
+			t.Errorf("%s: expected redirect %v, got %v", remote, redirect, h != nil)
+		}
+	}
+}
+
+type counterCollector struct {
+	counts map[string]float64
+}
+
+func (c *counterCollector) Counter(name string, labels metrics.Labels, delta float64) {
+	c.counts[name] += delta
+}
+
+func (c *counterCollector) Gauge(name string, labels metrics.Labels, delta float64) {}
+
+func (c *counterCollector) Histogram(name string, labels metrics.Labels, value float64) {}
+
+func TestAccessListenerCountsDenials(t *testing.T) {
+	c := &counterCollector{counts: map[string]float64{}}
+	l := &AccessListener{
+		Map:     NewAccessMap(&AccessRule{Matcher: http2.PathPrefix("/admin"), Attributes: []interface{}{role.RLAdmin}}),
+		Manager: authorization.NewDefaultAccessDecisionManager(),
+		Metrics: c,
+	}
+
+	user := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserRoles: []role.Role{role.RLUser}})
+	for _, tok := range []token.Token{token.NewAnonymousToken(), user} {
+		store, r := token.WithStore(httptest.NewRequest("GET", "/admin", nil))
+		store.Write(tok)
+		l.Handle(r)
+	}
+
+	if n := c.counts[metrics.AccessDenied]; n != 1 {
+		t.Errorf("expected only the authenticated denial to be counted, got %v", n)
+	}
+}
+
+func TestUnauthorizedEntryPoint(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&UnauthorizedEntryPoint{}).Start(w, httptest.NewRequest("GET", "/", nil), nil)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+}
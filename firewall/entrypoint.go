@@ -0,0 +1,159 @@
+package firewall
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/iwyg/goauth/authentication"
+	httpUtil "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/session"
+)
+
+// EntryPoint starts authentication for requests of unauthenticated users,
+// e.g. by redirecting to a login form or sending a 401
+type EntryPoint interface {
+	Start(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// AccessDeniedHandler responds to authenticated users that lack permission
+type AccessDeniedHandler interface {
+	Handle(w http.ResponseWriter, r *http.Request, err error)
+}
+
+type LoginRedirectEntryPoint struct {
+	Path string
+}
+
+func (e *LoginRedirectEntryPoint) Start(w http.ResponseWriter, r *http.Request, err error) {
+	http.Redirect(w, r, e.Path, http.StatusFound)
+}
+
+// FormLoginEntryPoint redirects to the login form. The requested url of GET
+// requests is stored in the session so the user can be sent back after login,
+// see authentication.TargetPathRedirect. The session is saved unless the
+// firewall's context listener saves it with the response. Firewall defaults to
+// the name of the matched firewall.
+type FormLoginEntryPoint struct {
+	LoginPath string
+	Firewall  string
+	Session   session.Config
+	Sessions  session.Provider
+}
+
+func (e *FormLoginEntryPoint) Start(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Method == http.MethodGet && !isXMLHttpRequest(r) && e.Sessions != nil {
+		if s, serr := e.Sessions.Provide(r, e.Session.Name); serr == nil {
+			name := e.Firewall
+			if name == "" {
+				name = firewallName(r)
+			}
+			session.SetTargetPath(s, name, r.URL.RequestURI())
+			if !persistsSession(r, e.Session.Name) {
+				e.Sessions.Save(w, r, s)
+			}
+		}
+	}
+
+	http.Redirect(w, r, e.LoginPath, http.StatusFound)
+}
+
+// BasicEntryPoint challenges the client for http basic authentication
+type BasicEntryPoint struct {
+	Realm string
+}
+
+func (e *BasicEntryPoint) Start(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", e.Realm))
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// JSONEntryPoint responds with a json encoded 401
+type JSONEntryPoint struct{}
+
+func (e *JSONEntryPoint) Start(w http.ResponseWriter, r *http.Request, err error) {
+	writeJSONError(w, http.StatusUnauthorized, err)
+}
+
+type UnauthorizedEntryPoint struct{}
+
+func (e *UnauthorizedEntryPoint) Start(w http.ResponseWriter, r *http.Request, err error) {
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+type ForbiddenHandler struct{}
+
+func (h *ForbiddenHandler) Handle(w http.ResponseWriter, r *http.Request, err error) {
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+}
+
+var forbiddenTemplate = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html>
+	<head>
+		<title>403 Forbidden</title>
+	</head>
+	<body>
+		<h1>Access denied</h1>
+		<p>You are not allowed to access this page.</p>
+	</body>
+</html>
+`))
+
+// DefaultAccessDeniedHandler renders a 403 page, or json if the client accepts it.
+// Template is optional and executed with the error.
+type DefaultAccessDeniedHandler struct {
+	Template *template.Template
+}
+
+func (h *DefaultAccessDeniedHandler) Handle(w http.ResponseWriter, r *http.Request, err error) {
+	if acceptsJSON(r) {
+		writeJSONError(w, http.StatusForbidden, err)
+		return
+	}
+
+	tpl := h.Template
+	if tpl == nil {
+		tpl = forbiddenTemplate
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	tpl.Execute(w, err)
+}
+
+// writeJSONError writes the status text and, for failed authentications, the
+// reason code. Error messages may reveal internals and are never written.
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	body := map[string]interface{}{
+		"status": status,
+		"error":  http.StatusText(status),
+	}
+
+	if af, ok := err.(*authentication.AuthenticationFailed); ok && af.Reason != "" {
+		body["reason"] = af.Reason
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func isXMLHttpRequest(r *http.Request) bool {
+	return r.Header.Get("X-Requested-With") == "XMLHttpRequest"
+}
+
+// acceptsJSON reports whether the Accept header prefers json over html, html
+// wins ties so browsers sending */* get a page
+func acceptsJSON(r *http.Request) bool {
+	q := httpUtil.AcceptQuality(r, "application/json")
+	return q > 0 && q > httpUtil.AcceptQuality(r, "text/html")
+}
+
+func firewallName(r *http.Request) string {
+	if c, ok := ConfigFromRequest(r); ok {
+		return c.Name
+	}
+
+	return ""
+}
@@ -0,0 +1,51 @@
+package firewall
+
+import (
+	"net/http"
+
+	"github.com/iwyg/goauth/authentication"
+	httpUtil "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/logging"
+)
+
+func isSecurityError(err error) bool {
+	switch err.(type) {
+	case authentication.AccessDenied, authentication.NotAuthenticated, AuthorisationRequired:
+		return true
+	}
+
+	return false
+}
+
+// translate recovers panics carrying security errors and hands them to the firewall
+func (fw *Firewall) translate(w http.ResponseWriter, r *http.Request) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+
+	if err, ok := rec.(error); ok && isSecurityError(err) {
+		fw.HandleError(w, r, err)
+		return
+	}
+
+	panic(rec)
+}
+
+func (fw *Firewall) withExceptionTranslation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = httpUtil.WithErrorHandler(r, fw.HandleError)
+		defer fw.translate(w, r)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NewExceptionTranslationMiddleware turns authentication and authorization errors
+// into responses. Handlers report errors with http.Fail or panic with them.
+// Unauthenticated users are sent to the entry point, authenticated users to the
+// access denied handler.
+func NewExceptionTranslationMiddleware(entryPoint EntryPoint, deniedHandler AccessDeniedHandler, opts ...logging.Option) func(http.Handler) http.Handler {
+	fw := &Firewall{EntryPoint: entryPoint, AccessDenied: deniedHandler, logger: logging.New(opts...)}
+	return fw.withExceptionTranslation
+}
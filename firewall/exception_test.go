@@ -0,0 +1,256 @@
+package firewall
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iwyg/goauth/authentication"
+	"github.com/iwyg/goauth/authorization"
+	httpUtil "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/session"
+	"github.com/iwyg/goauth/token"
+)
+
+type memorySession struct {
+	values map[interface{}]interface{}
+}
+
+func (s *memorySession) SetValue(k interface{}, v interface{}) { s.values[k] = v }
+func (s *memorySession) GetValue(k interface{}) interface{}    { return s.values[k] }
+func (s *memorySession) RemoveValue(k interface{})             { delete(s.values, k) }
+func (s *memorySession) IsNew() bool                           { return false }
+func (s *memorySession) Expire()                               {}
+func (s *memorySession) ID() string                            { return "" }
+
+// memoryProvider keeps a single session and counts how often it is saved, saving
+// fails with err
+type memoryProvider struct {
+	session *memorySession
+	saves   int
+	err     error
+}
+
+func newMemoryProvider() *memoryProvider {
+	return &memoryProvider{session: &memorySession{values: make(map[interface{}]interface{})}}
+}
+
+func (p *memoryProvider) Provide(r *http.Request, name string) (session.Session, error) {
+	return p.session, nil
+}
+
+func (p *memoryProvider) New(r *http.Request, name string) (session.Session, error) {
+	return p.session, nil
+}
+
+func (p *memoryProvider) Save(w http.ResponseWriter, r *http.Request, s session.Session) error {
+	p.saves++
+	return p.err
+}
+
+func TestExceptionTranslation(t *testing.T) {
+	user := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserRoles: []role.Role{role.RLUser}})
+
+	tests := []struct {
+		name     string
+		tok      token.Token
+		handler  http.HandlerFunc
+		expected int
+	}{
+		{"panic anonymous", nil, func(w http.ResponseWriter, r *http.Request) {
+			panic(authentication.NewAccessDeniedError("denied", nil))
+		}, http.StatusFound},
+		{"panic authenticated", user, func(w http.ResponseWriter, r *http.Request) {
+			panic(authentication.NewAccessDeniedError("denied", user))
+		}, http.StatusForbidden},
+		{"fail not authenticated", nil, func(w http.ResponseWriter, r *http.Request) {
+			httpUtil.Fail(w, r, authentication.NewNotAuthenticatedError("need authentication", nil))
+		}, http.StatusFound},
+		{"fail status error", user, func(w http.ResponseWriter, r *http.Request) {
+			httpUtil.Fail(w, r, &httpUtil.StatusError{Code: http.StatusConflict, Err: errors.New("order 7 is stale")})
+		}, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		h := NewExceptionTranslationMiddleware(&LoginRedirectEntryPoint{Path: "/login"}, &ForbiddenHandler{})(tt.handler)
+
+		store, r := token.WithStore(httptest.NewRequest("GET", "/", nil))
+		if tt.tok != nil {
+			store.Write(tt.tok)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.expected, w.Code)
+		}
+
+		if strings.Contains(w.Body.String(), "stale") {
+			t.Errorf("%s: expected the error message not to be written, got %q", tt.name, w.Body.String())
+		}
+	}
+}
+
+func TestExceptionTranslationRepanics(t *testing.T) {
+	h := NewExceptionTranslationMiddleware(&UnauthorizedEntryPoint{}, &ForbiddenHandler{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	defer func() {
+		if recover() != "boom" {
+			t.Error("expected other panics to be passed on")
+		}
+	}()
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestFormLoginEntryPoint(t *testing.T) {
+	sp := newMemoryProvider()
+	ep := &FormLoginEntryPoint{LoginPath: "/login", Firewall: "main", Session: session.Config{Name: "app"}, Sessions: sp}
+
+	w := httptest.NewRecorder()
+	ep.Start(w, httptest.NewRequest("GET", "/orders?page=2", nil), nil)
+
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/login" {
+		t.Errorf("expected redirect to the login, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+
+	if path := session.TargetPath(sp.session, "main"); path != "/orders?page=2" || sp.saves != 1 {
+		t.Errorf("expected target path to be saved once, got \"%s\" saved %d times", path, sp.saves)
+	}
+
+	sp = newMemoryProvider()
+	ep.Sessions = sp
+	ep.Start(httptest.NewRecorder(), httptest.NewRequest("POST", "/orders", nil), nil)
+
+	if session.TargetPath(sp.session, "main") != "" {
+		t.Error("expected the target path of POST requests not to be stored")
+	}
+}
+
+func TestFormLoginEntryPointInFirewall(t *testing.T) {
+	sp := newMemoryProvider()
+	sess := session.Config{Name: "app"}
+
+	m := NewFirewallMap()
+	err := m.Register(Config{
+		Name:          "main",
+		Matcher:       httpUtil.PathPrefix("/"),
+		Session:       sess,
+		Sessions:      sp,
+		EntryPoint:    &FormLoginEntryPoint{LoginPath: "/login", Session: sess, Sessions: sp},
+		AccessMap:     NewAccessMap(&AccessRule{Matcher: httpUtil.PathPrefix("/"), Attributes: []interface{}{role.RLUser}}),
+		AccessManager: authorization.NewDefaultAccessDecisionManager(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	NewFirewallMiddleware(&Firewall{Map: m})(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/orders", nil))
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected redirect to the login, got %d", w.Code)
+	}
+
+	if session.TargetPath(sp.session, "main") != "/orders" {
+		t.Error("expected the target path of the matched firewall to be stored")
+	}
+
+	if sp.saves != 1 {
+		t.Errorf("expected the session to be saved once, got %d", sp.saves)
+	}
+}
+
+func TestContextListenerSaveErrorReplacesResponse(t *testing.T) {
+	sp := newMemoryProvider()
+	sp.err = errors.New("session store unavailable")
+
+	m := NewFirewallMap()
+	if err := m.Register(Config{Name: "main", Matcher: httpUtil.PathPrefix("/"), Session: session.Config{Name: "app"}, Sessions: sp}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, handler := range map[string]http.HandlerFunc{
+		"written":     func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("orders")) },
+		"not written": func(w http.ResponseWriter, r *http.Request) {},
+	} {
+		w := httptest.NewRecorder()
+		NewFirewallMiddleware(&Firewall{Map: m})(handler).ServeHTTP(w, httptest.NewRequest("GET", "/orders", nil))
+
+		if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "orders") || strings.Contains(w.Body.String(), "unavailable") {
+			t.Errorf("%s: expected the save error to replace the response, got %d %q", name, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestEntryPoints(t *testing.T) {
+	w := httptest.NewRecorder()
+	(&BasicEntryPoint{Realm: "api"}).Start(w, httptest.NewRequest("GET", "/", nil), nil)
+
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != `Basic realm="api"` {
+		t.Errorf("expected basic challenge, got %d %s", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+
+	w = httptest.NewRecorder()
+	(&JSONEntryPoint{}).Start(w, httptest.NewRequest("GET", "/", nil), errors.New("need authentication"))
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusUnauthorized || body["error"] != http.StatusText(http.StatusUnauthorized) || body["message"] != nil {
+		t.Errorf("expected json 401 without the error message, got %d %v", w.Code, body)
+	}
+
+	w = httptest.NewRecorder()
+	failed := &authentication.AuthenticationFailed{Err: errors.New("user bob not found"), Reason: authentication.ReasonInvalidCredentials}
+	(&JSONEntryPoint{}).Start(w, httptest.NewRequest("GET", "/", nil), failed)
+
+	body = nil
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body["reason"] != authentication.ReasonInvalidCredentials || strings.Contains(w.Body.String(), "bob") {
+		t.Errorf("expected only the reason code, got %v", body)
+	}
+}
+
+func TestAccessDeniedHandlerNegotiation(t *testing.T) {
+	tests := []struct {
+		accept string
+		json   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", true},
+		{"application/json;q=0", false},
+		{"application/json;q=0, text/html", false},
+		{"text/html;q=0.5, application/json", true},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+
+		w := httptest.NewRecorder()
+		(&DefaultAccessDeniedHandler{}).Handle(w, r, errors.New("denied"))
+
+		isJSON := strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+		if w.Code != http.StatusForbidden || isJSON != tt.json {
+			t.Errorf("%q: expected json %v, got %d %s", tt.accept, tt.json, w.Code, w.Header().Get("Content-Type"))
+		}
+	}
+}
@@ -1,19 +1,159 @@
 package firewall
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
+
+	"github.com/iwyg/goauth/authentication"
+	"github.com/iwyg/goauth/authorization"
+	httpUtil "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/logging"
+	"github.com/iwyg/goauth/metrics"
+	"github.com/iwyg/goauth/token"
 )
 
+// Firewall runs the listeners of the first firewall matching a request, in order.
+// A listener returning a handler short-circuits the request, errors are translated
+// into responses by the entry point or the access denied handler.
 type Firewall struct {
-	Map    Map
-	Events Dispatcher
+	Map          Map
+	Events       Dispatcher
+	EntryPoint   EntryPoint
+	AccessDenied AccessDeniedHandler
+	Metrics      metrics.Collector
+	// ClientIP resolves client addresses behind trusted proxies for matchers,
+	// access rules and listeners
+	ClientIP *httpUtil.ClientIPResolver
+
+	logger *slog.Logger
 }
 
-func (fw *Firewall) Handle(w http.ResponseWriter, r *http.Request) {
-	listeners := fw.Map.Listeners(r)
+func (fw *Firewall) log() *slog.Logger {
+	if fw.logger == nil {
+		return logging.New()
+	}
+
+	return fw.logger
+}
 
-	for _, l := range listeners {
-		log.Printf("%#v\n", l)
+// HandleError responds to authentication and authorization errors using the
+// entry point and access denied handler of the matched firewall, if configured
+func (fw *Firewall) HandleError(w http.ResponseWriter, r *http.Request, err error) {
+	var tok token.Token
+	if store, serr := token.TokenStoreFromRequest(r); serr == nil {
+		tok, _ = store.Read()
 	}
+
+	switch err.(type) {
+	case authentication.AccessDenied:
+		if !authorization.IsFullyAuthenticated(tok) {
+			fw.log().Debug("start authentication", "path", r.URL.Path, "reason", err.Error())
+			fw.entryPoint(r).Start(w, r, err)
+			return
+		}
+		fw.log().Info("access denied", "path", r.URL.Path, "reason", err.Error(), "token", tok)
+		fw.accessDenied(r).Handle(w, r, err)
+	case authentication.NotAuthenticated, AuthorisationRequired:
+		fw.log().Debug("start authentication", "path", r.URL.Path, "reason", err.Error())
+		fw.entryPoint(r).Start(w, r, err)
+	case httpUtil.Error:
+		fw.log().Warn("request failed", "path", r.URL.Path, "status", err.(httpUtil.Error).StatusCode(), "error", err)
+		code := err.(httpUtil.Error).StatusCode()
+		http.Error(w, http.StatusText(code), code)
+	default:
+		fw.log().Error("request failed", "path", r.URL.Path, "error", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+func (fw *Firewall) entryPoint(r *http.Request) EntryPoint {
+	if c, ok := ConfigFromRequest(r); ok && c.EntryPoint != nil {
+		return c.EntryPoint
+	}
+
+	if fw.EntryPoint == nil {
+		return &UnauthorizedEntryPoint{}
+	}
+
+	return fw.EntryPoint
+}
+
+func (fw *Firewall) accessDenied(r *http.Request) AccessDeniedHandler {
+	if c, ok := ConfigFromRequest(r); ok && c.AccessDenied != nil {
+		return c.AccessDenied
+	}
+
+	if fw.AccessDenied == nil {
+		return &ForbiddenHandler{}
+	}
+
+	return fw.AccessDenied
+}
+
+// Handle runs the listeners for the request. It returns false if the request was
+// answered by a listener or an error response.
+func (fw *Firewall) Handle(w http.ResponseWriter, r *http.Request) bool {
+	for _, l := range fw.Map.Listeners(r) {
+		h, err := l(r)
+		if err != nil {
+			fw.count(r, "error")
+			fw.HandleError(w, r, err)
+			return false
+		}
+
+		if h != nil {
+			fw.count(r, "handled")
+			h.ServeHTTP(w, r)
+			return false
+		}
+	}
+
+	fw.count(r, "pass")
+
+	return true
+}
+
+func (fw *Firewall) count(r *http.Request, outcome string) {
+	if fw.Metrics == nil {
+		return
+	}
+
+	var name string
+	if c, ok := ConfigFromRequest(r); ok {
+		name = c.Name
+	}
+
+	metrics.Count(fw.Metrics, metrics.FirewallRequests, metrics.Labels{"firewall": name, "outcome": outcome})
+}
+
+func (fw *Firewall) ServeNext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, r = token.WithStore(r)
+
+		if fw.ClientIP != nil {
+			r = httpUtil.WithClientIPResolver(r, fw.ClientIP)
+		}
+
+		r = withConfig(r, fw.Map, fw.Map.Config(r))
+
+		hooks := &responseHooks{}
+		r = r.WithContext(context.WithValue(r.Context(), hooksKey{}, hooks))
+		hw := &hookWriter{ResponseWriter: w, hooks: hooks}
+
+		r = httpUtil.WithErrorHandler(r, fw.HandleError)
+		defer fw.translate(hw, r)
+
+		if fw.Handle(hw, r) {
+			next.ServeHTTP(hw, r)
+		}
+
+		hooks.fire(w)
+	})
+}
+
+// NewFirewallMiddleware makes the firewall the central security middleware
+func NewFirewallMiddleware(fw *Firewall, opts ...logging.Option) func(http.Handler) http.Handler {
+	fw.logger = logging.New(opts...)
+	return fw.ServeNext
 }
@@ -0,0 +1,180 @@
+package firewall
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iwyg/goauth/authentication"
+	"github.com/iwyg/goauth/authorization"
+	"github.com/iwyg/goauth/event"
+	http2 "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/session"
+	"github.com/iwyg/goauth/token"
+)
+
+func TestFirewallRunsListeners(t *testing.T) {
+	m := NewFirewallMap()
+	m.Add(
+		http2.NewRequestMatcher(http2.RequestMatcherConfig{}),
+		(&AnonListener{}).Handle,
+		(&AccessListener{
+			Map: NewAccessMap(&AccessRule{
+				Matcher:    http2.NewRequestMatcher(http2.RequestMatcherConfig{Path: "^/admin"}),
+				Attributes: []interface{}{role.RLAdmin},
+			}),
+			Manager: authorization.NewDefaultAccessDecisionManager(),
+		}).Handle,
+	)
+
+	fw := &Firewall{Map: m, EntryPoint: &LoginRedirectEntryPoint{Path: "/login"}}
+	h := NewFirewallMiddleware(fw)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/", http.StatusNoContent},
+		{"/admin", http.StatusFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.path, tt.status, rec.Code)
+		}
+	}
+}
+
+func TestFirewallLogout(t *testing.T) {
+	var loggedOut bool
+	logout := &authentication.LogoutConfig{
+		Path: "/logout",
+		Listeners: []authentication.LogoutListener{func(r *http.Request, tok token.Token) {
+			loggedOut = true
+		}},
+	}
+
+	m := NewFirewallMap()
+	m.Add(http2.NewRequestMatcher(http2.RequestMatcherConfig{}), (&LogoutListener{Logout: logout}).Handle)
+
+	fw := &Firewall{Map: m}
+	h := NewFirewallMiddleware(fw)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		method    string
+		status    int
+		loggedOut bool
+	}{
+		{"GET", http.StatusMethodNotAllowed, false},
+		{"POST", http.StatusFound, true},
+	}
+
+	for _, tt := range tests {
+		loggedOut = false
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tt.method, "/logout", nil))
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.method, tt.status, rec.Code)
+		}
+
+		if loggedOut != tt.loggedOut {
+			t.Errorf("%s: expected logout %v, got %v", tt.method, tt.loggedOut, loggedOut)
+		}
+	}
+}
+
+func TestFirewallForwardsFlusher(t *testing.T) {
+	m := NewFirewallMap()
+	m.Add(http2.NewRequestMatcher(http2.RequestMatcherConfig{}), (&AnonListener{}).Handle)
+
+	h := NewFirewallMiddleware(&Firewall{Map: m})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		OnResponse(r, func(w http.ResponseWriter) {
+			w.Header().Set("X-Hook", "fired")
+		})
+
+		f, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("expected the firewall to keep http.Flusher")
+		}
+		if _, ok := w.(http.Hijacker); !ok {
+			t.Fatal("expected the firewall to keep http.Hijacker")
+		}
+
+		w.Write([]byte("event"))
+		f.Flush()
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/events", nil))
+
+	if !rec.Flushed {
+		t.Error("expected the response to be flushed")
+	}
+
+	if rec.Header().Get("X-Hook") != "fired" {
+		t.Error("expected response hooks to run before the response is written")
+	}
+}
+
+type refreshingProvider struct {
+	identity.Provider
+	refreshed identity.Identity
+}
+
+func (p *refreshingProvider) Refresh(id identity.Identity) (identity.Identity, error) {
+	return p.refreshed, nil
+}
+
+func (p *refreshingProvider) Supports(id identity.Identity) bool {
+	return true
+}
+
+func TestContextListenerDispatchesChangedIdentities(t *testing.T) {
+	alice := &identity.InMemoryIdentity{UserId: 1, UserCredential: "alice", UserRoles: []role.Role{role.RLUser}}
+	promoted := &identity.InMemoryIdentity{UserId: 1, UserCredential: "alice", UserRoles: []role.Role{role.RLAdmin}}
+
+	tests := []struct {
+		name      string
+		refreshed identity.Identity
+		dispatch  bool
+	}{
+		{"same identity", alice, false},
+		{"equal identity", &identity.InMemoryIdentity{UserId: 1, UserCredential: "alice", UserRoles: []role.Role{role.RLUser}}, false},
+		{"changed roles", promoted, true},
+	}
+
+	for _, tt := range tests {
+		var refreshed int
+		d := event.NewEventDispatcher()
+		event.Listen(d, event.TokenRefreshedEvent, func(e *event.TokenRefreshed) { refreshed++ }, 0)
+
+		sp := newMemoryProvider()
+		sp.session.SetValue("__security", token.NewAuthenticatedToken(alice))
+
+		l := &ContextListener{
+			Session:    session.Config{Name: "app", TokenKey: "__security"},
+			Sessions:   sp,
+			Identities: &refreshingProvider{refreshed: tt.refreshed},
+			Events:     d,
+		}
+
+		_, r := token.WithStore(httptest.NewRequest("GET", "/", nil))
+		if _, err := l.Handle(r); err != nil {
+			t.Fatal(err)
+		}
+
+		if (refreshed == 1) != tt.dispatch {
+			t.Errorf("%s: expected token refreshed event %v, got %d events", tt.name, tt.dispatch, refreshed)
+		}
+	}
+}
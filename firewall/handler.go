@@ -1,8 +1,13 @@
 package firewall
 
 import (
-	"log"
+	"bufio"
+	"net"
 	"net/http"
+	"sync"
+
+	httpUtil "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/logging"
 )
 
 type statWriter struct {
@@ -23,29 +28,166 @@ func (w *statWriter) Write(b []byte) (int, error) {
 	return w.ResponseWriter.Write(b)
 }
 
+func (w *statWriter) Flush() {
+	if w.Status == 0 {
+		w.Status = http.StatusOK
+	}
 
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
 
-func NewMiddleware() func (http.Handler) http.Handler {
-	return func(next http.Handler)  http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
-			next.ServeHTTP(w, r)
-		})
+func (w *statWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer
+func (w *statWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type hooksKey struct{}
+
+type responseHooks struct {
+	mu    sync.Mutex
+	hooks []func(w http.ResponseWriter)
+	fired bool
+	// the response was replaced by an error response, see failResponse
+	failed bool
+	// sessions are saved by a hook, see persistsSession
+	sessions map[string]bool
+}
+
+func (h *responseHooks) fire(w http.ResponseWriter) {
+	h.mu.Lock()
+	if h.fired {
+		h.mu.Unlock()
+		return
+	}
+	h.fired = true
+	hooks := h.hooks
+	h.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook(w)
+	}
+}
+
+// hookWriter runs the response hooks before the response header is written,
+// so listeners can still set cookies after the handler ran. It forwards
+// http.Flusher and http.Hijacker, so streaming and websockets keep working.
+type hookWriter struct {
+	http.ResponseWriter
+	hooks *responseHooks
+}
+
+func (w *hookWriter) WriteHeader(status int) {
+	w.hooks.fire(w.ResponseWriter)
+	if !w.hooks.hasFailed() {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+// Write discards the body of the handler if a hook replaced the response
+func (w *hookWriter) Write(b []byte) (int, error) {
+	w.hooks.fire(w.ResponseWriter)
+	if w.hooks.hasFailed() {
+		return len(b), nil
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *hookWriter) Flush() {
+	w.hooks.fire(w.ResponseWriter)
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *hookWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *hookWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// OnResponse registers a hook that runs before the response of a request that
+// passed the firewall is written, e.g. to persist the token in the session.
+// It returns false if the request was not handled by a firewall.
+func OnResponse(r *http.Request, hook func(w http.ResponseWriter)) bool {
+	h, ok := r.Context().Value(hooksKey{}).(*responseHooks)
+	if !ok {
+		return false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks = append(h.hooks, hook)
+
+	return true
+}
+
+func (h *responseHooks) hasFailed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.failed
+}
+
+// failResponse reports err of a response hook to the error handler of the
+// request. The error response replaces the response of the handler, which is
+// discarded.
+func failResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if h, ok := r.Context().Value(hooksKey{}).(*responseHooks); ok {
+		h.mu.Lock()
+		h.failed = true
+		h.mu.Unlock()
+	}
+
+	httpUtil.Fail(w, r, &httpUtil.StatusError{Code: http.StatusInternalServerError, Err: err})
+}
+
+// persistSession records that a response hook saves the named session, so
+// others do not save it again and send a second cookie
+func persistSession(r *http.Request, name string) {
+	h, ok := r.Context().Value(hooksKey{}).(*responseHooks)
+	if !ok {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.sessions == nil {
+		h.sessions = make(map[string]bool)
 	}
+	h.sessions[name] = true
 }
 
-func NewMoveOnMiddleware() func (http.Handler) http.Handler {
-	return func(next http.Handler)  http.Handler {
+// persistsSession reports if a response hook saves the named session
+func persistsSession(r *http.Request, name string) bool {
+	h, ok := r.Context().Value(hooksKey{}).(*responseHooks)
+	if !ok {
+		return false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.sessions[name]
+}
+
+func NewMoveOnMiddleware(opts ...logging.Option) func(http.Handler) http.Handler {
+	l := logging.New(opts...)
+
+	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ww := &statWriter{ResponseWriter: w}
-			log.Printf("wait for it…\n")
-			defer func () {
+			defer func() {
 				if ww.Status == http.StatusUnauthorized {
-					log.Printf("you shall not pass\n")
+					l.Debug("request unauthorized", "path", r.URL.Path)
 				}
 			}()
 			next.ServeHTTP(ww, r)
-			log.Printf("Status %#v\n", ww.Status)
+			l.Debug("request done", "path", r.URL.Path, "status", ww.Status)
 		})
 	}
 }
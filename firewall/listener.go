@@ -1,27 +1,54 @@
 package firewall
 
 import (
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/iwyg/goauth/authentication"
+	"github.com/iwyg/goauth/event"
 	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/metrics"
+	"github.com/iwyg/goauth/session"
 	"github.com/iwyg/goauth/token"
-	"net/http"
+	"github.com/iwyg/goauth/tracing"
 )
 
+// Listener inspects a request that passed the firewall. Returning a handler
+// answers the request and skips all remaining listeners and the application.
 type Listener func(r *http.Request) (http.Handler, error)
 
+// ContextListener restores the token from the session and refreshes its identity.
+// The token is written back to the session before the response is sent, the
+// session is migrated if the user logged in during the request. If the session
+// cannot be saved the response is replaced by the firewall's error response.
+// Authenticated sessions without requests for SessionTimeout are no longer
+// counted as active.
 type ContextListener struct {
-	id             ProviderKey
-	store          token.Store
-	identityFinder identity.Provider
+	Session        session.Config
+	Sessions       session.Provider
+	Identities     identity.Provider
+	Events         event.Dispatcher
+	Metrics        metrics.Collector
+	Tracer         tracing.Tracer
+	SessionTimeout time.Duration
+
+	active activeSessions
 }
 
-func (c *ContextListener) readFromStore() {
-}
-
-func (c *ContextListener) refreshIdentity(t interface{}) (token.Token, error) {
+func (c *ContextListener) refreshIdentity(r *http.Request, t token.Token) (token.Token, error) {
 	switch t.(type) {
 	case token.IdentityToken:
 		tok := t.(token.IdentityToken)
-		identity, err := c.identityFinder.Refresh(tok.Identity())
+		if c.Identities == nil || !c.Identities.Supports(tok.Identity()) {
+			return tok, nil
+		}
+
+		start := time.Now()
+		_, span := tracing.Start(c.Tracer, r.Context(), tracing.SpanIdentityRefresh)
+		identity, err := c.Identities.Refresh(tok.Identity())
+		tracing.End(span, err)
+		metrics.ObserveSince(c.Metrics, metrics.TokenVerification, nil, start)
 
 		if err != nil {
 			return nil, err
@@ -30,40 +57,149 @@ func (c *ContextListener) refreshIdentity(t interface{}) (token.Token, error) {
 		return tok.WithIdentity(identity), err
 	}
 
-	return t.(token.Token), nil
+	return t, nil
+}
+
+// identityChanged reports if refreshing changed the identity or the roles of the
+// token. Refreshed tokens are new values even if nothing changed.
+func identityChanged(old, refreshed token.Token) bool {
+	o, ok := old.(token.IdentityToken)
+	n, nok := refreshed.(token.IdentityToken)
+	if !ok || !nok {
+		return old != refreshed
+	}
+
+	return !reflect.DeepEqual(o.Identity(), n.Identity()) || !reflect.DeepEqual(o.Roles(), n.Roles())
+}
+
+func (c *ContextListener) persist(w http.ResponseWriter, r *http.Request, store token.Store, sess session.Session, wasAuthenticated bool) {
+	tok, _ := store.Read()
+
+	if saveToken, err := session.GetSessionToken(tok); err == nil && tok.IsFullyAuthenticated() {
+		sess.SetValue(c.Session.TokenKey, saveToken)
+		if !wasAuthenticated {
+			id := newSessionID()
+			sess.SetValue(c.sessionIDKey(), id)
+			c.touchSession(id)
+			if err := session.Migrate(c.Sessions, w, r, sess, c.Session.Events); err != nil {
+				failResponse(w, r, err)
+			}
+			return
+		}
+	} else {
+		if id, ok := sess.GetValue(c.sessionIDKey()).(string); ok {
+			c.endSession(id)
+		}
+		sess.RemoveValue(c.Session.TokenKey)
+		sess.RemoveValue(c.sessionIDKey())
+	}
+
+	if err := c.Sessions.Save(w, r, sess); err != nil {
+		failResponse(w, r, err)
+	}
 }
 
 func (c *ContextListener) Handle(r *http.Request) (http.Handler, error) {
-	t, readErr := c.store.Read()
-	if readErr != nil {
-		// do stuff
+	store, err := token.TokenStoreFromRequest(r)
+	if err != nil {
+		return nil, err
 	}
 
-	tok, err := c.refreshIdentity(t)
+	sess, err := c.Sessions.Provide(r, c.Session.Name)
+	if err != nil {
+		if sess, err = c.Sessions.New(r, c.Session.Name); err != nil {
+			return nil, err
+		}
+	}
 
-	if err == nil {
-		c.store.Write(tok)
+	var wasAuthenticated bool
+	if t, ok := sess.GetValue(c.Session.TokenKey).(token.Token); ok {
+		// a token whose identity is gone is dropped, the request continues unauthenticated
+		if tok, err := c.refreshIdentity(r, t); err == nil {
+			store.Write(tok)
+			wasAuthenticated = tok.IsFullyAuthenticated()
+			if id, ok := sess.GetValue(c.sessionIDKey()).(string); ok && wasAuthenticated {
+				c.touchSession(id)
+			}
+			if identityChanged(t, tok) {
+				event.Dispatch(c.Events, event.NewTokenRefreshed(r, t, tok))
+			}
+		}
 	}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if OnResponse(r, func(w http.ResponseWriter) {
+		c.persist(w, r, store, sess, wasAuthenticated)
+	}) {
+		persistSession(r, c.Session.Name)
+	}
 
-	}), nil
+	return nil, nil
 }
 
-type AnonListener struct {
-	store token.Store
+// AuthenticationListener authenticates requests that carry credentials
+type AuthenticationListener struct {
+	Authenticator authentication.RequestAuthenticator
 }
 
-func (a *AnonListener) Handle(r *http.Request) (http.Handler, error) {
+func (a *AuthenticationListener) Handle(r *http.Request) (http.Handler, error) {
+	store, err := token.TokenStoreFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := authentication.AuthenticateResult(a.Authenticator, r)
+
+	switch err {
+	case nil:
+		if err := store.Write(res.Token); err != nil {
+			return nil, err
+		}
+		if h := authentication.SuccessHandlerFor(res); h != nil {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				h.OnAuthenticationSuccess(w, r, res.Token)
+			}), nil
+		}
+		return nil, nil
+	case authentication.ErrNoSupportedAuthenticators:
+		return nil, nil
+	}
+
+	if h := authentication.FailureHandlerFor(err); h != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.OnAuthenticationFailure(w, r, err)
+		}), nil
+	}
 
-	tok, err := a.store.Read()
+	current, _ := store.Read()
 
+	return nil, authentication.NewNotAuthenticatedError(authentication.FailureReason(err), current)
+}
+
+// LogoutListener answers requests to the logout path
+type LogoutListener struct {
+	Logout *authentication.LogoutConfig
+}
+
+func (l *LogoutListener) Handle(r *http.Request) (http.Handler, error) {
+	if !l.Logout.Matches(r) {
+		return nil, nil
+	}
+
+	return l.Logout, nil
+}
+
+// AnonListener provides an anonymous token to requests that are not authenticated
+type AnonListener struct{}
+
+func (a *AnonListener) Handle(r *http.Request) (http.Handler, error) {
+	store, err := token.TokenStoreFromRequest(r)
 	if err != nil {
-		tok = token.NewAnonymousToken()
-		a.store.Write(tok)
+		return nil, err
 	}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if _, err := store.Read(); err != nil {
+		store.Write(token.NewAnonymousToken())
+	}
 
-	}), nil
+	return nil, nil
 }
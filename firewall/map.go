@@ -1,35 +1,231 @@
 package firewall
 
 import (
-	http2 "github.com/iwyg/goauth/http"
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+
+	"github.com/iwyg/goauth/authentication"
+	"github.com/iwyg/goauth/authorization"
+	"github.com/iwyg/goauth/event"
+	http2 "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/metrics"
+	"github.com/iwyg/goauth/session"
+	"github.com/iwyg/goauth/token"
+	"github.com/iwyg/goauth/tracing"
 )
 
 type Map interface {
 	Listeners(r *http.Request) []Listener
+	Config(r *http.Request) *Config
+}
+
+// Config describes a named firewall. The token is stored in the session under
+// a key derived from ContextKey, which defaults to the firewall's name, so
+// firewalls with the same ContextKey share the authenticated token if they also
+// use the same session, i.e. the same Session.Name and Sessions. Stateless
+// firewalls neither read nor write the session. Security events of the
+// firewall's listeners are dispatched to Events, metrics recorded to Metrics and
+// spans started with Tracer.
+type Config struct {
+	Name           string
+	Matcher        http2.RequestMatcher
+	Authenticators []authentication.Authenticator
+	Provider       identity.Provider
+	Checker        identity.IdentityChecker
+	EntryPoint     EntryPoint
+	AccessDenied   AccessDeniedHandler
+	Stateless      bool
+	ContextKey     string
+	Session        session.Config
+	Sessions       session.Provider
+	Anonymous      bool
+	AccessMap      *AccessMap
+	AccessManager  authorization.AccessDecisionManager
+	Logout         *authentication.LogoutConfig
+	Events         event.Dispatcher
+	Metrics        metrics.Collector
+	Tracer         tracing.Tracer
+	// Listeners run after authentication and before the access listener
+	Listeners []Listener
+
+	listeners []Listener
+}
+
+// SessionTokenKey is the session key the token of the firewall context is stored at
+func (c *Config) SessionTokenKey() string {
+	key := c.ContextKey
+	if key == "" {
+		key = c.Name
+	}
+
+	return "_security_" + key
+}
+
+func (c *Config) validate() error {
+	switch {
+	case c.Name == "":
+		return errors.New("firewall name is required")
+	case c.Matcher == nil:
+		return fmt.Errorf("firewall \"%s\": matcher is required", c.Name)
+	case len(c.Authenticators) > 0 && c.Provider == nil:
+		return fmt.Errorf("firewall \"%s\": identity provider is required", c.Name)
+	case !c.Stateless && c.Sessions == nil:
+		return fmt.Errorf("firewall \"%s\": session provider is required unless stateless", c.Name)
+	case c.AccessMap != nil && c.AccessManager == nil:
+		return fmt.Errorf("firewall \"%s\": access decision manager is required", c.Name)
+	case c.Logout != nil && c.Logout.Path == "":
+		return fmt.Errorf("firewall \"%s\": logout path is required", c.Name)
+	}
+
+	return nil
+}
+
+// buildListeners creates the listeners in the order they must run: context,
+// logout, authentication, custom, anonymous, access
+func (c *Config) buildListeners() {
+	var ls []Listener
+
+	if !c.Stateless {
+		sc := c.Session
+		sc.TokenKey = c.SessionTokenKey()
+		if sc.Events == nil {
+			sc.Events = c.Events
+		}
+		ls = append(ls, (&ContextListener{
+			Session:    sc,
+			Sessions:   c.Sessions,
+			Identities: metrics.InstrumentProvider(c.Provider, c.Metrics, ""),
+			Events:     c.Events,
+			Metrics:    c.Metrics,
+			Tracer:     c.Tracer,
+		}).Handle)
+	}
+
+	if c.Logout != nil {
+		ls = append(ls, (&LogoutListener{Logout: c.Logout}).Handle)
+	}
+
+	if len(c.Authenticators) > 0 {
+		checker := c.Checker
+		if checker == nil {
+			checker = identity.NewBaseIdentityChecker()
+		}
+
+		guard := authentication.NewGuardRequestAuthenticator(
+			&token.RequestContextStoreProvider{}, c.Authenticators, c.Provider, checker,
+		)
+		guard.SetDispatcher(c.Events)
+		guard.SetCollector(c.Metrics)
+		guard.SetTracer(c.Tracer)
+		ls = append(ls, (&AuthenticationListener{Authenticator: guard}).Handle)
+	}
+
+	ls = append(ls, c.Listeners...)
+
+	if c.Anonymous {
+		ls = append(ls, (&AnonListener{}).Handle)
+	}
+
+	if c.AccessMap != nil {
+		ls = append(ls, (&AccessListener{Map: c.AccessMap, Manager: c.AccessManager, Events: c.Events, Metrics: c.Metrics}).Handle)
+	}
+
+	c.listeners = ls
 }
 
+type configKey struct{}
+
+// matched caches the firewall a map matched for a request, so matchers are
+// evaluated once per request. config is nil if no firewall matched.
+type matched struct {
+	m      Map
+	config *Config
+}
+
+// ConfigFromRequest returns the configuration of the firewall that handles the request
+func ConfigFromRequest(r *http.Request) (*Config, bool) {
+	mt, ok := r.Context().Value(configKey{}).(*matched)
+	if !ok || mt.config == nil {
+		return nil, false
+	}
+
+	return mt.config, true
+}
+
+func withConfig(r *http.Request, m Map, c *Config) *http.Request {
+	r = r.WithContext(context.WithValue(r.Context(), configKey{}, &matched{m: m, config: c}))
+	if c != nil && c.Name != "" {
+		r = event.WithFirewall(r, c.Name)
+	}
+
+	return r
+}
+
+// DefaultFirewallMap matches firewalls in the order they were added
 type DefaultFirewallMap struct {
-	handlers map[http2.RequestMatcher][]Listener
+	firewalls []*Config
 }
 
+// Add registers an unnamed firewall running the given listeners
 func (f *DefaultFirewallMap) Add(matcher http2.RequestMatcher, handlers ...Listener) {
-	f.handlers[matcher] = handlers
+	f.firewalls = append(f.firewalls, &Config{Matcher: matcher, listeners: handlers})
 }
 
-func (f *DefaultFirewallMap) Listeners(r *http.Request) []Listener {
-	for matcher, listeners := range f.handlers {
-		if matcher.Matches(r) {
-			return listeners
+// Register adds a named firewall and builds its listeners
+func (f *DefaultFirewallMap) Register(conf Config) error {
+	if err := conf.validate(); err != nil {
+		return err
+	}
+
+	if f.Firewall(conf.Name) != nil {
+		return fmt.Errorf("firewall \"%s\" already registered", conf.Name)
+	}
+
+	c := &conf
+	c.buildListeners()
+	f.firewalls = append(f.firewalls, c)
+
+	return nil
+}
+
+// Firewall returns a registered firewall by name
+func (f *DefaultFirewallMap) Firewall(name string) *Config {
+	for _, c := range f.firewalls {
+		if c.Name != "" && c.Name == name {
+			return c
 		}
 	}
 
+	return nil
+}
+
+// Config returns the first firewall matching the request, the result is taken
+// from the request if the firewall already matched it
+func (f *DefaultFirewallMap) Config(r *http.Request) *Config {
+	if mt, ok := r.Context().Value(configKey{}).(*matched); ok && mt.m == Map(f) {
+		return mt.config
+	}
+
+	for _, c := range f.firewalls {
+		if c.Matcher.Matches(r) {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func (f *DefaultFirewallMap) Listeners(r *http.Request) []Listener {
+	if c := f.Config(r); c != nil {
+		return c.listeners
+	}
+
 	return make([]Listener, 0)
 }
 
 func NewFirewallMap() *DefaultFirewallMap {
-	handlers := make(map[http2.RequestMatcher][]Listener)
-	m := &DefaultFirewallMap{handlers: handlers}
-
-	return m
+	return &DefaultFirewallMap{}
 }
@@ -0,0 +1,115 @@
+package firewall
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iwyg/goauth/event"
+	http2 "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/session"
+)
+
+func countingMatcher(prefix string, calls *int) http2.RequestMatcher {
+	m := http2.PathPrefix(prefix)
+	return http2.Func(prefix, func(r *http.Request) bool {
+		*calls++
+		return m.Matches(r)
+	})
+}
+
+func TestFirewallMapMatchOrder(t *testing.T) {
+	var apiCalls, mainCalls int
+	m := NewFirewallMap()
+
+	for _, c := range []Config{
+		{Name: "api", Matcher: countingMatcher("/api", &apiCalls), Stateless: true},
+		{Name: "main", Matcher: countingMatcher("/", &mainCalls), Stateless: true},
+	} {
+		if err := m.Register(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var name string
+	fw := &Firewall{Map: m}
+	h := NewFirewallMiddleware(fw)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _ := ConfigFromRequest(r)
+		name = c.Name
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/orders", nil))
+	if name != "api" {
+		t.Errorf("expected the first matching firewall, got %s", name)
+	}
+
+	if apiCalls != 1 || mainCalls != 0 {
+		t.Errorf("expected matchers to run once per request, got %d and %d", apiCalls, mainCalls)
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/shop", nil))
+	if name != "main" {
+		t.Errorf("expected the catch all firewall, got %s", name)
+	}
+}
+
+func TestFirewallMapRegister(t *testing.T) {
+	m := NewFirewallMap()
+	if err := m.Register(Config{Name: "main", Matcher: http2.PathPrefix("/"), Stateless: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		conf Config
+	}{
+		{"duplicate name", Config{Name: "main", Matcher: http2.PathPrefix("/"), Stateless: true}},
+		{"missing name", Config{Matcher: http2.PathPrefix("/"), Stateless: true}},
+		{"missing matcher", Config{Name: "api", Stateless: true}},
+		{"missing sessions", Config{Name: "api", Matcher: http2.PathPrefix("/api")}},
+	}
+
+	for _, tt := range tests {
+		if err := m.Register(tt.conf); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestSharedContextKey(t *testing.T) {
+	sess := session.Config{Name: "app"}
+	admin := &Config{Name: "admin", ContextKey: "shop", Session: sess}
+	shop := &Config{Name: "shop", Session: sess}
+	api := &Config{Name: "api", Session: sess}
+
+	if admin.SessionTokenKey() != shop.SessionTokenKey() {
+		t.Error("expected firewalls with the same context to store the token at the same key")
+	}
+
+	if api.SessionTokenKey() == shop.SessionTokenKey() {
+		t.Error("expected firewalls with different contexts to store separate tokens")
+	}
+}
+
+func TestLoginEventsReportFirewall(t *testing.T) {
+	m := NewFirewallMap()
+	if err := m.Register(Config{Name: "main", Matcher: http2.PathPrefix("/"), Stateless: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var success *event.LoginSuccess
+	var failure *event.LoginFailure
+	h := (&Firewall{Map: m}).ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		success = event.NewLoginSuccess(r, nil, nil)
+		failure = event.NewLoginFailure(r, nil, "", "")
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if success == nil || success.Firewall != "main" {
+		t.Errorf("expected login success to report firewall main, got %v", success)
+	}
+
+	if failure == nil || failure.Firewall != "main" {
+		t.Errorf("expected login failure to report firewall main, got %v", failure)
+	}
+}
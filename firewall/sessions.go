@@ -0,0 +1,127 @@
+package firewall
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/iwyg/goauth/metrics"
+)
+
+// DefaultSessionTimeout is the time after which an authenticated session without
+// requests is no longer counted as active
+const DefaultSessionTimeout = 24 * time.Hour
+
+// sessionSweepInterval is the longest time between two sweeps of idle sessions
+const sessionSweepInterval = time.Minute
+
+// activeSessions tracks the authenticated sessions of a context listener for the
+// ActiveSessions gauge. Sessions that expire are never seen again, so sessions
+// idle longer than the timeout are swept from the gauge. Sweeps run at most once
+// per sessionSweepInterval, not on every request.
+type activeSessions struct {
+	mu        sync.Mutex
+	lastSeen  map[string]time.Time
+	nextSweep time.Time
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// touch marks a session active and returns the change of the active sessions
+func (a *activeSessions) touch(id string, now time.Time, timeout time.Duration) float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.lastSeen == nil {
+		a.lastSeen = make(map[string]time.Time)
+	}
+
+	var delta float64
+	if !now.Before(a.nextSweep) {
+		delta = a.sweep(now, timeout)
+	}
+
+	if id == "" {
+		return delta
+	}
+
+	if _, ok := a.lastSeen[id]; !ok {
+		delta++
+	}
+	a.lastSeen[id] = now
+
+	return delta
+}
+
+// sweep drops the sessions idle longer than timeout and schedules the next sweep
+func (a *activeSessions) sweep(now time.Time, timeout time.Duration) float64 {
+	var delta float64
+	for sid, seen := range a.lastSeen {
+		if now.Sub(seen) > timeout {
+			delete(a.lastSeen, sid)
+			delta--
+		}
+	}
+
+	interval := sessionSweepInterval
+	if timeout < interval {
+		interval = timeout
+	}
+	a.nextSweep = now.Add(interval)
+
+	return delta
+}
+
+// remove drops a session that ended and returns the change of the active sessions
+func (a *activeSessions) remove(id string) float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.lastSeen[id]; !ok {
+		return 0
+	}
+	delete(a.lastSeen, id)
+
+	return -1
+}
+
+func (c *ContextListener) sessionTimeout() time.Duration {
+	if c.SessionTimeout <= 0 {
+		return DefaultSessionTimeout
+	}
+
+	return c.SessionTimeout
+}
+
+func (c *ContextListener) sessionIDKey() string {
+	return c.Session.TokenKey + ".session_id"
+}
+
+// touchSession counts the session as active, it is given an id when the user logs in
+func (c *ContextListener) touchSession(id string) {
+	if c.Metrics == nil {
+		return
+	}
+
+	if delta := c.active.touch(id, time.Now(), c.sessionTimeout()); delta != 0 {
+		metrics.AddGauge(c.Metrics, metrics.ActiveSessions, nil, delta)
+	}
+}
+
+func (c *ContextListener) endSession(id string) {
+	if c.Metrics == nil {
+		return
+	}
+
+	if delta := c.active.remove(id); delta != 0 {
+		metrics.AddGauge(c.Metrics, metrics.ActiveSessions, nil, delta)
+	}
+}
@@ -0,0 +1,89 @@
+package firewall
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iwyg/goauth/metrics"
+)
+
+type gaugeCollector struct {
+	value float64
+}
+
+func (c *gaugeCollector) Counter(name string, labels metrics.Labels, delta float64) {}
+
+func (c *gaugeCollector) Gauge(name string, labels metrics.Labels, delta float64) {
+	if name == metrics.ActiveSessions {
+		c.value += delta
+	}
+}
+
+func (c *gaugeCollector) Histogram(name string, labels metrics.Labels, value float64) {}
+
+func TestActiveSessionsExpire(t *testing.T) {
+	var a activeSessions
+	now := time.Now()
+
+	if d := a.touch("a", now, time.Minute); d != 1 {
+		t.Errorf("expected a new session to count, got %v", d)
+	}
+
+	if d := a.touch("a", now.Add(30*time.Second), time.Minute); d != 0 {
+		t.Errorf("expected a known session not to count again, got %v", d)
+	}
+
+	if d := a.touch("b", now.Add(2*time.Minute), time.Minute); d != 0 {
+		t.Errorf("expected the idle session to be replaced, got %v", d)
+	}
+
+	if d := a.remove("b"); d != -1 {
+		t.Errorf("expected an ended session to be removed, got %v", d)
+	}
+
+	if d := a.remove("b"); d != 0 {
+		t.Errorf("expected an unknown session to be ignored, got %v", d)
+	}
+}
+
+func TestActiveSessionsSweepPeriodically(t *testing.T) {
+	var a activeSessions
+	now := time.Now()
+	timeout := 2 * sessionSweepInterval
+
+	a.touch("a", now, timeout)
+	a.touch("b", now.Add(3*sessionSweepInterval/2), timeout)
+
+	// a is idle but the next sweep is not due yet
+	if d := a.touch("c", now.Add(2*sessionSweepInterval+time.Second), timeout); d != 1 {
+		t.Errorf("expected no sweep before the interval passed, got %v", d)
+	}
+
+	if d := a.touch("c", now.Add(3*sessionSweepInterval), timeout); d != -1 {
+		t.Errorf("expected the idle session to be swept, got %v", d)
+	}
+}
+
+func TestContextListenerActiveSessions(t *testing.T) {
+	c := &gaugeCollector{}
+	l := &ContextListener{Metrics: c, SessionTimeout: time.Hour}
+
+	l.touchSession("a")
+	l.touchSession("b")
+	l.touchSession("a")
+	l.endSession("b")
+
+	if c.value != 1 {
+		t.Errorf("expected one active session, got %v", c.value)
+	}
+
+	l = &ContextListener{Metrics: c, SessionTimeout: time.Millisecond}
+	c.value = 0
+	l.touchSession("a")
+	time.Sleep(5 * time.Millisecond)
+	l.touchSession("b")
+
+	if c.value != 1 {
+		t.Errorf("expected the expired session to be dropped from the gauge, got %v", c.value)
+	}
+}
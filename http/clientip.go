@@ -0,0 +1,252 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// IPRanges is a list of IPv4 and IPv6 networks
+type IPRanges []*net.IPNet
+
+// ParseIPRanges parses CIDRs and single addresses, a single address is a
+// network of its own
+func ParseIPRanges(ranges ...string) (IPRanges, error) {
+	out := make(IPRanges, 0, len(ranges))
+	for _, s := range ranges {
+		n, err := parseIPRange(strings.TrimSpace(s))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+
+	return out, nil
+}
+
+// parseIPRange parses a CIDR or a single IPv4 or IPv6 address
+func parseIPRange(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		return n, err
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid ip address %q", s)
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+func (ranges IPRanges) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range ranges {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseHost parses an address that may carry a port or IPv6 brackets
+func parseHost(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]"))
+}
+
+// Forwarding headers a ClientIPResolver reads the client address from
+const (
+	HeaderForwarded     = "Forwarded"
+	HeaderXForwardedFor = "X-Forwarded-For"
+)
+
+// HeaderXForwardedProto carries the client's scheme if Header is X-Forwarded-For
+const HeaderXForwardedProto = "X-Forwarded-Proto"
+
+// ClientIPResolver determines the client address of a request. Header names the
+// one forwarding header the trusted proxies set, it defaults to X-Forwarded-For.
+// Other forwarding headers are ignored, a client could set them unchecked. Header
+// is only honored if the connection comes from a trusted proxy.
+type ClientIPResolver struct {
+	TrustedProxies IPRanges
+	Header         string
+}
+
+// NewClientIPResolver creates a resolver reading X-Forwarded-For, set Header if
+// the proxies use another header, e.g. HeaderForwarded
+func NewClientIPResolver(trustedProxies ...string) (*ClientIPResolver, error) {
+	ranges, err := ParseIPRanges(trustedProxies...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClientIPResolver{TrustedProxies: ranges, Header: HeaderXForwardedFor}, nil
+}
+
+// forwardedParam returns the values of the parameter name of the Forwarded header
+func forwardedParam(values []string, name string) []string {
+	var out []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(k, name) {
+					out = append(out, strings.Trim(v, `"`))
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+// forwardedFor returns the for= addresses of the Forwarded header, unknown and
+// obfuscated identifiers are returned as nil
+func forwardedFor(values []string) ([]net.IP, bool) {
+	var out []net.IP
+	params := forwardedParam(values, "for")
+	for _, v := range params {
+		out = append(out, parseHost(v))
+	}
+
+	return out, len(params) > 0
+}
+
+func (c *ClientIPResolver) header() string {
+	if c.Header == "" {
+		return HeaderXForwardedFor
+	}
+
+	return http.CanonicalHeaderKey(c.Header)
+}
+
+// forwardedChain returns the addresses of the configured header, it never falls
+// back to another header
+func (c *ClientIPResolver) forwardedChain(r *http.Request) []net.IP {
+	header := c.header()
+	if header == HeaderForwarded {
+		chain, _ := forwardedFor(r.Header.Values(header))
+		return chain
+	}
+
+	var out []net.IP
+	for _, value := range r.Header.Values(header) {
+		for _, addr := range strings.Split(value, ",") {
+			out = append(out, parseHost(addr))
+		}
+	}
+
+	return out
+}
+
+// ClientIP walks the forwarded addresses from the closest hop and returns the
+// first address that is not a trusted proxy. It stops at addresses that cannot
+// be parsed and returns the last trusted hop. Addresses before the first trusted
+// proxy are chosen by the client, so the trusted proxies must append to Header,
+// or replace it, for the result to be reliable.
+func (c *ClientIPResolver) ClientIP(r *http.Request) net.IP {
+	ip := parseHost(r.RemoteAddr)
+	if ip == nil || !c.TrustedProxies.Contains(ip) {
+		return ip
+	}
+
+	chain := c.forwardedChain(r)
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i] == nil {
+			return ip
+		}
+
+		ip = chain[i]
+		if !c.TrustedProxies.Contains(ip) {
+			return ip
+		}
+	}
+
+	return ip
+}
+
+// IsSecure reports whether the client used https. Behind a trusted proxy the
+// scheme is read from the proto= parameter of Forwarded if Header is Forwarded
+// and from X-Forwarded-Proto otherwise, the value of the closest hop applies.
+func (c *ClientIPResolver) IsSecure(r *http.Request) bool {
+	if r.TLS != nil || r.URL.Scheme == "https" {
+		return true
+	}
+
+	ip := parseHost(r.RemoteAddr)
+	if ip == nil || !c.TrustedProxies.Contains(ip) {
+		return false
+	}
+
+	var protos []string
+	if c.header() == HeaderForwarded {
+		protos = forwardedParam(r.Header.Values(HeaderForwarded), "proto")
+	} else {
+		for _, value := range r.Header.Values(HeaderXForwardedProto) {
+			protos = append(protos, strings.Split(value, ",")...)
+		}
+	}
+
+	return len(protos) > 0 && strings.EqualFold(strings.TrimSpace(protos[len(protos)-1]), "https")
+}
+
+type clientIPResolverKey struct{}
+
+// WithClientIPResolver sets the resolver used by ClientIP for the request
+func WithClientIPResolver(r *http.Request, c *ClientIPResolver) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), clientIPResolverKey{}, c))
+}
+
+// NewClientIPMiddleware resolves client addresses of all subsequent handlers,
+// matchers and listeners with c
+func NewClientIPMiddleware(c *ClientIPResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, WithClientIPResolver(r, c))
+		})
+	}
+}
+
+// ClientIP returns the client address of the request using the resolver of the
+// request. Without a resolver it is the address of the connection.
+func ClientIP(r *http.Request) net.IP {
+	if c, ok := r.Context().Value(clientIPResolverKey{}).(*ClientIPResolver); ok && c != nil {
+		return c.ClientIP(r)
+	}
+
+	return parseHost(r.RemoteAddr)
+}
+
+// IsSecure reports whether the client used https, see ClientIPResolver.IsSecure.
+// Without a resolver only the connection is checked.
+func IsSecure(r *http.Request) bool {
+	if c, ok := r.Context().Value(clientIPResolverKey{}).(*ClientIPResolver); ok && c != nil {
+		return c.IsSecure(r)
+	}
+
+	return r.TLS != nil || r.URL.Scheme == "https"
+}
+
+// ClientIPString is ClientIP formatted, it is empty if the address is unknown
+func ClientIPString(r *http.Request) string {
+	if ip := ClientIP(r); ip != nil {
+		return ip.String()
+	}
+
+	return ""
+}
@@ -0,0 +1,142 @@
+package http
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	c, err := NewClientIPResolver("10.0.0.0/8", "2001:db8:ffff::/48")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fwd := &ClientIPResolver{TrustedProxies: c.TrustedProxies, Header: HeaderForwarded}
+
+	tests := []struct {
+		resolver *ClientIPResolver
+		remote   string
+		header   string
+		value    string
+		expected string
+	}{
+		{c, "192.0.2.1:1234", "X-Forwarded-For", "198.51.100.7", "192.0.2.1"},
+		{c, "10.0.0.1:1234", "", "", "10.0.0.1"},
+		{c, "10.0.0.1:1234", "X-Forwarded-For", "198.51.100.7", "198.51.100.7"},
+		{c, "10.0.0.1:1234", "X-Forwarded-For", "203.0.113.9, 198.51.100.7, 10.0.0.2", "198.51.100.7"},
+		{c, "10.0.0.1:1234", "X-Forwarded-For", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{c, "10.0.0.1:1234", "X-Forwarded-For", "garbage, 10.0.0.2", "10.0.0.2"},
+		{c, "10.0.0.1:1234", "Forwarded", `for=192.0.2.60`, "10.0.0.1"},
+		{fwd, "10.0.0.1:1234", "Forwarded", `for=192.0.2.60;proto=http;by=10.0.0.1`, "192.0.2.60"},
+		{fwd, "[2001:db8:ffff::1]:443", "Forwarded", `for="[2001:db8:cafe::17]:4711", for=10.0.0.9`, "2001:db8:cafe::17"},
+		{fwd, "10.0.0.1:1234", "Forwarded", `for=unknown`, "10.0.0.1"},
+		{fwd, "10.0.0.1:1234", "X-Forwarded-For", "198.51.100.7", "10.0.0.1"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remote
+		if test.header != "" {
+			r.Header.Set(test.header, test.value)
+		}
+
+		if got := test.resolver.ClientIP(r).String(); got != test.expected {
+			t.Errorf("%s %s: %q: expected %s, got %s", test.remote, test.header, test.value, test.expected, got)
+		}
+
+		if got := ClientIP(WithClientIPResolver(r, test.resolver)).String(); got != test.expected {
+			t.Errorf("expected the request resolver to return %s, got %s", test.expected, got)
+		}
+	}
+
+	if _, err := NewClientIPResolver("10.0.0.0/33"); err == nil {
+		t.Error("expected invalid range to fail")
+	}
+}
+
+func TestClientIPResolverIgnoresOtherHeaders(t *testing.T) {
+	c, err := NewClientIPResolver("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the proxy appends to X-Forwarded-For, the client set Forwarded itself
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("Forwarded", "for=192.168.1.1")
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+	if got := c.ClientIP(r).String(); got == "192.168.1.1" || got != "203.0.113.7" {
+		t.Errorf("expected the address of X-Forwarded-For, got %s", got)
+	}
+
+	c.Header = HeaderForwarded
+	if got := c.ClientIP(r).String(); got != "192.168.1.1" {
+		t.Errorf("expected the address of Forwarded, got %s", got)
+	}
+
+	r.Header.Del("Forwarded")
+	if got := c.ClientIP(r).String(); got != "10.0.0.1" {
+		t.Errorf("expected no fallback to X-Forwarded-For, got %s", got)
+	}
+}
+
+func TestIsSecure(t *testing.T) {
+	c, err := NewClientIPResolver("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fwd := &ClientIPResolver{TrustedProxies: c.TrustedProxies, Header: HeaderForwarded}
+
+	tests := []struct {
+		resolver *ClientIPResolver
+		remote   string
+		header   string
+		value    string
+		expected bool
+	}{
+		{nil, "10.0.0.1:1234", "X-Forwarded-Proto", "https", false},
+		{c, "10.0.0.1:1234", "", "", false},
+		{c, "10.0.0.1:1234", "X-Forwarded-Proto", "https", true},
+		{c, "10.0.0.1:1234", "X-Forwarded-Proto", "https, http", false},
+		{c, "192.0.2.1:1234", "X-Forwarded-Proto", "https", false},
+		{c, "10.0.0.1:1234", "Forwarded", "for=192.0.2.60;proto=https", false},
+		{fwd, "10.0.0.1:1234", "Forwarded", "for=192.0.2.60;proto=https", true},
+		{fwd, "10.0.0.1:1234", "X-Forwarded-Proto", "https", false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remote
+		if test.header != "" {
+			r.Header.Set(test.header, test.value)
+		}
+
+		if test.resolver != nil {
+			r = WithClientIPResolver(r, test.resolver)
+		}
+
+		if got := IsSecure(r); got != test.expected {
+			t.Errorf("%s %s: %q: expected %v, got %v", test.remote, test.header, test.value, test.expected, got)
+		}
+	}
+}
+
+func TestMatchesIpRange(t *testing.T) {
+	m := NewRequestMatcher(RequestMatcherConfig{IPRange: []string{"192.168.0.0/16", "::1"}}).(*DefaultRequestMatcher)
+
+	tests := map[string]bool{
+		"192.168.10.5:1234": true,
+		"192.169.0.1:1234":  false,
+		"[::1]:1234":        true,
+		"[::2]:1234":        false,
+		"invalid":           false,
+	}
+
+	for remote, expected := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remote
+		if got := m.MatchesIpRange(r); got != expected {
+			t.Errorf("%s: expected %v, got %v", remote, expected, got)
+		}
+	}
+}
@@ -0,0 +1,528 @@
+package http
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func quoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+func joinMatchers(ms []RequestMatcher) string {
+	out := make([]string, len(ms))
+	for i, m := range ms {
+		out[i] = fmt.Sprint(m)
+	}
+
+	return strings.Join(out, ", ")
+}
+
+type andMatcher []RequestMatcher
+
+func (m andMatcher) Matches(r *http.Request) bool {
+	for _, matcher := range m {
+		if !matcher.Matches(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m andMatcher) String() string {
+	return "And(" + joinMatchers(m) + ")"
+}
+
+// And matches requests matched by all matchers, it matches any request if empty
+func And(matchers ...RequestMatcher) RequestMatcher {
+	return andMatcher(matchers)
+}
+
+type orMatcher []RequestMatcher
+
+func (m orMatcher) Matches(r *http.Request) bool {
+	for _, matcher := range m {
+		if matcher.Matches(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m orMatcher) String() string {
+	return "Or(" + joinMatchers(m) + ")"
+}
+
+// Or matches requests matched by any of the matchers, it matches no request if empty
+func Or(matchers ...RequestMatcher) RequestMatcher {
+	return orMatcher(matchers)
+}
+
+type notMatcher struct {
+	matcher RequestMatcher
+}
+
+func (m notMatcher) Matches(r *http.Request) bool {
+	return !m.matcher.Matches(r)
+}
+
+func (m notMatcher) String() string {
+	return fmt.Sprintf("Not(%v)", m.matcher)
+}
+
+func Not(matcher RequestMatcher) RequestMatcher {
+	return notMatcher{matcher: matcher}
+}
+
+type funcMatcher struct {
+	name string
+	f    func(r *http.Request) bool
+}
+
+func (m funcMatcher) Matches(r *http.Request) bool {
+	return m.f(r)
+}
+
+func (m funcMatcher) String() string {
+	return fmt.Sprintf("Func(%q)", m.name)
+}
+
+// Func matches requests with a custom function, name describes it in String
+func Func(name string, f func(r *http.Request) bool) RequestMatcher {
+	return funcMatcher{name: name, f: f}
+}
+
+type pathMatcher string
+
+func (m pathMatcher) Matches(r *http.Request) bool {
+	return r.URL.Path == string(m)
+}
+
+func (m pathMatcher) String() string {
+	return fmt.Sprintf("Path(%q)", string(m))
+}
+
+// Path matches the exact request path
+func Path(p string) RequestMatcher {
+	return pathMatcher(p)
+}
+
+type pathPrefixMatcher string
+
+func (m pathPrefixMatcher) Matches(r *http.Request) bool {
+	prefix := string(m)
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		return false
+	}
+
+	return strings.HasSuffix(prefix, "/") || len(r.URL.Path) == len(prefix) || r.URL.Path[len(prefix)] == '/'
+}
+
+func (m pathPrefixMatcher) String() string {
+	return fmt.Sprintf("PathPrefix(%q)", string(m))
+}
+
+// PathPrefix matches paths starting with prefix at a segment boundary, i.e.
+// "/api" matches "/api" and "/api/users" but not "/apis"
+func PathPrefix(prefix string) RequestMatcher {
+	return pathPrefixMatcher(prefix)
+}
+
+type pathGlobMatcher struct {
+	pattern  string
+	segments []string
+}
+
+func matchSegments(pattern []string, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(segments); i >= 0; i-- {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+
+		pattern, segments = pattern[1:], segments[1:]
+	}
+
+	return len(segments) == 0
+}
+
+func (m pathGlobMatcher) Matches(r *http.Request) bool {
+	return matchSegments(m.segments, strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/"))
+}
+
+func (m pathGlobMatcher) String() string {
+	return fmt.Sprintf("PathGlob(%q)", m.pattern)
+}
+
+// PathGlob matches paths against a glob pattern. "*" matches within a path
+// segment, "**" matches any number of segments, e.g. "/api/**" matches "/api"
+// and everything below it. PathGlob panics if the pattern is invalid.
+func PathGlob(pattern string) RequestMatcher {
+	segments := strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	for _, s := range segments {
+		if _, err := path.Match(s, ""); err != nil {
+			panic(fmt.Sprintf("invalid path glob %q: %v", pattern, err))
+		}
+	}
+
+	return pathGlobMatcher{pattern: pattern, segments: segments}
+}
+
+type methodMatcher []string
+
+func (m methodMatcher) Matches(r *http.Request) bool {
+	for _, method := range m {
+		if strings.EqualFold(method, r.Method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m methodMatcher) String() string {
+	return "Methods(" + quoteAll(m) + ")"
+}
+
+func Methods(methods ...string) RequestMatcher {
+	return methodMatcher(methods)
+}
+
+type hostMatcher []string
+
+func requestHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		return host
+	}
+
+	return r.Host
+}
+
+func (m hostMatcher) Matches(r *http.Request) bool {
+	host := requestHost(r)
+	for _, h := range m {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m hostMatcher) String() string {
+	return "Host(" + quoteAll(m) + ")"
+}
+
+// Host matches the request host ignoring the port
+func Host(hosts ...string) RequestMatcher {
+	return hostMatcher(hosts)
+}
+
+type portMatcher []int
+
+func requestPort(r *http.Request) int {
+	if _, port, err := net.SplitHostPort(r.Host); err == nil {
+		if p, err := strconv.Atoi(port); err == nil {
+			return p
+		}
+	}
+
+	if r.TLS != nil || r.URL.Scheme == "https" {
+		return 443
+	}
+
+	return 80
+}
+
+func (m portMatcher) Matches(r *http.Request) bool {
+	port := requestPort(r)
+	for _, p := range m {
+		if p == port {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m portMatcher) String() string {
+	ports := make([]string, len(m))
+	for i, p := range m {
+		ports[i] = strconv.Itoa(p)
+	}
+
+	return "Port(" + strings.Join(ports, ", ") + ")"
+}
+
+// Port matches the port of the request host, defaulting to 443 for TLS and 80
+// otherwise
+func Port(ports ...int) RequestMatcher {
+	return portMatcher(ports)
+}
+
+type headerMatcher struct {
+	name  string
+	value string
+}
+
+func (m headerMatcher) Matches(r *http.Request) bool {
+	for _, v := range r.Header.Values(m.name) {
+		if v == m.value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m headerMatcher) String() string {
+	return fmt.Sprintf("Header(%q, %q)", m.name, m.value)
+}
+
+// Header matches requests with a header value equal to value
+func Header(name string, value string) RequestMatcher {
+	return headerMatcher{name: name, value: value}
+}
+
+type headerRegexpMatcher struct {
+	name string
+	exp  *regexp.Regexp
+}
+
+func (m headerRegexpMatcher) Matches(r *http.Request) bool {
+	for _, v := range r.Header.Values(m.name) {
+		if m.exp.MatchString(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m headerRegexpMatcher) String() string {
+	return fmt.Sprintf("HeaderRegexp(%q, %q)", m.name, m.exp.String())
+}
+
+// HeaderRegexp matches requests with a header value matching expr, it panics
+// if expr is invalid
+func HeaderRegexp(name string, expr string) RequestMatcher {
+	return headerRegexpMatcher{name: name, exp: regexp.MustCompile(expr)}
+}
+
+type queryMatcher struct {
+	name  string
+	value string
+}
+
+func (m queryMatcher) Matches(r *http.Request) bool {
+	values, ok := r.URL.Query()[m.name]
+	if !ok || m.value == "" {
+		return ok
+	}
+
+	for _, v := range values {
+		if v == m.value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m queryMatcher) String() string {
+	if m.value == "" {
+		return fmt.Sprintf("Query(%q)", m.name)
+	}
+
+	return fmt.Sprintf("Query(%q, %q)", m.name, m.value)
+}
+
+// Query matches requests with a query parameter equal to value, an empty value
+// matches any request carrying the parameter
+func Query(name string, value string) RequestMatcher {
+	return queryMatcher{name: name, value: value}
+}
+
+// mediaTypeMatches reports whether pattern, e.g. "application/*", covers mediaType
+func mediaTypeMatches(pattern string, mediaType string) bool {
+	if pattern == "*/*" || strings.EqualFold(pattern, mediaType) {
+		return true
+	}
+
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(strings.ToLower(mediaType), strings.ToLower(strings.TrimSuffix(pattern, "*")))
+	}
+
+	return false
+}
+
+type contentTypeMatcher []string
+
+func (m contentTypeMatcher) Matches(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	for _, t := range m {
+		if mediaTypeMatches(t, mediaType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m contentTypeMatcher) String() string {
+	return "ContentType(" + quoteAll(m) + ")"
+}
+
+// ContentType matches the media type of the request body ignoring parameters,
+// types may use wildcards like "text/*"
+func ContentType(types ...string) RequestMatcher {
+	return contentTypeMatcher(types)
+}
+
+type acceptMatcher []string
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+func parseAccept(header string) []acceptRange {
+	var out []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		out = append(out, acceptRange{mediaType: mediaType, q: q})
+	}
+
+	return out
+}
+
+// quality returns the q-value of the most specific range covering mediaType, 0
+// if none covers it
+func quality(ranges []acceptRange, mediaType string) float64 {
+	best, specificity := 0.0, -1
+	for _, ar := range ranges {
+		if !mediaTypeMatches(ar.mediaType, mediaType) {
+			continue
+		}
+
+		s := 2
+		switch {
+		case ar.mediaType == "*/*":
+			s = 0
+		case strings.HasSuffix(ar.mediaType, "/*"):
+			s = 1
+		}
+
+		if s > specificity {
+			best, specificity = ar.q, s
+		}
+	}
+
+	return best
+}
+
+func accepts(ranges []acceptRange, mediaType string) bool {
+	return quality(ranges, mediaType) > 0
+}
+
+// AcceptQuality returns the q-value the Accept header of r gives mediaType, the
+// most specific matching range applies. Without an Accept header any type is
+// accepted with 1.
+func AcceptQuality(r *http.Request, mediaType string) float64 {
+	header := strings.Join(r.Header.Values("Accept"), ",")
+	if header == "" {
+		return 1
+	}
+
+	return quality(parseAccept(header), mediaType)
+}
+
+func (m acceptMatcher) Matches(r *http.Request) bool {
+	header := strings.Join(r.Header.Values("Accept"), ",")
+	if header == "" {
+		return true
+	}
+
+	ranges := parseAccept(header)
+	for _, t := range m {
+		if accepts(ranges, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m acceptMatcher) String() string {
+	return "Accepts(" + quoteAll(m) + ")"
+}
+
+// Accepts matches requests whose Accept header allows any of the media types.
+// Requests without an Accept header accept any type.
+func Accepts(types ...string) RequestMatcher {
+	return acceptMatcher(types)
+}
+
+type ipRangeMatcher struct {
+	ranges []string
+	nets   IPRanges
+}
+
+func (m ipRangeMatcher) Matches(r *http.Request) bool {
+	return m.nets.Contains(ClientIP(r))
+}
+
+func (m ipRangeMatcher) String() string {
+	return "IPRange(" + quoteAll(m.ranges) + ")"
+}
+
+// IPRange matches the client address, as resolved by ClientIP, against CIDRs or
+// single addresses of IPv4 and IPv6. It panics if a range is invalid.
+func IPRange(ranges ...string) RequestMatcher {
+	nets, err := ParseIPRanges(ranges...)
+	if err != nil {
+		panic(err)
+	}
+
+	return ipRangeMatcher{ranges: ranges, nets: nets}
+}
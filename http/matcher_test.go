@@ -0,0 +1,101 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPathMatchers(t *testing.T) {
+	tests := []struct {
+		matcher  RequestMatcher
+		path     string
+		expected bool
+	}{
+		{Path("/login"), "/login", true},
+		{Path("/login"), "/login/", false},
+		{PathPrefix("/api"), "/api", true},
+		{PathPrefix("/api"), "/api/users", true},
+		{PathPrefix("/api"), "/apis", false},
+		{PathPrefix("/api/"), "/api/users", true},
+		{PathGlob("/api/**"), "/api", true},
+		{PathGlob("/api/**"), "/api/users/1", true},
+		{PathGlob("/api/**"), "/apis/users", false},
+		{PathGlob("/api/*/edit"), "/api/users/edit", true},
+		{PathGlob("/api/*/edit"), "/api/users/1/edit", false},
+		{PathGlob("/**/*.json"), "/a/b/c.json", true},
+		{PathGlob("/**/*.json"), "/a/b/c.xml", false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.path, nil)
+		if got := test.matcher.Matches(r); got != test.expected {
+			t.Errorf("%v on %s: expected %v, got %v", test.matcher, test.path, test.expected, got)
+		}
+	}
+}
+
+func TestRequestMatchers(t *testing.T) {
+	r := httptest.NewRequest("POST", "http://example.org:8443/api/users?page=2", strings.NewReader("{}"))
+	r.RemoteAddr = "[2001:db8::1]:4711"
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	r.Header.Set("Accept", "text/html, application/*;q=0.5, application/xml;q=0")
+	r.Header.Set("X-Version", "v2.1")
+
+	tests := []struct {
+		matcher  RequestMatcher
+		expected bool
+	}{
+		{Methods("GET", "post"), true},
+		{Host("EXAMPLE.org"), true},
+		{Port(8443), true},
+		{Port(443), false},
+		{Header("X-Version", "v2.1"), true},
+		{HeaderRegexp("X-Version", `^v2\.`), true},
+		{HeaderRegexp("X-Version", `^v3\.`), false},
+		{Query("page", ""), true},
+		{Query("page", "2"), true},
+		{Query("page", "3"), false},
+		{ContentType("application/json"), true},
+		{ContentType("text/*"), false},
+		{Accepts("application/json"), true},
+		{Accepts("application/xml"), false},
+		{Accepts("image/png"), false},
+		{IPRange("2001:db8::/32"), true},
+		{IPRange("10.0.0.0/8", "127.0.0.1"), false},
+		{Or(), false},
+		{And(), true},
+		{Func("always", func(*http.Request) bool { return true }), true},
+	}
+
+	for _, test := range tests {
+		if got := test.matcher.Matches(r); got != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.matcher, test.expected, got)
+		}
+	}
+}
+
+func TestComposedMatcher(t *testing.T) {
+	m := And(Methods("POST"), PathGlob("/api/**"), ContentType("application/json"), Not(IPRange("10.0.0.0/8")))
+
+	newRequest := func(remoteAddr string) *http.Request {
+		r := httptest.NewRequest("POST", "/api/orders", strings.NewReader("{}"))
+		r.Header.Set("Content-Type", "application/json")
+		r.RemoteAddr = remoteAddr
+		return r
+	}
+
+	if !m.Matches(newRequest("192.0.2.10:1234")) {
+		t.Error("expected external request to match")
+	}
+
+	if m.Matches(newRequest("10.1.2.3:1234")) {
+		t.Error("expected internal request not to match")
+	}
+
+	expected := `And(Methods("POST"), PathGlob("/api/**"), ContentType("application/json"), Not(IPRange("10.0.0.0/8")))`
+	if s := m.(interface{ String() string }).String(); s != expected {
+		t.Errorf("expected %s, got %s", expected, s)
+	}
+}
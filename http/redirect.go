@@ -0,0 +1,30 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// IsSafeRedirect reports whether target stays on the origin of the request. Relative
+// paths are allowed, protocol relative urls and urls to other hosts are not.
+func IsSafeRedirect(r *http.Request, target string) bool {
+	if target == "" || strings.ContainsAny(target, "\\\r\n") {
+		return false
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+
+	if u.Scheme == "" && u.Host == "" {
+		return strings.HasPrefix(u.Path, "/") && !strings.HasPrefix(target, "//")
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host)
+}
@@ -0,0 +1,28 @@
+package http
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsSafeRedirect(t *testing.T) {
+	r := httptest.NewRequest("POST", "http://example.org/login", nil)
+
+	tests := map[string]bool{
+		"/secure/area?x=1":             true,
+		"http://example.org/secure":    true,
+		"":                             false,
+		"secure":                       false,
+		"//evil.org/":                  false,
+		"/\\evil.org":                  false,
+		"https://evil.org/":            false,
+		"javascript:alert(1)":          false,
+		"http://example.org.evil.org/": false,
+	}
+
+	for target, expected := range tests {
+		if got := IsSafeRedirect(r, target); got != expected {
+			t.Errorf("%q: expected %v, got %v", target, expected, got)
+		}
+	}
+}
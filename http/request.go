@@ -1,7 +1,7 @@
 package http
 
 import (
-	"net"
+	"fmt"
 	"net/http"
 	"regexp"
 	"strings"
@@ -19,24 +19,33 @@ type RequestMatcherConfig struct {
 	Schemes []string `json:"schemes"`
 }
 
+// NewRequestMatcher creates a matcher from config. Path and Host are regular
+// expressions, empty values match any request. IPRange holds CIDRs or single
+// addresses matched against the client address as resolved by ClientIP.
 func NewRequestMatcher(config RequestMatcherConfig) RequestMatcher {
 
-	pathExp, err := regexp.Compile("/" + config.Path + "/")
+	pathExp, err := regexp.Compile(config.Path)
 	if err != nil {
 		panic(err)
 	}
 
-	hostExp, err := regexp.Compile("/" + config.Host + "/")
+	hostExp, err := regexp.Compile(config.Host)
+	if err != nil {
+		panic(err)
+	}
+
+	nets, err := ParseIPRanges(config.IPRange...)
 	if err != nil {
 		panic(err)
 	}
 
 	r := &DefaultRequestMatcher{
-		path:    hostExp,
-		host:    pathExp,
+		path:    pathExp,
+		host:    hostExp,
 		methods: config.Methods,
 		schemes: config.Schemes,
 		ips:     config.IPRange,
+		nets:    nets,
 	}
 
 	return r
@@ -47,6 +56,7 @@ type DefaultRequestMatcher struct {
 	host    *regexp.Regexp
 	methods []string
 	ips     []string
+	nets    IPRanges
 	schemes []string
 }
 
@@ -58,8 +68,29 @@ func (m *DefaultRequestMatcher) Matches(r *http.Request) bool {
 		m.MatchesIpRange(r)
 }
 
+func (m *DefaultRequestMatcher) String() string {
+	var parts []string
+	if p := m.path.String(); p != "" {
+		parts = append(parts, fmt.Sprintf("path=%q", p))
+	}
+	if h := m.host.String(); h != "" {
+		parts = append(parts, fmt.Sprintf("host=%q", h))
+	}
+	if len(m.methods) > 0 {
+		parts = append(parts, "methods=["+quoteAll(m.methods)+"]")
+	}
+	if len(m.schemes) > 0 {
+		parts = append(parts, "schemes=["+quoteAll(m.schemes)+"]")
+	}
+	if len(m.ips) > 0 {
+		parts = append(parts, "ipRange=["+quoteAll(m.ips)+"]")
+	}
+
+	return "RequestMatcher(" + strings.Join(parts, ", ") + ")"
+}
+
 func (m *DefaultRequestMatcher) MatchesPath(r *http.Request) bool {
-	return m.path.Match([]byte(r.RequestURI))
+	return m.path.MatchString(r.URL.Path)
 }
 
 func (m *DefaultRequestMatcher) MatchesMethod(r *http.Request) bool {
@@ -68,7 +99,7 @@ func (m *DefaultRequestMatcher) MatchesMethod(r *http.Request) bool {
 	}
 
 	for _, m := range m.methods {
-		if m == strings.ToLower(r.Method) {
+		if strings.EqualFold(m, r.Method) {
 			return true
 		}
 	}
@@ -99,13 +130,5 @@ func (m *DefaultRequestMatcher) MatchesIpRange(r *http.Request) bool {
 		return true
 	}
 
-	_, subnet, _ := net.ParseCIDR(r.RemoteAddr)
-	for _, clientIP := range m.ips {
-		ip := net.ParseIP(clientIP)
-		if subnet.Contains(ip) {
-			return true
-		}
-	}
-
-	return false
+	return m.nets.Contains(ClientIP(r))
 }
@@ -1,8 +1,11 @@
 package http
 
 import (
-	"github.com/gorilla/mux"
+	"context"
+	"log/slog"
 	"net/http"
+
+	"github.com/gorilla/mux"
 )
 
 type Handler func(http.ResponseWriter, *http.Request) (int, error)
@@ -47,3 +50,31 @@ func MuxMiddleware(handlerFunc http.HandlerFunc) mux.MiddlewareFunc {
 		})
 	}
 }
+
+// ErrorHandler turns errors of a request into a response
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+type errorHandlerKey struct{}
+
+// WithErrorHandler sets the handler that Fail reports errors of the request to
+func WithErrorHandler(r *http.Request, h ErrorHandler) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), errorHandlerKey{}, h))
+}
+
+// Fail reports err to the error handler of the request. Without an error handler
+// it logs err and responds with the status text of the status code of an Error
+// or 500, error messages are never written to the response.
+func Fail(w http.ResponseWriter, r *http.Request, err error) {
+	if h, ok := r.Context().Value(errorHandlerKey{}).(ErrorHandler); ok {
+		h(w, r, err)
+		return
+	}
+
+	code := http.StatusInternalServerError
+	if e, ok := err.(Error); ok {
+		code = e.StatusCode()
+	}
+
+	slog.Default().Warn("request failed", "path", r.URL.Path, "status", code, "error", err)
+	http.Error(w, http.StatusText(code), code)
+}
@@ -28,11 +28,19 @@ type Identity interface {
 	Refresh()
 }
 
+// AttributeIdentity exposes additional attributes of an identity, e.g. its
+// department, to attribute based policies
+type AttributeIdentity interface {
+	Identity
+	Attributes() map[string]interface{}
+}
+
 type InMemoryIdentity struct {
-	UserId         interface{} `json:"id"`
-	UserCredential interface{} `json:"credential"`
-	UserPass       interface{} `json:"password"`
-	UserRoles      []role.Role `json:"roles"`
+	UserId         interface{}            `json:"id"`
+	UserCredential interface{}            `json:"credential"`
+	UserPass       interface{}            `json:"password"`
+	UserRoles      []role.Role            `json:"roles"`
+	UserAttributes map[string]interface{} `json:"attributes"`
 }
 
 func (i *InMemoryIdentity) ID() interface{} {
@@ -51,6 +59,10 @@ func (i *InMemoryIdentity) Roles() []role.Role {
 	return i.UserRoles
 }
 
+func (i *InMemoryIdentity) Attributes() map[string]interface{} {
+	return i.UserAttributes
+}
+
 func (i *InMemoryIdentity) IsBanned() bool {
 	return false
 }
@@ -1,6 +1,7 @@
 package identity
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/iwyg/goauth/role"
@@ -15,14 +16,31 @@ type Provider interface {
 	Supports(identity Identity) bool
 }
 
+// ContextProvider is implemented by providers whose lookups use the context of
+// the authentication, e.g. to cancel queries or to continue traces
+type ContextProvider interface {
+	ProvideContext(ctx context.Context, id interface{}) (Identity, error)
+}
+
+// ProvideContext looks up id with ctx if p is a ContextProvider and with
+// Provide otherwise
+func ProvideContext(ctx context.Context, p Provider, id interface{}) (Identity, error) {
+	if cp, ok := p.(ContextProvider); ok {
+		return cp.ProvideContext(ctx, id)
+	}
+
+	return p.Provide(id)
+}
+
 type inMemoryIdentityJSONMap struct {
 	Users map[string]*inMemoryIdentityJSON `json:"users"`
 }
 
 type inMemoryIdentityJSON struct {
-	ID       interface{} `json:"UserId"`
-	Password interface{} `json:"UserPass"`
-	Roles    []role.Role `json:"UserRoles"`
+	ID         interface{}            `json:"UserId"`
+	Password   interface{}            `json:"UserPass"`
+	Roles      []role.Role            `json:"UserRoles"`
+	Attributes map[string]interface{} `json:"UserAttributes"`
 }
 
 func loadInMemoryIdentitiesFromConfig(config InMemoryProviderConfig) (map[interface{}]Identity, error) {
@@ -49,12 +67,33 @@ func loadInMemoryIdentitiesFromConfig(config InMemoryProviderConfig) (map[interf
 			UserCredential: c,
 			UserPass:       u.Password,
 			UserRoles:      u.Roles,
+			UserAttributes: u.Attributes,
 		}
 	}
 
 	return usersMap, nil
 }
 
+// NewInMemoryIdentityProvider provides the given identities keyed by credential
+func NewInMemoryIdentityProvider(users map[interface{}]Identity) *InMemoryProvider {
+	return &InMemoryProvider{users: users}
+}
+
+// LoadInMemoryProvider reads the users file of config, it returns the error
+// NewInMemoryProvider panics with
+func LoadInMemoryProvider(config InMemoryProviderConfig) (*InMemoryProvider, error) {
+	reload := func() (map[interface{}]Identity, error) {
+		return loadInMemoryIdentitiesFromConfig(config)
+	}
+
+	usersMap, err := reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return &InMemoryProvider{users: usersMap, refresh: reload}, nil
+}
+
 func NewInMemoryProvider(config InMemoryProviderConfig) *InMemoryProvider {
 	reload := func() (map[interface{}]Identity, error) {
 		return loadInMemoryIdentitiesFromConfig(config)
@@ -0,0 +1,137 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Redacted replaces the values of secret attributes
+const Redacted = "[REDACTED]"
+
+// DefaultSecretKeys are redacted in every attribute whose key contains one of them
+var DefaultSecretKeys = []string{
+	"password", "pass", "secret", "token", "credential", "authorization", "cookie", "csrf", "session", "key",
+}
+
+// Options configures the logger of a middleware
+type Options struct {
+	Logger     *slog.Logger
+	SecretKeys []string
+}
+
+type Option func(o *Options)
+
+// WithLogger logs to l instead of slog.Default()
+func WithLogger(l *slog.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// WithSecretKeys adds attribute keys whose values are redacted
+func WithSecretKeys(keys ...string) Option {
+	return func(o *Options) {
+		o.SecretKeys = append(o.SecretKeys, keys...)
+	}
+}
+
+// New creates the logger configured by opts. Its records are redacted.
+func New(opts ...Option) *slog.Logger {
+	o := &Options{SecretKeys: DefaultSecretKeys}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	l := o.Logger
+	if l == nil {
+		l = slog.Default()
+	}
+
+	return slog.New(NewRedactHandler(l.Handler(), o.SecretKeys...))
+}
+
+// securityToken matches token.Token without importing it, so the token package can log
+type securityToken interface {
+	IsFullyAuthenticated() bool
+}
+
+// RedactHandler replaces the values of secret attributes and of attributes holding
+// tokens, which only log their type
+type RedactHandler struct {
+	next slog.Handler
+	keys []string
+}
+
+func NewRedactHandler(next slog.Handler, keys ...string) *RedactHandler {
+	lower := make([]string, len(keys))
+	for i, k := range keys {
+		lower[i] = strings.ToLower(k)
+	}
+
+	return &RedactHandler{next: next, keys: lower}
+}
+
+func (h *RedactHandler) isSecret(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range h.keys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *RedactHandler) redact(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+
+	if v.Kind() == slog.KindGroup {
+		attrs := v.Group()
+		out := make([]slog.Attr, len(attrs))
+		for i, ga := range attrs {
+			out[i] = h.redact(ga)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(out...)}
+	}
+
+	if v.Kind() == slog.KindAny {
+		if _, ok := v.Any().(securityToken); ok {
+			return slog.String(a.Key, fmt.Sprintf("%T", v.Any()))
+		}
+	}
+
+	if h.isSecret(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+func (h *RedactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.redact(a))
+		return true
+	})
+
+	return h.next.Handle(ctx, out)
+}
+
+func (h *RedactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		out[i] = h.redact(a)
+	}
+
+	return &RedactHandler{next: h.next.WithAttrs(out), keys: h.keys}
+}
+
+func (h *RedactHandler) WithGroup(name string) slog.Handler {
+	return &RedactHandler{next: h.next.WithGroup(name), keys: h.keys}
+}
@@ -0,0 +1,34 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/token"
+)
+
+func TestRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(WithLogger(slog.New(slog.NewTextHandler(&buf, nil))), WithSecretKeys("ssn"))
+
+	tok := token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserId: "42", UserPass: "hunter2"})
+	l.With("api_key", "abc123").Info("login",
+		"password", "hunter2",
+		"user", tok,
+		slog.Group("client", "ssn", "123-45-6789", "ip", "10.0.0.1"),
+	)
+
+	out := buf.String()
+	for _, secret := range []string{"hunter2", "abc123", "123-45-6789"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("expected %s to be redacted: %s", secret, out)
+		}
+	}
+
+	if !strings.Contains(out, "10.0.0.1") {
+		t.Errorf("expected non secret attributes to be logged: %s", out)
+	}
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/iwyg/goauth/identity"
+)
+
+type instrumentedProvider struct {
+	identity.Provider
+	collector Collector
+	name      string
+}
+
+func (p *instrumentedProvider) observe(op string, start time.Time, err error) {
+	outcome := OutcomeSuccess
+	if err != nil {
+		outcome = OutcomeFailure
+	}
+
+	ObserveSince(p.collector, IdentityLookup, Labels{"provider": p.name, "operation": op, "outcome": outcome}, start)
+}
+
+func (p *instrumentedProvider) Provide(id interface{}) (identity.Identity, error) {
+	start := time.Now()
+	ident, err := p.Provider.Provide(id)
+	p.observe("provide", start, err)
+
+	return ident, err
+}
+
+func (p *instrumentedProvider) ProvideContext(ctx context.Context, id interface{}) (identity.Identity, error) {
+	start := time.Now()
+	ident, err := identity.ProvideContext(ctx, p.Provider, id)
+	p.observe("provide", start, err)
+
+	return ident, err
+}
+
+func (p *instrumentedProvider) Refresh(id identity.Identity) (identity.Identity, error) {
+	start := time.Now()
+	ident, err := p.Provider.Refresh(id)
+	p.observe("refresh", start, err)
+
+	return ident, err
+}
+
+// InstrumentProvider records the latency of identity lookups of p. name labels
+// the provider and defaults to its type.
+func InstrumentProvider(p identity.Provider, c Collector, name string) identity.Provider {
+	if p == nil || c == nil {
+		return p
+	}
+
+	if ip, ok := p.(*instrumentedProvider); ok {
+		p = ip.Provider
+	}
+
+	if name == "" {
+		name = fmt.Sprintf("%T", p)
+	}
+
+	return &instrumentedProvider{Provider: p, collector: c, name: name}
+}
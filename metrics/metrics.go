@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"time"
+)
+
+// Metrics recorded by the library
+const (
+	LoginAttempts     = "goauth_login_attempts_total"
+	LoginDuration     = "goauth_login_duration_seconds"
+	TokenVerification = "goauth_token_verification_seconds"
+	IdentityLookup    = "goauth_identity_lookup_seconds"
+	AccessDenied      = "goauth_access_denied_total"
+	ActiveSessions    = "goauth_active_sessions"
+	FirewallRequests  = "goauth_firewall_requests_total"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Descriptions are the help texts of the library's metrics
+var Descriptions = map[string]string{
+	LoginAttempts:     "Authentication attempts by authenticator and outcome.",
+	LoginDuration:     "Duration of authentication attempts in seconds.",
+	TokenVerification: "Duration of refreshing the identities of session tokens in seconds.",
+	IdentityLookup:    "Duration of identity provider calls in seconds by provider, operation and outcome.",
+	AccessDenied:      "Requests denied by access rule.",
+	ActiveSessions:    "Authenticated sessions that were used within the session timeout.",
+	FirewallRequests:  "Requests handled by firewall and outcome.",
+}
+
+type Labels map[string]string
+
+// Collector records metrics. Counters and gauges are changed by delta,
+// histograms observe a value.
+type Collector interface {
+	Counter(name string, labels Labels, delta float64)
+	Gauge(name string, labels Labels, delta float64)
+	Histogram(name string, labels Labels, value float64)
+}
+
+// Count increments a counter if c is not nil
+func Count(c Collector, name string, labels Labels) {
+	if c != nil {
+		c.Counter(name, labels, 1)
+	}
+}
+
+// AddGauge changes a gauge if c is not nil
+func AddGauge(c Collector, name string, labels Labels, delta float64) {
+	if c != nil {
+		c.Gauge(name, labels, delta)
+	}
+}
+
+// Observe records a histogram value if c is not nil
+func Observe(c Collector, name string, labels Labels, value float64) {
+	if c != nil {
+		c.Histogram(name, labels, value)
+	}
+}
+
+// ObserveSince records the seconds passed since start if c is not nil
+func ObserveSince(c Collector, name string, labels Labels, start time.Time) {
+	Observe(c, name, labels, time.Since(start).Seconds())
+}
@@ -0,0 +1,272 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of histogram buckets in seconds, NewRegistry
+// copies them
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+type series struct {
+	labels  Labels
+	value   float64
+	counts  []uint64
+	sum     float64
+	samples uint64
+}
+
+type family struct {
+	kind   string
+	series map[string]*series
+}
+
+// Registry is an in memory collector serving its metrics in the Prometheus
+// text exposition format
+type Registry struct {
+	buckets []float64
+
+	mu       sync.Mutex
+	families map[string]*family
+	help     map[string]string
+}
+
+// NewRegistry creates a registry whose histograms use the given bucket upper
+// bounds, or DefaultBuckets
+func NewRegistry(buckets ...float64) *Registry {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	b := make([]float64, len(buckets))
+	copy(b, buckets)
+	sort.Float64s(b)
+
+	r := &Registry{buckets: b, families: make(map[string]*family), help: make(map[string]string)}
+	for name, help := range Descriptions {
+		r.help[name] = help
+	}
+
+	return r
+}
+
+// Describe sets the help text of a metric
+func (r *Registry) Describe(name string, help string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.help[name] = help
+}
+
+func labelKey(labels Labels) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", k, escapeLabel(labels[k]))
+	}
+
+	return b.String()
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// get returns the series, the caller must hold the lock
+func (r *Registry) get(name string, kind string, labels Labels) *series {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{kind: kind, series: make(map[string]*series)}
+		r.families[name] = f
+	}
+
+	if f.kind != kind {
+		return nil
+	}
+
+	key := labelKey(labels)
+	s, ok := f.series[key]
+	if !ok {
+		copied := make(Labels, len(labels))
+		for k, v := range labels {
+			copied[k] = v
+		}
+		s = &series{labels: copied}
+		if kind == kindHistogram {
+			s.counts = make([]uint64, len(r.buckets))
+		}
+		f.series[key] = s
+	}
+
+	return s
+}
+
+// Counter adds delta to a counter. Metrics are typed by their first use, recording
+// a metric as another type is ignored.
+func (r *Registry) Counter(name string, labels Labels, delta float64) {
+	if delta < 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s := r.get(name, kindCounter, labels); s != nil {
+		s.value += delta
+	}
+}
+
+func (r *Registry) Gauge(name string, labels Labels, delta float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s := r.get(name, kindGauge, labels); s != nil {
+		s.value += delta
+	}
+}
+
+func (r *Registry) Histogram(name string, labels Labels, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.get(name, kindHistogram, labels)
+	if s == nil {
+		return
+	}
+
+	for i, le := range r.buckets {
+		if value <= le {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.samples++
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func withLabel(key string, label string) string {
+	if key == "" {
+		return "{" + label + "}"
+	}
+
+	return "{" + key + "," + label + "}"
+}
+
+func braces(key string) string {
+	if key == "" {
+		return ""
+	}
+
+	return "{" + key + "}"
+}
+
+type familySnapshot struct {
+	name   string
+	help   string
+	kind   string
+	series []seriesSnapshot
+}
+
+type seriesSnapshot struct {
+	key string
+	series
+}
+
+// snapshot copies the metrics sorted by name and labels, so they can be written
+// without holding the lock
+func (r *Registry) snapshot() []familySnapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	families := make([]familySnapshot, 0, len(names))
+	for _, name := range names {
+		f := r.families[name]
+		fs := familySnapshot{name: name, help: r.help[name], kind: f.kind}
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := *f.series[key]
+			s.counts = append([]uint64(nil), s.counts...)
+			fs.series = append(fs.series, seriesSnapshot{key: key, series: s})
+		}
+
+		families = append(families, fs)
+	}
+
+	return families
+}
+
+// ServeHTTP writes all metrics in the text exposition format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	families := r.snapshot()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	for _, f := range families {
+		if f.help != "" {
+			fmt.Fprintf(out, "# HELP %s %s\n", f.name, f.help)
+		}
+		fmt.Fprintf(out, "# TYPE %s %s\n", f.name, f.kind)
+
+		for _, s := range f.series {
+			name, key := f.name, s.key
+
+			if f.kind != kindHistogram {
+				fmt.Fprintf(out, "%s%s %s\n", name, braces(key), formatFloat(s.value))
+				continue
+			}
+
+			for i, le := range r.buckets {
+				fmt.Fprintf(out, "%s_bucket%s %d\n", name, withLabel(key, `le="`+formatFloat(le)+`"`), s.counts[i])
+			}
+			fmt.Fprintf(out, "%s_bucket%s %d\n", name, withLabel(key, `le="+Inf"`), s.samples)
+			fmt.Fprintf(out, "%s_sum%s %s\n", name, braces(key), formatFloat(s.sum))
+			fmt.Fprintf(out, "%s_count%s %d\n", name, braces(key), s.samples)
+		}
+	}
+}
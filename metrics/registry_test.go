@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryExposition(t *testing.T) {
+	r := NewRegistry(1, 0.1)
+
+	Count(r, LoginAttempts, Labels{"authenticator": "form", "outcome": OutcomeSuccess})
+	Count(r, LoginAttempts, Labels{"outcome": OutcomeSuccess, "authenticator": "form"})
+	AddGauge(r, ActiveSessions, nil, 2)
+	AddGauge(r, ActiveSessions, nil, -1)
+	Observe(r, TokenVerification, nil, 0.05)
+	Observe(r, TokenVerification, nil, 0.5)
+	Count(r, AccessDenied, Labels{"rule": `say "hi"`})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+
+	expected := []string{
+		"# TYPE goauth_login_attempts_total counter",
+		`goauth_login_attempts_total{authenticator="form",outcome="success"} 2`,
+		"# TYPE goauth_active_sessions gauge",
+		"goauth_active_sessions 1",
+		`goauth_token_verification_seconds_bucket{le="0.1"} 1`,
+		`goauth_token_verification_seconds_bucket{le="1"} 2`,
+		`goauth_token_verification_seconds_bucket{le="+Inf"} 2`,
+		"goauth_token_verification_seconds_sum 0.55",
+		"goauth_token_verification_seconds_count 2",
+		`goauth_access_denied_total{rule="say \"hi\""} 1`,
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("expected line %q in\n%s", line, out)
+		}
+	}
+}
+
+func TestRegistryCopiesBuckets(t *testing.T) {
+	buckets := []float64{0.5, 1}
+	r := NewRegistry(buckets...)
+	Observe(r, LoginDuration, nil, 0.7)
+
+	buckets[0] = 10
+	buckets = append(buckets, 20)
+	Observe(r, LoginDuration, nil, 0.2)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+
+	for _, line := range []string{
+		`goauth_login_duration_seconds_bucket{le="0.5"} 1`,
+		`goauth_login_duration_seconds_bucket{le="1"} 2`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("expected line %q in\n%s", line, out)
+		}
+	}
+
+	if strings.Contains(out, `le="10"`) || strings.Contains(out, `le="20"`) {
+		t.Errorf("expected buckets to be fixed at construction, got\n%s", out)
+	}
+}
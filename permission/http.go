@@ -0,0 +1,79 @@
+package permission
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/iwyg/goauth/authorization"
+	"github.com/iwyg/goauth/token"
+)
+
+type contextKey int
+
+const registryKey contextKey = iota
+
+// NewRegistryMiddleware makes the registry available to security.Context
+func NewRegistryMiddleware(reg *Registry) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), registryKey, reg)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func RegistryFromRequest(r *http.Request) (*Registry, bool) {
+	reg, ok := r.Context().Value(registryKey).(*Registry)
+	return reg, ok
+}
+
+// Require denies access unless the token has all of the given permissions. If reg
+// is nil the registry of the request is used, see NewRegistryMiddleware, without
+// a registry access is denied.
+func Require(reg *Registry, perms ...Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reg := reg
+			if reg == nil {
+				reg, _ = RegistryFromRequest(r)
+			}
+
+			var tok token.Token
+			if store, err := token.TokenStoreFromRequest(r); err == nil {
+				tok, _ = store.Read()
+			}
+
+			if !authorization.IsFullyAuthenticated(tok) {
+				http.Error(w, "need authentication", http.StatusUnauthorized)
+				return
+			}
+
+			for _, p := range perms {
+				if !reg.HasPermission(tok, p) {
+					http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Voter votes on Permission attributes, without a Registry it denies them
+type Voter struct {
+	Registry *Registry
+}
+
+func (v *Voter) Vote(ctx context.Context, tok token.Token, attribute interface{}, subject interface{}) authorization.Vote {
+	p, ok := attribute.(Permission)
+	if !ok {
+		return authorization.AccessAbstain
+	}
+
+	if v.Registry.HasPermission(tok, p) {
+		return authorization.AccessGranted
+	}
+
+	return authorization.AccessDenied
+}
@@ -0,0 +1,193 @@
+package permission
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+	"gopkg.in/yaml.v2"
+)
+
+// Permission is a fine grained right like "invoice.approve". A permission ending
+// in ".*" grants all permissions below it, "*" grants everything.
+type Permission string
+
+// Grants reports whether p grants other
+func (p Permission) Grants(other Permission) bool {
+	if p == other || p == "*" {
+		return true
+	}
+
+	if strings.HasSuffix(string(p), ".*") {
+		return strings.HasPrefix(string(other), strings.TrimSuffix(string(p), "*"))
+	}
+
+	return false
+}
+
+// Config maps roles to permissions
+type Config struct {
+	Permissions map[role.Role][]Permission `json:"permissions" yaml:"permissions"`
+}
+
+type Registry struct {
+	mu          sync.RWMutex
+	hierarchy   role.Hierarchy
+	permissions map[role.Role][]Permission
+}
+
+// NewRegistry creates a registry that grants roles the permissions of all roles
+// they reach in h
+func NewRegistry(h role.Hierarchy, conf Config) (*Registry, error) {
+	r := &Registry{hierarchy: h}
+	if err := r.Load(conf); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Load replaces the role to permission mappings
+func (r *Registry) Load(conf Config) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.permissions = conf.Permissions
+
+	return nil
+}
+
+// Permissions returns the permissions granted to the given roles, a nil registry
+// grants none
+func (r *Registry) Permissions(roles ...role.Role) []Permission {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	roles = role.Reachable(r.hierarchy, roles)
+
+	seen := make(map[Permission]bool)
+	var out []Permission
+
+	for _, rl := range roles {
+		for _, p := range r.permissions[rl] {
+			if !seen[p] {
+				seen[p] = true
+				out = append(out, p)
+			}
+		}
+	}
+
+	return out
+}
+
+func (r *Registry) HasPermission(tok token.Token, p Permission) bool {
+	if tok == nil {
+		return false
+	}
+
+	for _, granted := range r.Permissions(tok.Roles()...) {
+		if granted.Grants(p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ParseJSON(data []byte) (Config, error) {
+	var conf Config
+	err := json.Unmarshal(data, &conf)
+	return conf, err
+}
+
+func ParseYAML(data []byte) (Config, error) {
+	var conf Config
+	err := yaml.Unmarshal(data, &conf)
+	return conf, err
+}
+
+// LoadFile reads a json or yaml config, depending on the file extension
+func LoadFile(path string) (Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		return ParseYAML(data)
+	default:
+		return ParseJSON(data)
+	}
+}
+
+func NewFileRegistry(h role.Hierarchy, path string) (*Registry, error) {
+	conf, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRegistry(h, conf)
+}
+
+// Watch reloads the registry from path whenever the file's modification time
+// changes. Invalid files are reported to onError and the previous mappings are
+// kept. Call the returned function to stop watching.
+func (r *Registry) Watch(path string, interval time.Duration, onError func(error)) func() {
+	done := make(chan struct{})
+	var once sync.Once
+
+	var modified time.Time
+	if fi, err := os.Stat(path); err == nil {
+		modified = fi.ModTime()
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			fi, err := os.Stat(path)
+			if err != nil {
+				if onError != nil {
+					onError(err)
+				}
+				continue
+			}
+
+			if !fi.ModTime().After(modified) {
+				continue
+			}
+			modified = fi.ModTime()
+
+			conf, err := LoadFile(path)
+			if err == nil {
+				err = r.Load(conf)
+			}
+
+			if err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
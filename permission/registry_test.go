@@ -0,0 +1,170 @@
+package permission
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iwyg/goauth/authorization"
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+)
+
+func newTestRegistry(t *testing.T) *Registry {
+	h, err := role.NewHierarchy(map[role.Role][]role.Role{role.RLAdmin: {role.RLUser}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg, err := NewRegistry(h, Config{
+		Permissions: map[role.Role][]Permission{
+			role.RLUser:  {"invoice.read"},
+			role.RLAdmin: {"invoice.*"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return reg
+}
+
+func newToken(roles ...role.Role) token.Token {
+	return token.NewAuthenticatedToken(&identity.InMemoryIdentity{UserRoles: roles})
+}
+
+func TestPermissions(t *testing.T) {
+	reg := newTestRegistry(t)
+
+	if perms := reg.Permissions(role.RLAdmin); len(perms) != 2 {
+		t.Errorf("expected admin to get its own and the user permissions, got %v", perms)
+	}
+
+	tests := []struct {
+		tok      token.Token
+		perm     Permission
+		expected bool
+	}{
+		{newToken(role.RLUser), "invoice.read", true},
+		{newToken(role.RLUser), "invoice.approve", false},
+		{newToken(role.RLAdmin), "invoice.approve", true},
+		{newToken(role.RLAdmin), "order.read", false},
+		{nil, "invoice.read", false},
+	}
+
+	for i, tt := range tests {
+		if got := reg.HasPermission(tt.tok, tt.perm); got != tt.expected {
+			t.Errorf("%d: expected %v for %s, got %v", i, tt.expected, tt.perm, got)
+		}
+	}
+
+	var nilReg *Registry
+	if nilReg.HasPermission(newToken(role.RLAdmin), "invoice.read") {
+		t.Error("expected nil registry to grant nothing")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "permissions.yml")
+	if err := os.WriteFile(path, []byte("permissions:\n  ROLE_USER: [invoice.read]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	reg, err := NewFileRegistry(nil, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 10)
+	stop := reg.Watch(path, 5*time.Millisecond, func(err error) { errs <- err })
+	defer stop()
+
+	write := func(data string, at time.Time) {
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("permissions:\n  ROLE_USER: [invoice.approve]\n", time.Now().Add(time.Minute))
+
+	tok := newToken(role.RLUser)
+	deadline := time.Now().Add(time.Second)
+	for !reg.HasPermission(tok, "invoice.approve") {
+		if time.Now().After(deadline) {
+			t.Fatal("expected registry to reload the changed file")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	write("permissions: [invoice.read\n", time.Now().Add(2*time.Minute))
+
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("expected invalid file to be reported")
+	}
+
+	if !reg.HasPermission(tok, "invoice.approve") {
+		t.Error("expected previous mappings to be kept after an invalid reload")
+	}
+}
+
+func TestRequire(t *testing.T) {
+	reg := newTestRegistry(t)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name     string
+		handler  http.Handler
+		tok      token.Token
+		expected int
+	}{
+		{"granted", Require(reg, "invoice.read")(ok), newToken(role.RLUser), http.StatusOK},
+		{"missing permission", Require(reg, "invoice.read", "invoice.approve")(ok), newToken(role.RLUser), http.StatusForbidden},
+		{"anonymous", Require(reg, "invoice.read")(ok), token.NewAnonymousToken(), http.StatusUnauthorized},
+		{"registry from request", NewRegistryMiddleware(reg)(Require(nil, "invoice.read")(ok)), newToken(role.RLUser), http.StatusOK},
+		{"no registry", Require(nil, "invoice.read")(ok), newToken(role.RLUser), http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		store, r := token.WithStore(httptest.NewRequest("GET", "/", nil))
+		store.Write(tt.tok)
+
+		w := httptest.NewRecorder()
+		tt.handler.ServeHTTP(w, r)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.expected, w.Code)
+		}
+	}
+}
+
+func TestVoter(t *testing.T) {
+	m := authorization.NewDefaultAccessDecisionManager(&Voter{Registry: newTestRegistry(t)})
+	ctx := context.Background()
+
+	if !m.IsGranted(ctx, newToken(role.RLAdmin), Permission("invoice.approve"), nil) {
+		t.Error("expected admin to be granted invoice.approve")
+	}
+
+	if m.IsGranted(ctx, newToken(role.RLUser), Permission("invoice.approve"), nil) {
+		t.Error("expected user to be denied invoice.approve")
+	}
+
+	v := &Voter{}
+	if v.Vote(ctx, newToken(role.RLAdmin), Permission("invoice.read"), nil) != authorization.AccessDenied {
+		t.Error("expected voter without registry to deny")
+	}
+
+	if v.Vote(ctx, newToken(role.RLAdmin), "ROLE_ADMIN", nil) != authorization.AccessAbstain {
+		t.Error("expected voter to abstain on other attributes")
+	}
+}
@@ -0,0 +1,271 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	httpUtil "github.com/iwyg/goauth/http"
+)
+
+// operator parses the values of a condition when the document is loaded, so
+// invalid values are rejected then, and matches actual values against them
+type operator struct {
+	parse func(v interface{}) (interface{}, error)
+	match func(actual interface{}, vals []interface{}) (bool, error)
+}
+
+var operators = map[string]operator{
+	"StringEquals":             stringOp(func(a, v string) bool { return a == v }),
+	"StringNotEquals":          negate(stringOp(func(a, v string) bool { return a == v })),
+	"StringEqualsIgnoreCase":   stringOp(strings.EqualFold),
+	"StringLike":               likeOp,
+	"StringNotLike":            negate(likeOp),
+	"NumericEquals":            numericOp(func(a, v float64) bool { return a == v }),
+	"NumericNotEquals":         negate(numericOp(func(a, v float64) bool { return a == v })),
+	"NumericLessThan":          numericOp(func(a, v float64) bool { return a < v }),
+	"NumericLessThanEquals":    numericOp(func(a, v float64) bool { return a <= v }),
+	"NumericGreaterThan":       numericOp(func(a, v float64) bool { return a > v }),
+	"NumericGreaterThanEquals": numericOp(func(a, v float64) bool { return a >= v }),
+	"Bool":                     boolOp,
+	"IpAddress":                ipOp,
+	"NotIpAddress":             negate(ipOp),
+	"TimeOfDayBetween":         timeOfDayOp,
+}
+
+// parseValues parses the values of a condition with the parser of op
+func parseValues(op operator, vals []interface{}) ([]interface{}, error) {
+	out := make([]interface{}, len(vals))
+	for i, v := range vals {
+		parsed, err := op.parse(v)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = parsed
+	}
+
+	return out, nil
+}
+
+// values returns the actual value as a list, so a list attribute like roles
+// matches if any of its items matches
+func values(actual interface{}) []interface{} {
+	rv := reflect.ValueOf(actual)
+	if actual == nil {
+		return nil
+	}
+
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []interface{}{actual}
+	}
+
+	out := make([]interface{}, rv.Len())
+	for i := range out {
+		out[i] = rv.Index(i).Interface()
+	}
+
+	return out
+}
+
+// errMissing is returned by negated operators for missing attributes, whether
+// they match depends on the effect of the statement, see Statement.matches
+var errMissing = errors.New("missing attribute")
+
+func negate(op operator) operator {
+	return operator{parse: op.parse, match: func(actual interface{}, vals []interface{}) (bool, error) {
+		if actual == nil {
+			return false, errMissing
+		}
+
+		ok, err := op.match(actual, vals)
+		return !ok && err == nil, err
+	}}
+}
+
+func parseString(v interface{}) (interface{}, error) {
+	return fmt.Sprintf("%v", v), nil
+}
+
+func stringOp(cmp func(actual, value string) bool) operator {
+	return operator{parse: parseString, match: func(actual interface{}, vals []interface{}) (bool, error) {
+		for _, a := range values(actual) {
+			for _, v := range vals {
+				if cmp(fmt.Sprintf("%v", a), v.(string)) {
+					return true, nil
+				}
+			}
+		}
+
+		return false, nil
+	}}
+}
+
+// likeOp matches glob patterns, they are compiled when the document is loaded
+var likeOp = operator{
+	parse: func(v interface{}) (interface{}, error) {
+		return compileGlob(fmt.Sprintf("%v", v))
+	},
+	match: func(actual interface{}, vals []interface{}) (bool, error) {
+		for _, a := range values(actual) {
+			for _, v := range vals {
+				if v.(*regexp.Regexp).MatchString(fmt.Sprintf("%v", a)) {
+					return true, nil
+				}
+			}
+		}
+
+		return false, nil
+	},
+}
+
+func number(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.String:
+		f, err := strconv.ParseFloat(rv.String(), 64)
+		return f, err == nil
+	}
+
+	return 0, false
+}
+
+func parseNumber(v interface{}) (interface{}, error) {
+	n, ok := number(v)
+	if !ok {
+		return nil, fmt.Errorf("%v is not a number", v)
+	}
+
+	return n, nil
+}
+
+func numericOp(cmp func(actual, value float64) bool) operator {
+	return operator{parse: parseNumber, match: func(actual interface{}, vals []interface{}) (bool, error) {
+		for _, a := range values(actual) {
+			na, ok := number(a)
+			if !ok {
+				continue
+			}
+			for _, v := range vals {
+				if cmp(na, v.(float64)) {
+					return true, nil
+				}
+			}
+		}
+
+		return false, nil
+	}}
+}
+
+var boolOp = operator{
+	parse: func(v interface{}) (interface{}, error) {
+		return strconv.ParseBool(fmt.Sprintf("%v", v))
+	},
+	match: func(actual interface{}, vals []interface{}) (bool, error) {
+		a, ok := actual.(bool)
+		if !ok {
+			return false, nil
+		}
+
+		for _, v := range vals {
+			if a == v.(bool) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	},
+}
+
+// ipOp matches addresses against single addresses and CIDR ranges
+var ipOp = operator{
+	parse: func(v interface{}) (interface{}, error) {
+		return httpUtil.ParseIPRanges(fmt.Sprintf("%v", v))
+	},
+	match: func(actual interface{}, vals []interface{}) (bool, error) {
+		ip := net.ParseIP(fmt.Sprintf("%v", actual))
+		if ip == nil {
+			return false, nil
+		}
+
+		for _, v := range vals {
+			if v.(httpUtil.IPRanges).Contains(ip) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	},
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// clockRange is a time of day range, from > to wraps around midnight
+type clockRange struct {
+	from, to time.Duration
+}
+
+func (c clockRange) contains(clock time.Duration) bool {
+	if c.from <= c.to {
+		return clock >= c.from && clock < c.to
+	}
+
+	return clock >= c.from || clock < c.to
+}
+
+func parseClockRange(v interface{}) (interface{}, error) {
+	parts := strings.Split(fmt.Sprintf("%v", v), "-")
+	if len(parts) != 2 {
+		return nil, errors.New("time of day range must be formatted as hh:mm-hh:mm")
+	}
+
+	from, err := parseClock(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := parseClock(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return clockRange{from: from, to: to}, nil
+}
+
+// timeOfDayOp matches a time.Time against ranges like "09:00-17:00".
+// Ranges that wrap around midnight, e.g. "22:00-06:00", are supported.
+var timeOfDayOp = operator{
+	parse: parseClockRange,
+	match: func(actual interface{}, vals []interface{}) (bool, error) {
+		t, ok := actual.(time.Time)
+		if !ok {
+			return false, nil
+		}
+
+		clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+		for _, v := range vals {
+			if v.(clockRange).contains(clock) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	},
+}
@@ -0,0 +1,193 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+type Effect string
+
+const (
+	EffectAllow Effect = "allow"
+	EffectDeny  Effect = "deny"
+)
+
+// Conditions maps an operator to context keys and the values they are tested
+// against, e.g. {"StringEquals": {"identity.department": ["finance"]}}.
+// All operators and keys must match, a key matches if any value matches.
+type Conditions map[string]map[string][]interface{}
+
+// Statement allows or denies actions on resources. Actions and resources are glob
+// patterns where * matches any sequence.
+type Statement struct {
+	Sid        string     `json:"sid"`
+	Effect     Effect     `json:"effect"`
+	Actions    []string   `json:"actions"`
+	Resources  []string   `json:"resources"`
+	Conditions Conditions `json:"conditions"`
+
+	actions    []*regexp.Regexp
+	resources  []*regexp.Regexp
+	conditions []condition
+}
+
+// condition is a key of Conditions with its values parsed by the operator
+type condition struct {
+	op       string
+	key      string
+	operator operator
+	values   []interface{}
+}
+
+type Document struct {
+	ID         string       `json:"id"`
+	Version    string       `json:"version"`
+	Statements []*Statement `json:"statements"`
+}
+
+type InvalidDocument struct {
+	Path string
+	Msg  string
+}
+
+func (e *InvalidDocument) Error() string {
+	return fmt.Sprintf("invalid policy at %s: %s", e.Path, e.Msg)
+}
+
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	exp := regexp.QuoteMeta(pattern)
+	exp = strings.Replace(exp, `\*`, ".*", -1)
+	exp = strings.Replace(exp, `\?`, ".", -1)
+
+	return regexp.Compile("^" + exp + "$")
+}
+
+func compileGlobs(patterns []string, path string) ([]*regexp.Regexp, error) {
+	out := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		exp, err := compileGlob(p)
+		if err != nil {
+			return nil, &InvalidDocument{Path: fmt.Sprintf("%s[%d]", path, i), Msg: err.Error()}
+		}
+		out[i] = exp
+	}
+
+	return out, nil
+}
+
+func (d *Document) compile() error {
+	for i, st := range d.Statements {
+		path := fmt.Sprintf("statements[%d]", i)
+
+		switch st.Effect {
+		case EffectAllow, EffectDeny:
+		default:
+			return &InvalidDocument{Path: path + ".effect", Msg: fmt.Sprintf("unknown effect %q", st.Effect)}
+		}
+
+		if len(st.Actions) == 0 {
+			return &InvalidDocument{Path: path + ".actions", Msg: "at least one action is required"}
+		}
+
+		var err error
+		if st.conditions, err = compileConditions(st.Conditions, path+".conditions"); err != nil {
+			return err
+		}
+
+		if st.actions, err = compileGlobs(st.Actions, path+".actions"); err != nil {
+			return err
+		}
+
+		resources := st.Resources
+		if len(resources) == 0 {
+			resources = []string{"*"}
+		}
+
+		if st.resources, err = compileGlobs(resources, path+".resources"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compileConditions parses the condition values, e.g. ip ranges and time of day
+// ranges, so invalid values fail when the document is loaded
+func compileConditions(conds Conditions, path string) ([]condition, error) {
+	var out []condition
+	for op, keys := range conds {
+		operator, ok := operators[op]
+		if !ok {
+			return nil, &InvalidDocument{Path: path, Msg: fmt.Sprintf("unknown operator %q", op)}
+		}
+
+		for key, vals := range keys {
+			parsed, err := parseValues(operator, vals)
+			if err != nil {
+				return nil, &InvalidDocument{Path: fmt.Sprintf("%s.%s.%s", path, op, key), Msg: err.Error()}
+			}
+			out = append(out, condition{op: op, key: key, operator: operator, values: parsed})
+		}
+	}
+
+	return out, nil
+}
+
+func matchesAny(exps []*regexp.Regexp, s string) bool {
+	for _, e := range exps {
+		if e.MatchString(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (st *Statement) matches(req *Request) (bool, error) {
+	if !matchesAny(st.actions, req.Action) || !matchesAny(st.resources, req.Resource) {
+		return false, nil
+	}
+
+	for _, c := range st.conditions {
+		ok, err := c.operator.match(req.Context[c.key], c.values)
+		if err == errMissing {
+			// a negated condition on a missing attribute applies deny statements
+			// but never allows, so requests cannot skip a deny by omitting it
+			ok, err = st.Effect == EffectDeny, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("statement %q, %s on %s: %s", st.Sid, c.op, c.key, err)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// ParseDocument reads and validates a json policy document
+func ParseDocument(data []byte) (*Document, error) {
+	doc := &Document{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, err
+	}
+
+	if err := doc.compile(); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+func LoadFile(path string) (*Document, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseDocument(data)
+}
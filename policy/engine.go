@@ -0,0 +1,160 @@
+package policy
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	httpUtil "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+)
+
+// Context holds the attributes conditions are evaluated against, keyed by
+// dotted names like "identity.department" or "request.ip"
+type Context map[string]interface{}
+
+func (c Context) flatten(prefix string, attrs map[string]interface{}) {
+	for k, v := range attrs {
+		if nested, ok := v.(map[string]interface{}); ok {
+			c.flatten(prefix+k+".", nested)
+			continue
+		}
+		c[prefix+k] = v
+	}
+}
+
+// NewContext builds a context from the token's identity and its attributes, the
+// request and the resource attributes, e.g. {"tags": {"env": "prod"}} becomes
+// "resource.tags.env". identity.roles holds the roles the token reaches in h.
+func NewContext(h role.Hierarchy, tok token.Token, r *http.Request, resource map[string]interface{}) Context {
+	c := Context{}
+	now := time.Now()
+
+	c["request.time"] = now
+	c["request.hour"] = now.Hour()
+	c["request.weekday"] = now.Weekday().String()
+
+	if tok != nil {
+		roles := make([]string, 0)
+		for _, r := range role.Reachable(h, tok.Roles()) {
+			roles = append(roles, string(r))
+		}
+		c["identity.roles"] = roles
+		c["identity.authenticated"] = tok.IsFullyAuthenticated()
+	}
+
+	if it, ok := tok.(token.IdentityToken); ok && it.Identity() != nil {
+		c["identity.id"] = it.Identity().ID()
+		if ai, ok := it.Identity().(identity.AttributeIdentity); ok {
+			c.flatten("identity.", ai.Attributes())
+		}
+	}
+
+	if r != nil {
+		c["request.ip"] = httpUtil.ClientIPString(r)
+		c["request.method"] = r.Method
+		c["request.path"] = r.URL.Path
+		c["request.host"] = r.Host
+	}
+
+	c.flatten("resource.", resource)
+
+	return c
+}
+
+type Request struct {
+	Action   string
+	Resource string
+	Context  Context
+}
+
+// Decision explains the outcome of an evaluation. Statement is nil if no statement
+// matched and access was denied implicitly.
+type Decision struct {
+	Allowed   bool
+	Effect    Effect
+	Document  *Document
+	Statement *Statement
+	Reason    string
+}
+
+// Engine evaluates requests against policy documents. An explicit deny wins over
+// any allow, requests no statement matches are denied.
+type Engine struct {
+	mu        sync.RWMutex
+	documents []*Document
+}
+
+// NewEngine validates docs, so documents built in code are checked like parsed ones
+func NewEngine(docs ...*Document) (*Engine, error) {
+	e := &Engine{}
+	for _, doc := range docs {
+		if err := e.Add(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// Add validates and adds a document
+func (e *Engine) Add(doc *Document) error {
+	if err := doc.compile(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.documents = append(e.documents, doc)
+
+	return nil
+}
+
+func (e *Engine) Evaluate(req Request) (*Decision, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var allow *Decision
+
+	for _, doc := range e.documents {
+		for _, st := range doc.Statements {
+			ok, err := st.matches(&req)
+			if err != nil {
+				return nil, err
+			}
+
+			if !ok {
+				continue
+			}
+
+			if st.Effect == EffectDeny {
+				return &Decision{
+					Effect:    EffectDeny,
+					Document:  doc,
+					Statement: st,
+					Reason:    fmt.Sprintf("denied by statement %q of policy %q", st.Sid, doc.ID),
+				}, nil
+			}
+
+			if allow == nil {
+				allow = &Decision{
+					Allowed:   true,
+					Effect:    EffectAllow,
+					Document:  doc,
+					Statement: st,
+					Reason:    fmt.Sprintf("allowed by statement %q of policy %q", st.Sid, doc.ID),
+				}
+			}
+		}
+	}
+
+	if allow != nil {
+		return allow, nil
+	}
+
+	return &Decision{Effect: EffectDeny, Reason: "no statement matched"}, nil
+}
@@ -0,0 +1,187 @@
+package policy
+
+import (
+	"testing"
+	"time"
+)
+
+const doc = `{
+	"id": "invoices",
+	"statements": [
+		{
+			"sid": "finance",
+			"effect": "allow",
+			"actions": ["invoice:*"],
+			"resources": ["invoice/*"],
+			"conditions": {
+				"StringEquals": {"identity.department": ["finance"]},
+				"TimeOfDayBetween": {"request.time": ["08:00-18:00"]}
+			}
+		},
+		{
+			"sid": "prod-outside",
+			"effect": "deny",
+			"actions": ["invoice:delete"],
+			"conditions": {
+				"StringEquals": {"resource.tags.env": ["prod"]},
+				"NotIpAddress": {"request.ip": ["10.0.0.0/8"]}
+			}
+		}
+	]
+}`
+
+func TestEvaluate(t *testing.T) {
+	d, err := ParseDocument([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := NewEngine(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noon := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		action   string
+		ctx      Context
+		allowed  bool
+		matchSid string
+	}{
+		{"invoice:read", Context{"identity.department": "finance", "request.time": noon}, true, "finance"},
+		{"invoice:read", Context{"identity.department": "sales", "request.time": noon}, false, ""},
+		{"invoice:read", Context{"identity.department": "finance", "request.time": noon.Add(8 * time.Hour)}, false, ""},
+		{"invoice:delete", Context{"identity.department": "finance", "request.time": noon, "resource.tags.env": "prod", "request.ip": "192.168.1.1"}, false, "prod-outside"},
+		{"invoice:delete", Context{"identity.department": "finance", "request.time": noon, "resource.tags.env": "prod", "request.ip": "10.1.1.1"}, true, "finance"},
+		{"invoice:delete", Context{"identity.department": "finance", "request.time": noon, "resource.tags.env": "prod"}, false, "prod-outside"},
+	}
+
+	for i, tt := range tests {
+		dec, err := e.Evaluate(Request{Action: tt.action, Resource: "invoice/1", Context: tt.ctx})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if dec.Allowed != tt.allowed {
+			t.Errorf("%d: expected %v, got %v (%s)", i, tt.allowed, dec.Allowed, dec.Reason)
+		}
+
+		if tt.matchSid != "" && (dec.Statement == nil || dec.Statement.Sid != tt.matchSid) {
+			t.Errorf("%d: expected statement %q to match, got %s", i, tt.matchSid, dec.Reason)
+		}
+	}
+}
+
+func TestInvalidDocument(t *testing.T) {
+	_, err := ParseDocument([]byte(`{"statements": [{"effect": "allow", "actions": ["a"], "conditions": {"Foo": {}}}]}`))
+	if _, ok := err.(*InvalidDocument); !ok {
+		t.Fatalf("expected invalid document error, got %v", err)
+	}
+}
+
+func TestInvalidConditionValues(t *testing.T) {
+	for _, conds := range []string{
+		`{"TimeOfDayBetween": {"request.time": ["9-17"]}}`,
+		`{"TimeOfDayBetween": {"request.time": ["09:00"]}}`,
+		`{"NumericLessThan": {"identity.level": ["high"]}}`,
+		`{"IpAddress": {"request.ip": ["10.0.0.0/33"]}}`,
+		`{"NotIpAddress": {"request.ip": ["intranet"]}}`,
+		`{"Bool": {"identity.authenticated": ["maybe"]}}`,
+	} {
+		_, err := ParseDocument([]byte(`{"statements": [{"effect": "allow", "actions": ["a"], "conditions": ` + conds + `}]}`))
+		if _, ok := err.(*InvalidDocument); !ok {
+			t.Errorf("%s: expected invalid document error, got %v", conds, err)
+		}
+	}
+}
+
+func TestConditionOperators(t *testing.T) {
+	d, err := ParseDocument([]byte(`{"statements": [{"effect": "allow", "actions": ["a"], "conditions": {
+		"StringLike": {"request.path": ["/reports/*.pdf"]},
+		"NumericGreaterThanEquals": {"identity.level": [3]},
+		"IpAddress": {"request.ip": ["10.0.0.0/8", "192.0.2.1"]},
+		"Bool": {"identity.authenticated": [true]}
+	}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := NewEngine(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allowed := Context{"request.path": "/reports/q1.pdf", "identity.level": 3, "request.ip": "192.0.2.1", "identity.authenticated": true}
+	tests := []struct {
+		key      string
+		value    interface{}
+		expected bool
+	}{
+		{"", nil, true},
+		{"request.path", "/reports/q1.csv", false},
+		{"identity.level", "2", false},
+		{"request.ip", "10.2.3.4", true},
+		{"request.ip", "192.0.2.2", false},
+		{"identity.authenticated", false, false},
+	}
+
+	for _, tt := range tests {
+		ctx := Context{}
+		for k, v := range allowed {
+			ctx[k] = v
+		}
+		if tt.key != "" {
+			ctx[tt.key] = tt.value
+		}
+
+		dec, err := e.Evaluate(Request{Action: "a", Resource: "r", Context: ctx})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if dec.Allowed != tt.expected {
+			t.Errorf("%s=%v: expected %v, got %v (%s)", tt.key, tt.value, tt.expected, dec.Allowed, dec.Reason)
+		}
+	}
+}
+
+func TestNegatedConditionNeverAllowsMissingAttribute(t *testing.T) {
+	e, err := NewEngine(&Document{ID: "external", Statements: []*Statement{{
+		Sid:        "not-internal",
+		Effect:     EffectAllow,
+		Actions:    []string{"report:read"},
+		Conditions: Conditions{"NotIpAddress": {"request.ip": {"10.0.0.0/8"}}},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := e.Evaluate(Request{Action: "report:read", Resource: "report/1", Context: Context{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dec.Allowed {
+		t.Error("expected missing attribute not to allow")
+	}
+
+	dec, err = e.Evaluate(Request{Action: "report:read", Resource: "report/1", Context: Context{"request.ip": "192.168.1.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !dec.Allowed {
+		t.Errorf("expected statement built in code to be compiled, got %s", dec.Reason)
+	}
+}
+
+func TestEngineValidatesDocuments(t *testing.T) {
+	if _, err := NewEngine(&Document{Statements: []*Statement{{Effect: "maybe", Actions: []string{"a"}}}}); err == nil {
+		t.Error("expected invalid document to be rejected")
+	}
+
+	e, _ := NewEngine()
+	if err := e.Add(&Document{Statements: []*Statement{{Effect: EffectAllow}}}); err == nil {
+		t.Error("expected statement without actions to be rejected")
+	}
+}
@@ -0,0 +1,53 @@
+package policy
+
+import (
+	"context"
+
+	"github.com/iwyg/goauth/authorization"
+	"github.com/iwyg/goauth/role"
+	"github.com/iwyg/goauth/token"
+)
+
+// Action is an attribute that is decided by the policy engine
+type Action string
+
+// Resource is implemented by subjects that are protected by policies
+type Resource interface {
+	PolicyResource() (name string, attributes map[string]interface{})
+}
+
+type Voter struct {
+	Engine    *Engine
+	Hierarchy role.Hierarchy
+}
+
+func (v *Voter) Vote(ctx context.Context, tok token.Token, attribute interface{}, subject interface{}) authorization.Vote {
+	action, ok := attribute.(Action)
+	if !ok {
+		return authorization.AccessAbstain
+	}
+
+	var name string
+	var attrs map[string]interface{}
+
+	switch s := subject.(type) {
+	case Resource:
+		name, attrs = s.PolicyResource()
+	case string:
+		name = s
+	}
+
+	r, _ := authorization.RequestFromContext(ctx)
+
+	d, err := v.Engine.Evaluate(Request{
+		Action:   string(action),
+		Resource: name,
+		Context:  NewContext(v.Hierarchy, tok, r, attrs),
+	})
+
+	if err != nil || !d.Allowed {
+		return authorization.AccessDenied
+	}
+
+	return authorization.AccessGranted
+}
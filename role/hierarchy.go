@@ -0,0 +1,146 @@
+package role
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Hierarchy resolves the roles that are reachable from a set of roles,
+// e.g. ROLE_ADMIN includes ROLE_USER
+type Hierarchy interface {
+	ReachableRoles(roles []Role) []Role
+}
+
+// Reachable resolves roles against h, without a hierarchy only the given roles
+// are reachable. The returned slice is never the given one. Tokens expose the
+// roles they were granted, every check of token roles resolves them with the
+// hierarchy it was configured with.
+func Reachable(h Hierarchy, roles []Role) []Role {
+	if h == nil {
+		return append([]Role(nil), roles...)
+	}
+
+	return h.ReachableRoles(roles)
+}
+
+type CycleError struct {
+	Path []Role
+}
+
+func (e *CycleError) Error() string {
+	path := make([]string, len(e.Path))
+	for i, r := range e.Path {
+		path[i] = string(r)
+	}
+
+	return fmt.Sprintf("role hierarchy contains a cycle: %s", strings.Join(path, " -> "))
+}
+
+type DefaultHierarchy struct {
+	reachable map[Role][]Role
+}
+
+// NewHierarchy builds a hierarchy from a map of roles to the roles they include.
+// It returns a *CycleError if a role includes itself.
+func NewHierarchy(includes map[Role][]Role) (*DefaultHierarchy, error) {
+	h := &DefaultHierarchy{reachable: make(map[Role][]Role, len(includes))}
+
+	for r := range includes {
+		reachable, err := resolve(includes, r, []Role{r})
+		if err != nil {
+			return nil, err
+		}
+		h.reachable[r] = reachable
+	}
+
+	return h, nil
+}
+
+func resolve(includes map[Role][]Role, r Role, path []Role) ([]Role, error) {
+	var out []Role
+	for _, child := range includes[r] {
+		for _, p := range path {
+			if p == child {
+				return nil, &CycleError{Path: append(path, child)}
+			}
+		}
+
+		below, err := resolve(includes, child, append(path[:len(path):len(path)], child))
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, child)
+		out = append(out, below...)
+	}
+
+	return out, nil
+}
+
+// ReachableRoles returns the given roles and all roles they include, without
+// duplicates. A nil hierarchy includes no roles.
+func (h *DefaultHierarchy) ReachableRoles(roles []Role) []Role {
+	if h == nil {
+		return append([]Role(nil), roles...)
+	}
+
+	seen := make(map[Role]bool)
+	out := make([]Role, 0, len(roles))
+
+	add := func(r Role) {
+		if !seen[r] {
+			seen[r] = true
+			out = append(out, r)
+		}
+	}
+
+	for _, r := range roles {
+		add(r)
+		for _, reachable := range h.reachable[r] {
+			add(reachable)
+		}
+	}
+
+	return out
+}
+
+// LoadHierarchyJSON reads a hierarchy from a json object, e.g.
+// {"ROLE_ADMIN": ["ROLE_USER"], "ROLE_USER": ["ROLE_ANON"]}
+func LoadHierarchyJSON(data []byte) (*DefaultHierarchy, error) {
+	includes := make(map[Role][]Role)
+	if err := json.Unmarshal(data, &includes); err != nil {
+		return nil, err
+	}
+
+	return NewHierarchy(includes)
+}
+
+// LoadHierarchyYAML reads a hierarchy from a yaml mapping
+func LoadHierarchyYAML(data []byte) (*DefaultHierarchy, error) {
+	includes := make(map[Role][]Role)
+	if err := yaml.Unmarshal(data, &includes); err != nil {
+		return nil, err
+	}
+
+	return NewHierarchy(includes)
+}
+
+// LoadHierarchyFile reads a json or yaml file, depending on its extension
+func LoadHierarchyFile(path string) (*DefaultHierarchy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		return LoadHierarchyYAML(data)
+	default:
+		return LoadHierarchyJSON(data)
+	}
+}
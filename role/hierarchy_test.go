@@ -0,0 +1,53 @@
+package role
+
+import "testing"
+
+func TestReachableRoles(t *testing.T) {
+	h, err := LoadHierarchyJSON([]byte(`{"ROLE_ADMIN": ["ROLE_USER"], "ROLE_USER": ["ROLE_ANON"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roles := h.ReachableRoles([]Role{RLAdmin})
+	expected := []Role{RLAdmin, RLUser, RLAnon}
+
+	if len(roles) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, roles)
+	}
+
+	for i, r := range expected {
+		if roles[i] != r {
+			t.Errorf("expected %v, got %v", expected, roles)
+		}
+	}
+}
+
+func TestHierarchyCycle(t *testing.T) {
+	_, err := LoadHierarchyYAML([]byte("ROLE_ADMIN: [ROLE_USER]\nROLE_USER: [ROLE_EDITOR]\nROLE_EDITOR: [ROLE_ADMIN]\n"))
+
+	if _, ok := err.(*CycleError); !ok {
+		t.Fatalf("expected cycle error, got %v", err)
+	}
+}
+
+func TestReachableReturnsCopy(t *testing.T) {
+	h, err := NewHierarchy(map[Role][]Role{RLAdmin: {RLUser}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var none *DefaultHierarchy
+	for _, h := range []Hierarchy{nil, h, none} {
+		roles := []Role{RLUser}
+		reachable := Reachable(h, roles)
+		reachable[0] = RLAdmin
+
+		if roles[0] != RLUser {
+			t.Errorf("%T: expected Reachable not to return the given slice", h)
+		}
+	}
+
+	if roles := Reachable(h, []Role{RLAdmin}); len(roles) != 2 {
+		t.Errorf("expected admin to reach the user role, got %v", roles)
+	}
+}
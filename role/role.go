@@ -11,4 +11,9 @@ const (
 	RLAdmin   Role = "ROLE_ADMIN"
 	RLUser    Role = "ROLE_USER"
 	RLDefault      = RLAnon
+
+	// RLAllowedToSwitch allows an identity to impersonate other identities
+	RLAllowedToSwitch Role = "ROLE_ALLOWED_TO_SWITCH"
+	// RLPreviousAdmin is added to impersonation tokens
+	RLPreviousAdmin Role = "ROLE_PREVIOUS_ADMIN"
 )
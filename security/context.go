@@ -1,15 +1,15 @@
 package security
 
 import (
+	"github.com/iwyg/goauth/permission"
 	"github.com/iwyg/goauth/token"
 	"net/http"
 	"sync"
 )
 
-var ctxMap map[*http.Request]Context
-
 type Context interface {
 	Token() token.Token
+	HasPermission(permission.Permission) bool
 }
 
 type contextImpl struct {
@@ -30,22 +30,25 @@ func (ctx *contextImpl) Token() token.Token {
 	return tok
 }
 
+// HasPermission checks the current token against the registry provided by
+// permission.NewRegistryMiddleware
+func (ctx *contextImpl) HasPermission(p permission.Permission) bool {
+	reg, ok := permission.RegistryFromRequest(ctx.Request)
+	if !ok {
+		return false
+	}
+
+	return reg.HasPermission(ctx.Token(), p)
+}
+
 func GetContext(r *http.Request) Context {
-	ctx, ok := ctxMap[r]
 	store, err := token.TokenStoreFromRequest(r)
 	if err != nil {
 		panic(err)
 	}
 
-	if !ok {
-		ctx = &contextImpl{
-			Store:   store,
-			Request: r,
-		}
-
-		ctxMap[r] = ctx
-		return ctx
+	return &contextImpl{
+		Store:   store,
+		Request: r,
 	}
-
-	return ctx
 }
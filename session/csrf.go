@@ -0,0 +1,44 @@
+package session
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+func csrfKey(id string) string {
+	return "_csrf." + id
+}
+
+// CSRFToken returns the csrf token with the given id, a token is generated if the
+// session has none. The session must be saved for a new token to persist.
+func CSRFToken(s Session, id string) (string, error) {
+	if tok, ok := s.GetValue(csrfKey(id)).(string); ok && tok != "" {
+		return tok, nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	tok := base64.RawURLEncoding.EncodeToString(b)
+	s.SetValue(csrfKey(id), tok)
+
+	return tok, nil
+}
+
+// IsCSRFTokenValid compares value with the csrf token stored in the session
+func IsCSRFTokenValid(s Session, id string, value string) bool {
+	tok, ok := s.GetValue(csrfKey(id)).(string)
+	if !ok || tok == "" || value == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(tok), []byte(value)) == 1
+}
+
+// RemoveCSRFToken invalidates the csrf token with the given id
+func RemoveCSRFToken(s Session, id string) {
+	s.RemoveValue(csrfKey(id))
+}
@@ -0,0 +1,16 @@
+package session
+
+const flashPrefix = "_flash."
+
+// SetFlash stores a value that is removed once it is read with Flash
+func SetFlash(s Session, key string, value interface{}) {
+	s.SetValue(flashPrefix+key, value)
+}
+
+// Flash returns and removes a flash value
+func Flash(s Session, key string) interface{} {
+	val := s.GetValue(flashPrefix + key)
+	s.RemoveValue(flashPrefix + key)
+
+	return val
+}
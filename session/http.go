@@ -1,38 +1,46 @@
 package session
 
 import (
-	"github.com/pkg/errors"
+	"fmt"
+	"net/http"
+
+	"github.com/iwyg/goauth/event"
 	httpUtil "github.com/iwyg/goauth/http"
+	"github.com/iwyg/goauth/logging"
 	"github.com/iwyg/goauth/token"
-	"log"
-	"net/http"
+	"github.com/pkg/errors"
 )
 
+// Config names the session and the key the token is stored at. A SessionMigrated
+// event is dispatched to Events when the session is migrated on login.
 type Config struct {
 	Name     string
 	TokenKey string
+	Events   event.Dispatcher
 }
 
-func NewSessionReaderHandler(conf Config, sp Provider) func(http.Handler) http.Handler {
+func sessionError(err error) error {
+	return &httpUtil.StatusError{Code: http.StatusInternalServerError, Err: err}
+}
+
+// NewSessionReaderHandler restores the token from the session. Session errors are
+// reported with httpUtil.Fail.
+func NewSessionReaderHandler(conf Config, sp Provider, opts ...logging.Option) func(http.Handler) http.Handler {
+	l := logging.New(opts...)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			var exitErr httpUtil.Error
-			defer httpUtil.ExitError(w, func() httpUtil.Error { return exitErr }, func() {
-				next.ServeHTTP(w, r)
-			})()
-
 			session, err := sp.Provide(r, conf.Name)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				l.Error("could not load session", "name", conf.Name, "error", err)
+				httpUtil.Fail(w, r, sessionError(err))
 				return
 			}
 
-			log.Printf("%#v\n", session)
-
-			tokens, storeErr := token.TokenStoreFromRequest(r)
-
-			if storeErr != nil {
-				log.Printf("could not read store from context %s\n", storeErr.Error())
+			tokens, err := token.TokenStoreFromRequest(r)
+			if err != nil {
+				l.Warn("could not read token store from request", "error", err)
+				next.ServeHTTP(w, r)
 				return
 			}
 
@@ -40,17 +48,20 @@ func NewSessionReaderHandler(conf Config, sp Provider) func(http.Handler) http.H
 			session.RemoveValue(conf.TokenKey)
 
 			if tok == nil {
+				next.ServeHTTP(w, r)
 				return
 			}
 
-			token, ok := tok.(token.Token)
+			stored, ok := tok.(token.Token)
 			if !ok {
-				log.Fatal("could not convert token from previous session\n")
+				l.Error("could not convert token from previous session", "name", conf.Name, "type", fmt.Sprintf("%T", tok))
+				httpUtil.Fail(w, r, sessionError(errors.New("invalid token in session")))
+				return
 			}
 
-			log.Printf("successfully read token from session %#v\n", tok)
-
-			tokens.Write(token)
+			l.Debug("read token from session", "name", conf.Name, "token", stored)
+			tokens.Write(stored)
+			next.ServeHTTP(w, withReadToken(r, stored))
 		})
 
 	}
@@ -65,61 +76,89 @@ func GetAuthenticatedToken(tok interface{}) (*token.AuthenticatedToken, error) {
 	return t, nil
 }
 
-//NewSessionWriterHandler initialize the token storage
-func NewSessionWriterHandler(conf Config, sp Provider) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			var exitErr httpUtil.Error
-			defer httpUtil.ExitError(w, func() httpUtil.Error { return exitErr }, func() {
-				next.ServeHTTP(w, r)
-			})()
-
-			session, err := sp.Provide(r, conf.Name)
-			session.RemoveValue(conf.TokenKey)
-			tokens, storeErr := token.TokenStoreFromRequest(r)
+// GetSessionToken returns tokens that may be stored in a session. Scoped tokens
+// are issued per request and are never persisted.
+func GetSessionToken(tok interface{}) (token.IdentityToken, error) {
+	switch t := tok.(type) {
+	case *token.SwitchUserToken:
+		return t, nil
+	case *token.AuthenticatedToken:
+		return t, nil
+	}
 
-			if storeErr != nil {
-				log.Printf("could not read store from context %s\n", storeErr.Error())
-				return
-			}
+	return nil, errors.New("cannot convert to token")
+}
 
-			tok, err := tokens.Read()
-			if err != nil {
-				log.Printf("could not read from sp %s\n", err.Error())
-				return
+//NewSessionWriterHandler initialize the token storage
+func NewSessionWriterHandler(conf Config, sp Provider, opts ...logging.Option) func(http.Handler) http.Handler {
+	l := logging.New(opts...)
+
+	write := func(w http.ResponseWriter, r *http.Request) error {
+		session, err := sp.Provide(r, conf.Name)
+		if err != nil {
+			return sessionError(err)
+		}
+
+		session.RemoveValue(conf.TokenKey)
+
+		tokens, err := token.TokenStoreFromRequest(r)
+		if err != nil {
+			l.Warn("could not read token store from request", "error", err)
+			return nil
+		}
+
+		tok, err := tokens.Read()
+		if err != nil {
+			l.Debug("no token to write to session", "name", conf.Name)
+			return nil
+		}
+
+		// won't write the token to the session if not authenticated
+		if !tok.IsFullyAuthenticated() {
+			session, _ = sp.New(r, conf.Name)
+			return sp.Save(w, r, session)
+		}
+
+		saveToken, err := GetSessionToken(tok)
+		if err != nil {
+			return nil
+		}
+
+		l.Debug("write token to session", "name", conf.Name, "token", tok)
+		session.SetValue(conf.TokenKey, saveToken)
+
+		if !wasAuthenticated(r) {
+			if err := Migrate(sp, w, r, session, conf.Events); err != nil {
+				l.Warn("could not migrate session", "name", conf.Name, "error", err)
 			}
+		}
 
-			// won't write the token to the session if not authenticated
-			if !tok.IsFullyAuthenticated() {
-				session, _ = sp.New(r, conf.Name)
-				sp.Save(w, r, session)
-				log.Printf("found unauthenticated token %#v\n", tok)
-				return
-			}
+		return nil
+	}
 
-			saveToken, err := GetAuthenticatedToken(tok)
-			if err != nil {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := write(w, r); err != nil {
+				l.Error("could not write token to session", "name", conf.Name, "error", err)
+				httpUtil.Fail(w, r, err)
 				return
 			}
 
-			log.Printf("write token to session %#v\n", tok)
-			session.SetValue(conf.TokenKey, saveToken)
-
-			return
+			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-func NewSessionStartHandler(conf Config, sp Provider) func(http.Handler) http.Handler {
+func NewSessionStartHandler(conf Config, sp Provider, opts ...logging.Option) func(http.Handler) http.Handler {
+	l := logging.New(opts...)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			session, err := sp.Provide(r, conf.Name)
 			if err != nil || session.IsNew() {
-				var err2 error
-				session, err2 = sp.New(r, conf.Name)
-				log.Println("start new session")
-				if err2 != nil {
-					log.Print(err2)
+				l.Debug("start new session", "name", conf.Name)
+				if _, err := sp.New(r, conf.Name); err != nil {
+					l.Warn("could not start session", "name", conf.Name, "error", err)
 				}
 			}
 
@@ -128,31 +167,41 @@ func NewSessionStartHandler(conf Config, sp Provider) func(http.Handler) http.Ha
 	}
 }
 
-func NewSessionSaveHandler(conf Config, sp Provider) func(http.Handler) http.Handler {
+// NewSessionSaveHandler saves the session. Errors are reported with httpUtil.Fail.
+func NewSessionSaveHandler(conf Config, sp Provider, opts ...logging.Option) func(http.Handler) http.Handler {
+	l := logging.New(opts...)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(
 			func(w http.ResponseWriter, r *http.Request) {
-				session, _ := sp.Provide(r, conf.Name)
-				if err := sp.Save(w, r, session); err != nil {
-					log.Fatal(err)
+				session, err := sp.Provide(r, conf.Name)
+				if err == nil {
+					err = sp.Save(w, r, session)
 				}
+
+				if err != nil {
+					l.Error("could not save session", "name", conf.Name, "error", err)
+					httpUtil.Fail(w, r, sessionError(err))
+					return
+				}
+
 				next.ServeHTTP(w, r)
 			})
 	}
 }
 
-func NewSessionReaderMiddleWare(conf Config, store Provider) func(http.Handler) http.Handler {
-	return NewSessionReaderHandler(conf, store)
+func NewSessionReaderMiddleWare(conf Config, store Provider, opts ...logging.Option) func(http.Handler) http.Handler {
+	return NewSessionReaderHandler(conf, store, opts...)
 }
 
-func NewSessionWriterMiddleWare(conf Config, store Provider) func(http.Handler) http.Handler {
-	return NewSessionWriterHandler(conf, store)
+func NewSessionWriterMiddleWare(conf Config, store Provider, opts ...logging.Option) func(http.Handler) http.Handler {
+	return NewSessionWriterHandler(conf, store, opts...)
 }
 
-func NewSessionSaveHandlerMiddleware(conf Config, store Provider) func(http.Handler) http.Handler {
-	return NewSessionSaveHandler(conf, store)
+func NewSessionSaveHandlerMiddleware(conf Config, store Provider, opts ...logging.Option) func(http.Handler) http.Handler {
+	return NewSessionSaveHandler(conf, store, opts...)
 }
 
-func NewSessionStartHandlerMiddleware(conf Config, store Provider) func(http.Handler) http.Handler {
-	return NewSessionStartHandler(conf, store)
+func NewSessionStartHandlerMiddleware(conf Config, store Provider, opts ...logging.Option) func(http.Handler) http.Handler {
+	return NewSessionStartHandler(conf, store, opts...)
 }
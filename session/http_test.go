@@ -0,0 +1,53 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iwyg/goauth/token"
+)
+
+type memorySession struct {
+	values map[interface{}]interface{}
+}
+
+func (s *memorySession) SetValue(k interface{}, v interface{}) { s.values[k] = v }
+func (s *memorySession) GetValue(k interface{}) interface{}    { return s.values[k] }
+func (s *memorySession) RemoveValue(k interface{})             { delete(s.values, k) }
+func (s *memorySession) IsNew() bool                           { return false }
+func (s *memorySession) Expire()                               {}
+func (s *memorySession) ID() string                            { return "" }
+
+type memoryProvider struct {
+	session *memorySession
+}
+
+func (p *memoryProvider) Provide(r *http.Request, name string) (Session, error) {
+	return p.session, nil
+}
+func (p *memoryProvider) New(r *http.Request, name string) (Session, error) { return p.session, nil }
+func (p *memoryProvider) Save(w http.ResponseWriter, r *http.Request, s Session) error {
+	return nil
+}
+
+func TestReaderReportsInvalidToken(t *testing.T) {
+	conf := Config{Name: "app", TokenKey: "token"}
+	sp := &memoryProvider{session: &memorySession{values: map[interface{}]interface{}{"token": "not a token"}}}
+
+	var called bool
+	h := token.NewTokenStoreProviderMiddleware()(NewSessionReaderHandler(conf, sp)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if called {
+		t.Error("expected the request to stop")
+	}
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,45 @@
+package session
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/iwyg/goauth/event"
+	"github.com/iwyg/goauth/token"
+)
+
+// Migrator is implemented by providers that can give a session a new id keeping
+// its values, which prevents session fixation on login
+type Migrator interface {
+	Migrate(w http.ResponseWriter, r *http.Request, s Session) error
+}
+
+// Migrate saves the session under a new id and dispatches a SessionMigrated event
+// to d. The session is saved unchanged if the provider is no Migrator.
+func Migrate(sp Provider, w http.ResponseWriter, r *http.Request, s Session, d event.Dispatcher) error {
+	m, ok := sp.(Migrator)
+	if !ok {
+		return sp.Save(w, r, s)
+	}
+
+	previous := s.ID()
+	if err := m.Migrate(w, r, s); err != nil {
+		return err
+	}
+
+	event.Dispatch(d, event.NewSessionMigrated(r, previous, s.ID()))
+
+	return nil
+}
+
+type readTokenKey struct{}
+
+func withReadToken(r *http.Request, tok token.Token) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), readTokenKey{}, tok))
+}
+
+// wasAuthenticated reports if the token read from the session was authenticated
+func wasAuthenticated(r *http.Request) bool {
+	tok, ok := r.Context().Value(readTokenKey{}).(token.Token)
+	return ok && tok.IsFullyAuthenticated()
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"github.com/gorilla/sessions"
 	"net/http"
+
+	"github.com/iwyg/goauth/tracing"
 )
 
 type Session interface {
@@ -21,12 +23,18 @@ type Provider interface {
 	Save(http.ResponseWriter, *http.Request, Session) error
 }
 
+// GorillaSessionProvider provides sessions of a gorilla store, loading and saving
+// them is traced with Tracer if set
 type GorillaSessionProvider struct {
-	Store sessions.Store
+	Store  sessions.Store
+	Tracer tracing.Tracer
 }
 
 func (sp *GorillaSessionProvider) Provide(r *http.Request, name string) (Session, error) {
+	_, span := tracing.Start(sp.Tracer, r.Context(), tracing.SpanSessionLoad, tracing.String("session", name))
 	gs, err := sp.Store.Get(r, name)
+	tracing.End(span, err)
+
 	return &GorillaSession{Session: gs}, err
 }
 
@@ -46,6 +54,38 @@ func (sp *GorillaSessionProvider) Save(w http.ResponseWriter, r *http.Request, s
 	}
 
 	gs := sess.(*GorillaSession)
+	_, span := tracing.Start(sp.Tracer, r.Context(), tracing.SpanSessionSave, tracing.String("session", gs.Session.Name()))
+	err := gs.Session.Save(r, w)
+	tracing.End(span, err)
+
+	return err
+}
+
+// Migrate removes the stored session and saves its values under a new id
+func (sp *GorillaSessionProvider) Migrate(w http.ResponseWriter, r *http.Request, session Session) error {
+	gs, ok := session.(*GorillaSession)
+	if !ok {
+		return errors.New("incompatible session")
+	}
+
+	_, span := tracing.Start(sp.Tracer, r.Context(), tracing.SpanSessionSave, tracing.String("session", gs.Session.Name()), tracing.Bool("migrate", true))
+	err := sp.migrate(w, r, gs)
+	tracing.End(span, err)
+
+	return err
+}
+
+func (sp *GorillaSessionProvider) migrate(w http.ResponseWriter, r *http.Request, gs *GorillaSession) error {
+	if gs.Session.ID != "" {
+		maxAge := gs.Session.Options.MaxAge
+		gs.Session.Options.MaxAge = -1
+		if err := gs.Session.Save(r, w); err != nil {
+			return err
+		}
+		gs.Session.Options.MaxAge = maxAge
+		gs.Session.ID = ""
+	}
+
 	return gs.Session.Save(r, w)
 }
 
@@ -0,0 +1,20 @@
+package session
+
+// TargetPathKey is the session key the path a user requested before being sent to
+// the login is stored at, per firewall
+func TargetPathKey(firewall string) string {
+	return "_security." + firewall + ".target_path"
+}
+
+func SetTargetPath(s Session, firewall string, path string) {
+	s.SetValue(TargetPathKey(firewall), path)
+}
+
+func TargetPath(s Session, firewall string) string {
+	path, _ := s.GetValue(TargetPathKey(firewall)).(string)
+	return path
+}
+
+func RemoveTargetPath(s Session, firewall string) {
+	s.RemoveValue(TargetPathKey(firewall))
+}
@@ -0,0 +1,242 @@
+package stack
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/iwyg/goauth/authentication"
+	"github.com/iwyg/goauth/authorization"
+	"github.com/iwyg/goauth/firewall"
+	"github.com/iwyg/goauth/logging"
+	"github.com/iwyg/goauth/session"
+	"github.com/iwyg/goauth/token"
+)
+
+// Stages order the steps of a stack, steps of lower stages wrap those of higher
+// stages. Custom steps may use any value in between.
+const (
+	StageTokenStore       = 100
+	StageSessionStart     = 200
+	StageSessionReader    = 300
+	StageAuthentication   = 400
+	StageLogout           = 500
+	StageSessionWriter    = 600
+	StageSessionSave      = 700
+	StageLoggedInRedirect = 800
+	StageAccessControl    = 900
+)
+
+// Names of the built-in steps, custom steps may require them
+const (
+	TokenStore       = "token_store"
+	SessionStart     = "session_start"
+	SessionReader    = "session_reader"
+	Authentication   = "authentication"
+	Logout           = "logout"
+	SessionWriter    = "session_writer"
+	SessionSave      = "session_save"
+	LoggedInRedirect = "logged_in_redirect"
+	AccessControl    = "access_control"
+	Firewall         = "firewall"
+)
+
+// Step is a middleware of the stack. Requires names steps, or what they provide,
+// that must run before it, Excludes names steps that must not be in the stack.
+type Step struct {
+	Name       string
+	Stage      int
+	Requires   []string
+	Provides   []string
+	Excludes   []string
+	Middleware func(http.Handler) http.Handler
+}
+
+// DependencyError is returned if a step runs without a step it requires
+type DependencyError struct {
+	Step     string
+	Requires string
+}
+
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("step \"%s\" requires \"%s\" to run before it", e.Step, e.Requires)
+}
+
+// Builder assembles the security middlewares in the order they depend on each
+// other, regardless of the order they are added in
+type Builder struct {
+	steps []Step
+	opts  []logging.Option
+}
+
+// New creates a builder, opts are passed to the built-in middlewares
+func New(opts ...logging.Option) *Builder {
+	return &Builder{opts: opts}
+}
+
+func (b *Builder) Add(s Step) *Builder {
+	b.steps = append(b.steps, s)
+	return b
+}
+
+// TokenStore adds the request token store, most steps require it
+func (b *Builder) TokenStore() *Builder {
+	return b.Add(Step{Name: TokenStore, Stage: StageTokenStore, Middleware: token.NewTokenStoreProviderMiddleware()})
+}
+
+// Session starts the session, reads the token from it before authentication and
+// writes and saves it afterwards
+func (b *Builder) Session(conf session.Config, sp session.Provider) *Builder {
+	b.Add(Step{
+		Name: SessionStart, Stage: StageSessionStart,
+		Middleware: session.NewSessionStartHandlerMiddleware(conf, sp, b.opts...),
+	})
+	b.Add(Step{
+		Name: SessionReader, Stage: StageSessionReader, Requires: []string{TokenStore, SessionStart},
+		Middleware: session.NewSessionReaderMiddleWare(conf, sp, b.opts...),
+	})
+	b.Add(Step{
+		Name: SessionWriter, Stage: StageSessionWriter, Requires: []string{TokenStore, SessionReader},
+		Middleware: session.NewSessionWriterMiddleWare(conf, sp, b.opts...),
+	})
+
+	return b.Add(Step{
+		Name: SessionSave, Stage: StageSessionSave, Requires: []string{SessionStart},
+		Middleware: session.NewSessionSaveHandlerMiddleware(conf, sp, b.opts...),
+	})
+}
+
+func (b *Builder) Authentication(a authentication.RequestAuthenticator) *Builder {
+	return b.Add(Step{
+		Name: Authentication, Stage: StageAuthentication, Requires: []string{TokenStore},
+		Middleware: authentication.NewAuthenticationHandlerMiddleware(a, b.opts...),
+	})
+}
+
+func (b *Builder) Logout(conf *authentication.LogoutConfig) *Builder {
+	return b.Add(Step{
+		Name: Logout, Stage: StageLogout, Requires: []string{TokenStore},
+		Middleware: authentication.NewLogoutMiddleware(conf, b.opts...),
+	})
+}
+
+// LoggedInRedirect sends authenticated users requesting the login path to target
+func (b *Builder) LoggedInRedirect(path string, target *authentication.TargetPathRedirect) *Builder {
+	return b.Add(Step{
+		Name: LoggedInRedirect, Stage: StageLoggedInRedirect, Requires: []string{TokenStore},
+		Middleware: authentication.NewTargetPathRedirectLoggedIn(path, target, b.opts...),
+	})
+}
+
+func (b *Builder) AccessControl(
+	accessMap *firewall.AccessMap,
+	adm authorization.AccessDecisionManager,
+	entryPoint firewall.EntryPoint,
+	deniedHandler firewall.AccessDeniedHandler,
+) *Builder {
+	return b.Add(Step{
+		Name: AccessControl, Stage: StageAccessControl, Requires: []string{TokenStore},
+		Middleware: firewall.NewAccessControlMiddleware(accessMap, adm, entryPoint, deniedHandler, b.opts...),
+	})
+}
+
+// Firewall adds the firewall, it provides the token store and handles sessions,
+// authentication, logout and access control with its listeners. The steps doing
+// the same, including a second token store, cannot be added with it.
+func (b *Builder) Firewall(fw *firewall.Firewall) *Builder {
+	return b.Add(Step{
+		Name: Firewall, Stage: StageTokenStore, Provides: []string{TokenStore},
+		Excludes:   []string{TokenStore, SessionStart, SessionReader, SessionWriter, SessionSave, Authentication, Logout, AccessControl},
+		Middleware: firewall.NewFirewallMiddleware(fw, b.opts...),
+	})
+}
+
+func (b *Builder) ordered() []Step {
+	steps := make([]Step, len(b.steps))
+	copy(steps, b.steps)
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].Stage < steps[j].Stage
+	})
+
+	return steps
+}
+
+func (b *Builder) validate(steps []Step) error {
+	seen := make(map[string]bool)
+	provided := make(map[string]bool)
+
+	added := make(map[string]bool, len(steps))
+	for _, s := range steps {
+		added[s.Name] = true
+	}
+
+	for _, s := range steps {
+		for _, ex := range s.Excludes {
+			if added[ex] {
+				return fmt.Errorf("step \"%s\" cannot be combined with \"%s\"", s.Name, ex)
+			}
+		}
+	}
+
+	for _, s := range steps {
+		switch {
+		case s.Name == "":
+			return errors.New("step name is required")
+		case s.Middleware == nil:
+			return fmt.Errorf("step \"%s\" has no middleware", s.Name)
+		case seen[s.Name]:
+			return fmt.Errorf("step \"%s\" is added twice", s.Name)
+		}
+
+		for _, req := range s.Requires {
+			if !provided[req] {
+				return &DependencyError{Step: s.Name, Requires: req}
+			}
+		}
+
+		seen[s.Name] = true
+		provided[s.Name] = true
+		for _, p := range s.Provides {
+			provided[p] = true
+		}
+	}
+
+	return nil
+}
+
+// Build validates the steps and returns a middleware running them in order
+func (b *Builder) Build() (func(http.Handler) http.Handler, error) {
+	steps := b.ordered()
+	if err := b.validate(steps); err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		for i := len(steps) - 1; i >= 0; i-- {
+			next = steps[i].Middleware(next)
+		}
+
+		return next
+	}, nil
+}
+
+// MustBuild is Build but panics on invalid stacks
+func (b *Builder) MustBuild() func(http.Handler) http.Handler {
+	mw, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+
+	return mw
+}
+
+// Handler wraps next with the stack
+func (b *Builder) Handler(next http.Handler) (http.Handler, error) {
+	mw, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	return mw(next), nil
+}
@@ -0,0 +1,115 @@
+package stack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/iwyg/goauth/authentication"
+	"github.com/iwyg/goauth/authorization"
+	"github.com/iwyg/goauth/firewall"
+	"github.com/iwyg/goauth/session"
+	"github.com/iwyg/goauth/token"
+)
+
+func recordStep(name string, stage int, order *[]string, requires ...string) Step {
+	return Step{
+		Name:     name,
+		Stage:    stage,
+		Requires: requires,
+		Middleware: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				*order = append(*order, name)
+				next.ServeHTTP(w, r)
+			})
+		},
+	}
+}
+
+func TestBuildOrdersSteps(t *testing.T) {
+	var order []string
+	var hasStore bool
+
+	b := New().
+		Add(recordStep("access", StageAccessControl, &order, TokenStore)).
+		Add(recordStep("auth", StageAuthentication, &order, TokenStore)).
+		TokenStore()
+
+	h, err := b.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := token.TokenStoreFromRequest(r)
+		hasStore = err == nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", h)
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if expected := []string{"auth", "access"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected steps %v, got %v", expected, order)
+	}
+
+	if !hasStore {
+		t.Error("expected the token store to wrap the handler")
+	}
+}
+
+func TestBuildValidatesDependencies(t *testing.T) {
+	sp := &session.GorillaSessionProvider{Store: sessions.NewCookieStore([]byte("secret"))}
+	conf := session.Config{Name: "app", TokenKey: "token"}
+
+	_, err := New().Session(conf, sp).Build()
+	derr, ok := err.(*DependencyError)
+	if !ok {
+		t.Fatalf("expected dependency error, got %v", err)
+	}
+
+	if derr.Step != SessionReader || derr.Requires != TokenStore {
+		t.Errorf("expected session reader to require the token store, got %v", derr)
+	}
+
+	if _, err := New().Session(conf, sp).TokenStore().Build(); err != nil {
+		t.Errorf("expected stack to build, got %v", err)
+	}
+
+	var order []string
+	late := Step{Name: "late_store", Stage: StageAccessControl + 1, Provides: []string{TokenStore}, Middleware: recordStep("", 0, &order).Middleware}
+	if _, err := New().Add(late).Add(recordStep("auth", StageAuthentication, &order, TokenStore)).Build(); err == nil {
+		t.Error("expected a requirement provided by a later step to fail")
+	}
+}
+
+func TestFirewallExcludesSteps(t *testing.T) {
+	sp := &session.GorillaSessionProvider{Store: sessions.NewCookieStore([]byte("secret"))}
+	conf := session.Config{Name: "app", TokenKey: "token"}
+	fw := &firewall.Firewall{Map: firewall.NewFirewallMap()}
+	guard := authentication.NewGuardRequestAuthenticator(&token.RequestContextStoreProvider{}, nil, nil, nil)
+
+	tests := map[string]func(b *Builder) *Builder{
+		"token store":    func(b *Builder) *Builder { return b.TokenStore() },
+		"session":        func(b *Builder) *Builder { return b.Session(conf, sp) },
+		"authentication": func(b *Builder) *Builder { return b.Authentication(guard) },
+		"access control": func(b *Builder) *Builder {
+			return b.AccessControl(firewall.NewAccessMap(), authorization.NewDefaultAccessDecisionManager(), &firewall.UnauthorizedEntryPoint{}, &firewall.ForbiddenHandler{})
+		},
+	}
+
+	for name, add := range tests {
+		if _, err := add(New().Firewall(fw)).Build(); err == nil {
+			t.Errorf("%s: expected the firewall to exclude the step", name)
+		}
+
+		if _, err := New().Firewall(fw).Build(); err != nil {
+			t.Errorf("%s: expected the firewall alone to build, got %v", name, err)
+		}
+
+		// the order steps are added in does not matter
+		if _, err := add(New()).Firewall(fw).Build(); err == nil {
+			t.Errorf("%s: expected the step to conflict with a firewall added later", name)
+		}
+	}
+}
@@ -22,6 +22,12 @@ func initTokenStore(r *http.Request) (Store, *http.Request) {
 	return store, r
 }
 
+// WithStore returns the token store of the request, adding a new store to the
+// request context if there is none yet
+func WithStore(r *http.Request) (Store, *http.Request) {
+	return initTokenStore(r)
+}
+
 func TokenStoreFromRequest(r *http.Request) (Store, error) {
 	s := r.Context().Value(TokenStoreKey)
 	store, ok := s.(Store)
@@ -0,0 +1,127 @@
+package token
+
+import (
+	"strings"
+
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/role"
+)
+
+// Scope is an OAuth style grant a token is limited to, e.g. "orders:read"
+type Scope string
+
+// ScopedToken is a token that was granted a restricted set of scopes,
+// typically issued to machine clients via bearer tokens or api keys
+type ScopedToken interface {
+	PostAuthToken
+	Scopes() []Scope
+}
+
+// ParseScopes splits a space or comma delimited scope list as it is found in
+// OAuth "scope" parameters. Duplicates are removed, order is preserved.
+func ParseScopes(s string) []Scope {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+
+	seen := make(map[Scope]bool, len(fields))
+	scopes := make([]Scope, 0, len(fields))
+
+	for _, f := range fields {
+		sc := Scope(f)
+		if seen[sc] {
+			continue
+		}
+		seen[sc] = true
+		scopes = append(scopes, sc)
+	}
+
+	return scopes
+}
+
+// IntersectScopes returns the requested scopes that are also granted
+func IntersectScopes(granted []Scope, requested []Scope) []Scope {
+	out := make([]Scope, 0, len(requested))
+	for _, r := range requested {
+		if containsScope(granted, r) {
+			out = append(out, r)
+		}
+	}
+
+	return out
+}
+
+// HasScopes reports whether the token was granted all of the given scopes.
+// Tokens that do not implement ScopedToken are not restricted by scopes, their
+// authority is expressed by roles alone.
+func HasScopes(t Token, scopes ...Scope) bool {
+	st, ok := t.(ScopedToken)
+	if !ok {
+		return true
+	}
+
+	granted := st.Scopes()
+	for _, s := range scopes {
+		if !containsScope(granted, s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsScope(scopes []Scope, s Scope) bool {
+	for _, sc := range scopes {
+		if sc == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// restrictRoles returns the allowed client roles that the owning identity has
+// or reaches in h, so a client never exceeds its owner
+func restrictRoles(h role.Hierarchy, owner []role.Role, allowed []role.Role) []role.Role {
+	reachable := role.Reachable(h, owner)
+	out := make([]role.Role, 0, len(allowed))
+	for _, a := range allowed {
+		for _, o := range reachable {
+			if o == a {
+				out = append(out, a)
+				break
+			}
+		}
+	}
+
+	return out
+}
+
+type ScopedAuthenticatedToken struct {
+	AuthenticatedToken
+	TokenScopes []Scope `json:"scopes"`
+
+	hierarchy role.Hierarchy
+}
+
+func (t *ScopedAuthenticatedToken) Scopes() []Scope {
+	return t.TokenScopes
+}
+
+func (t *ScopedAuthenticatedToken) WithIdentity(id identity.Identity) IdentityToken {
+	return NewScopedToken(t.hierarchy, id, t.TokenScopes, t.TokenRoles)
+}
+
+// NewScopedToken creates a token for a machine client acting on behalf of the
+// given identity. The token's roles are the roles the client is allowed to use
+// that the identity has, including roles the identity reaches in h.
+func NewScopedToken(h role.Hierarchy, identity identity.Identity, scopes []Scope, clientRoles []role.Role) *ScopedAuthenticatedToken {
+	return &ScopedAuthenticatedToken{
+		AuthenticatedToken: AuthenticatedToken{
+			TokenIdentity: identity,
+			TokenRoles:    restrictRoles(h, identity.Roles(), clientRoles),
+		},
+		TokenScopes: scopes,
+		hierarchy:   h,
+	}
+}
@@ -0,0 +1,53 @@
+package token
+
+import (
+	"testing"
+
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/role"
+)
+
+func TestParseScopes(t *testing.T) {
+	scopes := ParseScopes("orders:read, orders:write orders:read")
+	if len(scopes) != 2 || scopes[0] != "orders:read" || scopes[1] != "orders:write" {
+		t.Errorf("expected [orders:read orders:write], got %v", scopes)
+	}
+}
+
+func TestHasScopes(t *testing.T) {
+	scoped := NewScopedToken(nil, &identity.InMemoryIdentity{}, []Scope{"orders:read"}, nil)
+	if !HasScopes(scoped, "orders:read") || HasScopes(scoped, "orders:read", "orders:write") {
+		t.Error("expected scoped token to be limited to its scopes")
+	}
+
+	if !HasScopes(NewAuthenticatedToken(&identity.InMemoryIdentity{}), "orders:write") {
+		t.Error("expected unscoped token not to be restricted by scopes")
+	}
+}
+
+func TestScopedTokenRoles(t *testing.T) {
+	h, err := role.NewHierarchy(map[role.Role][]role.Role{role.RLAdmin: {role.RLUser}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner := &identity.InMemoryIdentity{UserRoles: []role.Role{role.RLAdmin}}
+
+	tok := NewScopedToken(h, owner, nil, []role.Role{role.RLUser, "ROLE_BILLING"})
+	if len(tok.TokenRoles) != 1 || tok.TokenRoles[0] != role.RLUser {
+		t.Errorf("expected the client to get ROLE_USER reached by ROLE_ADMIN, got %v", tok.TokenRoles)
+	}
+
+	if refreshed := tok.WithIdentity(owner); len(refreshed.Roles()) != 1 {
+		t.Errorf("expected the refreshed token to keep ROLE_USER, got %v", refreshed.Roles())
+	}
+
+	if tok := NewScopedToken(nil, owner, nil, []role.Role{role.RLUser}); len(tok.TokenRoles) != 0 {
+		t.Errorf("expected no inherited roles without a hierarchy, got %v", tok.TokenRoles)
+	}
+
+	tok = NewScopedToken(h, &identity.InMemoryIdentity{UserRoles: []role.Role{role.RLUser}}, nil, []role.Role{role.RLAdmin})
+	if len(tok.TokenRoles) != 0 {
+		t.Errorf("expected the client not to exceed its owner, got %v", tok.TokenRoles)
+	}
+}
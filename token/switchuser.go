@@ -0,0 +1,39 @@
+package token
+
+import (
+	"github.com/iwyg/goauth/identity"
+	"github.com/iwyg/goauth/role"
+)
+
+// SwitchUserToken is issued when a privileged identity impersonates another one.
+// It wraps the impersonator's token so it can be restored and audited.
+type SwitchUserToken struct {
+	AuthenticatedToken
+	OriginalToken IdentityToken `json:"original"`
+}
+
+// Original returns the token of the impersonator
+func (t *SwitchUserToken) Original() IdentityToken {
+	return t.OriginalToken
+}
+
+// Impersonator returns the identity that is acting as the token's identity
+func (t *SwitchUserToken) Impersonator() identity.Identity {
+	return t.OriginalToken.Identity()
+}
+
+func (t *SwitchUserToken) WithIdentity(id identity.Identity) IdentityToken {
+	return NewSwitchUserToken(id, t.OriginalToken)
+}
+
+func NewSwitchUserToken(target identity.Identity, original IdentityToken) *SwitchUserToken {
+	roles := append([]role.Role{}, target.Roles()...)
+
+	return &SwitchUserToken{
+		AuthenticatedToken: AuthenticatedToken{
+			TokenIdentity: target,
+			TokenRoles:    append(roles, role.RLPreviousAdmin),
+		},
+		OriginalToken: original,
+	}
+}
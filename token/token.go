@@ -65,6 +65,8 @@ type AuthenticatedToken struct {
 	TokenRoles    []role.Role       `json:"roles"`
 }
 
+// Roles returns the roles granted to the token. Checks resolve them against
+// their role hierarchy, see role.Reachable.
 func (t *AuthenticatedToken) Roles() []role.Role {
 	return t.TokenRoles
 }
@@ -123,5 +125,7 @@ func Init() {
 
 	gob.Register(&AnonToken{})
 	gob.Register(&AuthenticatedToken{})
+	gob.Register(&ScopedAuthenticatedToken{})
+	gob.Register(&SwitchUserToken{})
 	initialized = true
 }
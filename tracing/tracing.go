@@ -0,0 +1,165 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+)
+
+// Spans created by the library
+const (
+	SpanAuthenticate     = "goauth.authenticate"
+	SpanAuthenticator    = "goauth.authenticator"
+	SpanIdentityLookup   = "goauth.identity.lookup"
+	SpanIdentityRefresh  = "goauth.identity.refresh"
+	SpanCredentialsCheck = "goauth.credentials.check"
+	SpanSessionLoad      = "goauth.session.load"
+	SpanSessionSave      = "goauth.session.save"
+)
+
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key string, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span is an operation of a trace. Its methods mirror OpenTelemetry spans, so an
+// OTel span is adapted by converting the attributes.
+type Span interface {
+	End()
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+}
+
+// Tracer starts spans as children of the span in ctx. Components take a tracer
+// like a metrics collector, e.g. config.Loader.Tracer or firewall.Config.Tracer. An
+// OpenTelemetry adapter wraps trace.Tracer:
+//
+//	func (t *otelTracer) Start(ctx context.Context, name string, attrs ...tracing.Attribute) (context.Context, tracing.Span) {
+//		ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(convert(attrs)...))
+//		return ctx, &otelSpan{span}
+//	}
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) End()                             {}
+func (noopSpan) SetAttributes(attrs ...Attribute) {}
+func (noopSpan) RecordError(err error)            {}
+
+// NoopTracer creates spans that record nothing
+type NoopTracer struct{}
+
+func (NoopTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+// Start starts a span with t if it is not nil. Without a tracer it returns ctx
+// and a no-op span without allocating.
+func Start(t Tracer, ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	if t == nil {
+		return ctx, noopSpan{}
+	}
+
+	return t.Start(ctx, name, attrs...)
+}
+
+// End records err, if any, and ends the span
+func End(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// RecordedSpan is a span collected by a Recorder
+type RecordedSpan struct {
+	Name       string
+	Parent     *RecordedSpan
+	Attributes []Attribute
+	Errors     []error
+	Ended      bool
+
+	recorder *Recorder
+}
+
+func (s *RecordedSpan) End() {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+
+	s.Ended = true
+}
+
+func (s *RecordedSpan) SetAttributes(attrs ...Attribute) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+
+	s.Attributes = append(s.Attributes, attrs...)
+}
+
+func (s *RecordedSpan) RecordError(err error) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+
+	s.Errors = append(s.Errors, err)
+}
+
+// Attribute returns the value of the attribute with the given key
+func (s *RecordedSpan) Attribute(key string) (interface{}, bool) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+
+	for i := len(s.Attributes) - 1; i >= 0; i-- {
+		if s.Attributes[i].Key == key {
+			return s.Attributes[i].Value, true
+		}
+	}
+
+	return nil, false
+}
+
+type spanKey struct{}
+
+// Recorder is a tracer keeping all spans in memory, e.g. for tests
+type Recorder struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+func (r *Recorder) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*RecordedSpan)
+	s := &RecordedSpan{Name: name, Parent: parent, Attributes: attrs, recorder: r}
+
+	r.mu.Lock()
+	r.spans = append(r.spans, s)
+	r.mu.Unlock()
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Spans returns the spans with the given name, all spans if name is empty
+func (r *Recorder) Spans(name string) []*RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []*RecordedSpan
+	for _, s := range r.spans {
+		if name == "" || s.Name == name {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNoopTracer(t *testing.T) {
+	ctx := context.Background()
+	got, span := Start(nil, ctx, "op", String("k", "v"))
+	if got != ctx {
+		t.Error("expected the no-op tracer to return the context unchanged")
+	}
+	End(span, errors.New("failed"))
+
+	if allocs := testing.AllocsPerRun(100, func() {
+		_, span := Start(nil, ctx, "op")
+		End(span, nil)
+	}); allocs != 0 {
+		t.Errorf("expected no allocations, got %v", allocs)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	t.Parallel()
+
+	rec := &Recorder{}
+	ctx, parent := Start(rec, context.Background(), "parent")
+	_, child := Start(rec, ctx, "child", String("k", "v"))
+	End(child, errors.New("failed"))
+	parent.End()
+
+	spans := rec.Spans("child")
+	if len(spans) != 1 {
+		t.Fatalf("expected one child span, got %d", len(spans))
+	}
+
+	s := spans[0]
+	if s.Parent == nil || s.Parent.Name != "parent" {
+		t.Error("expected the child to have the parent span")
+	}
+
+	if v, ok := s.Attribute("k"); !ok || v != "v" {
+		t.Errorf("expected attribute k=v, got %v", v)
+	}
+
+	if len(s.Errors) != 1 || !s.Ended {
+		t.Error("expected the child to record the error and end")
+	}
+
+	if len(rec.Spans("")) != 2 {
+		t.Error("expected two spans")
+	}
+}